@@ -116,6 +116,62 @@ var WaitPeriodTimeMeasurement = time.Second
 // ErrInvalidTargetIP invalid target IP
 var ErrInvalidTargetIP = errors.New("Invalid Target IP")
 
+// ErrNoCACerts indicates the CA bundle of a check did not contain any PEM certificates
+var ErrNoCACerts = errors.New("no certificates found in ca_cert")
+
+// ErrTLSServerNameRequired indicates the certificate cannot be verified without knowing the server's name
+var ErrTLSServerNameRequired = errors.New("tls_server_name is required by verify_and_fail")
+
+// tlsVersion13 is the version number of TLS 1.3, which is only available as tls.VersionTLS13 in later Go releases
+const tlsVersion13 = 0x0304
+
+// tlsMinVersions maps the values accepted by tls_min_version
+var tlsMinVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tlsVersion13,
+}
+
+// tlsVersionNames maps the protocol versions reported by ssl_session_version
+var tlsVersionNames = map[uint16]string{
+	tls.VersionSSL30: "ssl3",
+	tls.VersionTLS10: "tls1.0",
+	tls.VersionTLS11: "tls1.1",
+	tls.VersionTLS12: "tls1.2",
+	tlsVersion13:     "tls1.3",
+}
+
+// tlsCipherSuiteNames maps the cipher suites implemented by crypto/tls to their IANA names. The TLS 1.3 suites
+// are given by their code points, since they are only available as constants in later Go releases.
+var tlsCipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                "TLS_RSA_WITH_RC4_128_SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            "TLS_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            "TLS_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+}
+
 // Base provides an abstract implementation of the Check
 // interface leaving Run to be implemented.
 type Base struct {
@@ -124,6 +180,10 @@ type Base struct {
 	context context.Context
 	// cancel is associated with the context and can be invoked to initiate the cancellation
 	cancel context.CancelFunc
+	// tlsRoots replaces the system roots when verifying certificates, as configured by newTLSConfig
+	tlsRoots *x509.CertPool
+	// tlsSkipVerify disables verification of certificates by AddTLSMetrics, as configured by newTLSConfig
+	tlsSkipVerify bool
 }
 
 // GetTargetIP obtains the specific IP address selected for this check.
@@ -233,116 +293,180 @@ func (ch *Base) GetCheckIn() *protocheck.CheckIn {
 
 // TLSMetrics is utilized the provide TLS metrics
 type TLSMetrics struct {
+	// Verified is also set when the check's details skip verification
 	Verified bool
+	// HostnameMatched is set when the leaf certificate is valid for the server name sent by SNI
+	HostnameMatched bool
+	// Expiry is the earliest expiry of the certificates presented by the peer
+	Expiry time.Time
 }
 
-// AddTLSMetrics function sets up secure metrics from provided check result
-// It then returns a list of tls metrics with optional Verified parameter
-// that depends on whether the certificate was successfully signed (based on provided tls
-// connection state)
-func (ch *Base) AddTLSMetrics(cr *Result, state tls.ConnectionState) *TLSMetrics {
-	// TODO: refactor.  Cyclomatic complexity of 35
-	tlsMetrics := &TLSMetrics{}
-	if len(state.PeerCertificates) == 0 {
-		return tlsMetrics
+// newTLSConfig sets up the configuration of a check's TLS connections from the details embedded within the check,
+// where serverName applies unless overridden by the details. Unless the details ask to fail the connection,
+// certificates are accepted by the handshake and instead verified by AddTLSMetrics.
+func (ch *Base) newTLSConfig(details protocheck.TLSDetails, serverName string) (*tls.Config, error) {
+	if details.ServerName != "" {
+		serverName = details.ServerName
+	}
+	config := &tls.Config{InsecureSkipVerify: true, ServerName: serverName}
+	ch.tlsRoots = nil
+	ch.tlsSkipVerify = false
+
+	if details.CACert != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(details.CACert)) {
+			return nil, ErrNoCACerts
+		}
+		config.RootCAs = roots
+		ch.tlsRoots = roots
+	}
+
+	switch details.VerifyMode {
+	case "", protocheck.TLSVerify:
+	case protocheck.TLSVerifySkip:
+		ch.tlsSkipVerify = true
+	case protocheck.TLSVerifyAndFail:
+		if serverName == "" {
+			return nil, ErrTLSServerNameRequired
+		}
+		config.InsecureSkipVerify = false
+	default:
+		return nil, fmt.Errorf("unsupported tls_verify %s", details.VerifyMode)
+	}
+
+	if details.ClientCert != "" || details.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(details.ClientCert), []byte(details.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if details.MinVersion != "" {
+		version, ok := tlsMinVersions[details.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls_min_version %s", details.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	return config, nil
+}
+
+// serverName determines the name sent by SNI, which is the target hostname unless the check targets an address
+func (ch *Base) serverName() string {
+	if ch.TargetAlias == nil && ch.TargetHostname != nil && net.ParseIP(*ch.TargetHostname) == nil {
+		return *ch.TargetHostname
+	}
+	return ""
+}
+
+// tlsVersionName names the protocol version of a session, as reported by ssl_session_version
+func tlsVersionName(version uint16) string {
+	if name, ok := tlsVersionNames[version]; ok {
+		return name
+	}
+	return "-"
+}
+
+// tlsCipherSuiteName names the cipher suite of a session by its IANA name, as reported by ssl_session_cipher,
+// where suites unknown to the poller are given by their code point
+func tlsCipherSuiteName(suite uint16) string {
+	if name, ok := tlsCipherSuiteNames[suite]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", suite)
+}
+
+// verifyTLSChain verifies the peer certificates against the check's roots, unless its details skip verification
+func (ch *Base) verifyTLSChain(state tls.ConnectionState) error {
+	if ch.tlsSkipVerify {
+		return nil
 	}
-	// Validate certificate chain
-	cert := state.PeerCertificates[0]
 	opts := x509.VerifyOptions{
-		Roots:         nil,
+		Roots:         ch.tlsRoots,
 		CurrentTime:   time.Now(),
 		DNSName:       state.ServerName,
 		Intermediates: x509.NewCertPool(),
 	}
-	for i, cert := range state.PeerCertificates {
-		if i == 0 {
-			continue
-		}
+	for _, cert := range state.PeerCertificates[1:] {
 		opts.Intermediates.AddCert(cert)
 	}
-	_, err := cert.Verify(opts)
-	if err != nil {
-		tlsMetrics.Verified = false
-		cr.AddMetric(metric.NewMetric("cert_error", "", metric.MetricString, err.Error(), ""))
-	} else {
-		tlsMetrics.Verified = true
-	}
-	switch cert.PublicKeyAlgorithm {
-	case x509.RSA:
-		publicKey := cert.PublicKey.(*rsa.PublicKey)
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// addTLSPublicKeyMetrics adds the type and size of the certificate's public key
+func addTLSPublicKeyMetrics(cr *Result, cert *x509.Certificate) {
+	switch publicKey := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
 		cr.AddMetric(metric.NewMetric("cert_bits", "", metric.MetricNumber, publicKey.N.BitLen(), ""))
 		cr.AddMetric(metric.NewMetric("cert_type", "", metric.MetricString, "rsa", ""))
-	case x509.DSA:
-		publicKey := cert.PublicKey.(*dsa.PublicKey)
+	case *dsa.PublicKey:
 		cr.AddMetric(metric.NewMetric("cert_bits", "", metric.MetricNumber, publicKey.Q.BitLen(), ""))
 		cr.AddMetric(metric.NewMetric("cert_type", "", metric.MetricString, "dsa", ""))
-	case x509.ECDSA:
-		publicKey := cert.PublicKey.(*ecdsa.PublicKey)
+	case *ecdsa.PublicKey:
 		cr.AddMetric(metric.NewMetric("cert_bits", "", metric.MetricNumber, publicKey.Params().BitSize, ""))
 		cr.AddMetric(metric.NewMetric("cert_type", "", metric.MetricString, "ecdsa", ""))
 	default:
 		cr.AddMetric(metric.NewMetric("cert_bits", "", metric.MetricNumber, "0", ""))
 		cr.AddMetric(metric.NewMetric("cert_type", "", metric.MetricString, "-", ""))
 	}
+}
+
+// addTLSChainMetrics adds the length of the chain presented by the peer, the earliest expiry of its certificates
+// and the issuer and expiry of each intermediate, numbered from 1 for the issuer of the leaf. It returns the
+// earliest expiry.
+func addTLSChainMetrics(cr *Result, chain []*x509.Certificate, now time.Time) time.Time {
+	expiry := chain[0].NotAfter
+	for i, cert := range chain[1:] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+		prefix := fmt.Sprintf("cert_intermediate_%d_", i+1)
+		if issuer, err := utils.GetDNFromCert(cert.Issuer, "/"); err == nil {
+			cr.AddMetric(metric.NewMetric(prefix+"issuer", "", metric.MetricString, issuer, ""))
+		}
+		cr.AddMetric(metric.NewMetric(prefix+"end", "", metric.MetricNumber, cert.NotAfter.Unix(), ""))
+	}
+	cr.AddMetric(metric.NewMetric("cert_chain_length", "", metric.MetricNumber, len(chain), ""))
+	cr.AddMetric(metric.NewMetric("cert_chain_end", "", metric.MetricNumber, expiry.Unix(), ""))
+	cr.AddMetric(metric.NewMetric("cert_chain_end_in", "", metric.MetricNumber, expiry.Unix()-now.Unix(), ""))
+	return expiry
+}
+
+// AddTLSMetrics function sets up secure metrics from provided check result
+// It then returns a list of tls metrics with optional Verified parameter
+// that depends on whether the certificate was successfully signed (based on provided tls
+// connection state)
+func (ch *Base) AddTLSMetrics(cr *Result, state tls.ConnectionState) *TLSMetrics {
+	tlsMetrics := &TLSMetrics{}
+	if len(state.PeerCertificates) == 0 {
+		return tlsMetrics
+	}
+	now := time.Now()
+	cert := state.PeerCertificates[0]
+
+	// Validate certificate chain
+	if err := ch.verifyTLSChain(state); err != nil {
+		cr.AddMetric(metric.NewMetric("cert_error", "", metric.MetricString, err.Error(), ""))
+	} else {
+		tlsMetrics.Verified = true
+	}
+	// HOSTNAME, which is only known when sent by SNI
+	if state.ServerName != "" {
+		tlsMetrics.HostnameMatched = cert.VerifyHostname(state.ServerName) == nil
+		cr.AddMetric(metric.NewMetric("cert_hostname_match", "", metric.MetricBool, tlsMetrics.HostnameMatched, ""))
+	}
+
+	addTLSPublicKeyMetrics(cr, cert)
 	// CERT SIG ALGO
 	cr.AddMetric(metric.NewMetric("cert_sig_algo", "", metric.MetricString, strings.ToLower(cert.SignatureAlgorithm.String()), ""))
-	var sslVersion string
-	switch state.Version {
-	case tls.VersionSSL30:
-		sslVersion = "ssl3"
-	case tls.VersionTLS10:
-		sslVersion = "tls1.0"
-	case tls.VersionTLS11:
-		sslVersion = "tls1.1"
-	case tls.VersionTLS12:
-		sslVersion = "tls1.2"
-	default:
-		sslVersion = "-"
-	}
 	// SESSION VERSION
-	cr.AddMetric(metric.NewMetric("ssl_session_version", "", metric.MetricString, sslVersion, ""))
-	var cipherSuite string
-	switch state.CipherSuite {
-	case tls.TLS_RSA_WITH_RC4_128_SHA:
-		cipherSuite = "TLS_RSA_WITH_RC4_128_SHA"
-	case tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:
-		cipherSuite = "TLS_RSA_WITH_3DES_EDE_CBC_SHA"
-	case tls.TLS_RSA_WITH_AES_128_CBC_SHA:
-		cipherSuite = "TLS_RSA_WITH_AES_128_CBC_SHA"
-	case tls.TLS_RSA_WITH_AES_256_CBC_SHA:
-		cipherSuite = "TLS_RSA_WITH_AES_256_CBC_SHA"
-	case tls.TLS_RSA_WITH_AES_128_GCM_SHA256:
-		cipherSuite = "TLS_RSA_WITH_AES_128_GCM_SHA256"
-	case tls.TLS_RSA_WITH_AES_256_GCM_SHA384:
-		cipherSuite = "TLS_RSA_WITH_AES_256_GCM_SHA384"
-	case tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:
-		cipherSuite = "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA"
-	case tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:
-		cipherSuite = "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA"
-	case tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:
-		cipherSuite = "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA"
-	case tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:
-		cipherSuite = "TLS_ECDHE_RSA_WITH_RC4_128_SHA"
-	case tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:
-		cipherSuite = "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA"
-
-	case tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:
-		cipherSuite = "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"
-	case tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:
-		cipherSuite = "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA"
-	case tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:
-		cipherSuite = "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
-	case tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:
-		cipherSuite = "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"
-	case tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:
-		cipherSuite = "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"
-	case tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:
-		cipherSuite = "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"
-	default:
-		cipherSuite = "-"
-	}
+	cr.AddMetric(metric.NewMetric("ssl_session_version", "", metric.MetricString, tlsVersionName(state.Version), ""))
 	// SESSION CIPHER
-	cr.AddMetric(metric.NewMetric("ssl_session_cipher", "", metric.MetricString, cipherSuite, ""))
+	cr.AddMetric(metric.NewMetric("ssl_session_cipher", "", metric.MetricString, tlsCipherSuiteName(state.CipherSuite), ""))
+	// OCSP STAPLING
+	cr.AddMetric(metric.NewMetric("ocsp_stapled", "", metric.MetricBool, len(state.OCSPResponse) > 0, ""))
 	// ISSUER
 	if issuer, err := utils.GetDNFromCert(cert.Issuer, "/"); err == nil {
 		cr.AddMetric(metric.NewMetric("cert_issuer", "", metric.MetricString, issuer, ""))
@@ -357,7 +481,9 @@ func (ch *Base) AddTLSMetrics(cr *Result, state tls.ConnectionState) *TLSMetrics
 	cr.AddMetric(metric.NewMetric("cert_start", "", metric.MetricNumber, cert.NotBefore.Unix(), ""))
 	certExpiry := cert.NotAfter.Unix()
 	cr.AddMetric(metric.NewMetric("cert_end", "", metric.MetricNumber, certExpiry, ""))
-	cr.AddMetric(metric.NewMetric("cert_end_in", "", metric.MetricNumber, certExpiry - time.Now().Unix(), ""))
+	cr.AddMetric(metric.NewMetric("cert_end_in", "", metric.MetricNumber, certExpiry-now.Unix(), ""))
+	// CHAIN
+	tlsMetrics.Expiry = addTLSChainMetrics(cr, state.PeerCertificates, now)
 	return tlsMetrics
 }
 
@@ -0,0 +1,326 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultDNSPort is the nameserver port used when the check details do not specify one
+	DefaultDNSPort = uint64(53)
+	// MaxDNSMessageLength is the largest DNS message that will be read from the nameserver
+	MaxDNSMessageLength = 65535
+
+	dnsProtocolUDP = "udp"
+	dnsProtocolTCP = "tcp"
+)
+
+var (
+	dnsRecordTypes = map[string]dnsmessage.Type{
+		"A":     dnsmessage.TypeA,
+		"AAAA":  dnsmessage.TypeAAAA,
+		"CNAME": dnsmessage.TypeCNAME,
+		"MX":    dnsmessage.TypeMX,
+		"NS":    dnsmessage.TypeNS,
+		"SOA":   dnsmessage.TypeSOA,
+		"SRV":   dnsmessage.TypeSRV,
+		"TXT":   dnsmessage.TypeTXT,
+	}
+
+	dnsRCodeNames = map[dnsmessage.RCode]string{
+		dnsmessage.RCodeSuccess:        "NOERROR",
+		dnsmessage.RCodeFormatError:    "FORMERR",
+		dnsmessage.RCodeServerFailure:  "SERVFAIL",
+		dnsmessage.RCodeNameError:      "NXDOMAIN",
+		dnsmessage.RCodeNotImplemented: "NOTIMP",
+		dnsmessage.RCodeRefused:        "REFUSED",
+	}
+)
+
+// DNSCheck conveys DNS checks
+type DNSCheck struct {
+	Base
+	protocheck.DNSCheckDetails
+}
+
+// NewDNSCheck - Constructor for a DNS Check
+func NewDNSCheck(base *Base) (Check, error) {
+	check := &DNSCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_dns",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates the nameserver address
+// from check port and target ip
+func (ch *DNSCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultDNSPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+func (ch *DNSCheck) buildQuery(id uint16) ([]byte, error) {
+	recordType, ok := dnsRecordTypes[strings.ToUpper(ch.Details.RecordType)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type: %v", ch.Details.RecordType)
+	}
+	query := ch.Details.Query
+	if !strings.HasSuffix(query, ".") {
+		query += "."
+	}
+	name, err := dnsmessage.NewName(query)
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: recordType, Class: dnsmessage.ClassINET},
+		},
+	}
+	return msg.Pack()
+}
+
+// exchange sends the query to the nameserver and waits for the response carrying the same ID.
+// The network given determines if the message is sent as a UDP datagram or length-prefixed over TCP.
+func (ch *DNSCheck) exchange(network, addr string, id uint16, query []byte, timeout time.Duration) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	stream := strings.HasPrefix(network, dnsProtocolTCP)
+	if stream {
+		prefixed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(prefixed, uint16(len(query)))
+		copy(prefixed[2:], query)
+		query = prefixed
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, MaxDNSMessageLength)
+	for {
+		var n int
+		if stream {
+			if _, err := io.ReadFull(conn, buffer[:2]); err != nil {
+				return nil, err
+			}
+			n = int(binary.BigEndian.Uint16(buffer[:2]))
+			if _, err := io.ReadFull(conn, buffer[:n]); err != nil {
+				return nil, err
+			}
+		} else {
+			n, err = conn.Read(buffer)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buffer[:n]); err != nil {
+			return nil, errors.Wrap(err, "invalid response")
+		}
+		// stray datagrams, such as a late reply to an earlier query, are skipped
+		if !msg.Header.Response || msg.Header.ID != id {
+			continue
+		}
+		return &msg, nil
+	}
+}
+
+func formatDNSAnswer(resource dnsmessage.Resource) string {
+	switch body := resource.Body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(body.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(body.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return body.CNAME.String()
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", body.Pref, body.MX.String())
+	case *dnsmessage.NSResource:
+		return body.NS.String()
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", body.NS.String(), body.MBox.String(),
+			body.Serial, body.Refresh, body.Retry, body.Expire, body.MinTTL)
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", body.Priority, body.Weight, body.Port, body.Target.String())
+	case *dnsmessage.TXTResource:
+		return strings.Join(body.TXT, "")
+	}
+	return ""
+}
+
+func dnsRCodeName(rcode dnsmessage.RCode) string {
+	if name, ok := dnsRCodeNames[rcode]; ok {
+		return name
+	}
+	return strconv.Itoa(int(rcode))
+}
+
+// Run method implements Check.Run method for DNS
+// please see Check interface for more information
+func (ch *DNSCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := strings.ToLower(ch.Details.Protocol)
+	if protocol == "" {
+		protocol = dnsProtocolUDP
+	}
+	if protocol != dnsProtocolUDP && protocol != dnsProtocolTCP {
+		crs.SetStatus(fmt.Sprintf("unsupported protocol: %v", ch.Details.Protocol))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":     ch.GetLogPrefix(),
+		"address":    addr,
+		"query":      ch.Details.Query,
+		"recordType": ch.Details.RecordType,
+		"protocol":   protocol,
+	}).Info("Running check")
+
+	// an unpredictable ID guards against spoofed responses
+	idBytes := make([]byte, 2)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idBytes)
+	query, err := ch.buildQuery(id)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Setup Network
+	var suffix string
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		suffix = "4"
+	case protocheck.ResolverIPV6:
+		suffix = "6"
+	}
+
+	timeout := ch.GetTimeoutDuration()
+	starttime := utils.NowTimestampMillis()
+	resp, err := ch.exchange(protocol+suffix, addr, id, query, timeout)
+	if err == nil && resp.Header.Truncated && protocol == dnsProtocolUDP {
+		log.WithFields(log.Fields{
+			"prefix": ch.GetLogPrefix(),
+		}).Debug("Response was truncated, retrying over TCP")
+		resp, err = ch.exchange(dnsProtocolTCP+suffix, addr, id, query, timeout)
+	}
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	rtt := utils.NowTimestampMillis() - starttime
+
+	answers := make([]string, 0, len(resp.Answers))
+	var minTTL uint32
+	for i, answer := range resp.Answers {
+		answers = append(answers, formatDNSAnswer(answer))
+		if i == 0 || answer.Header.TTL < minTTL {
+			minTTL = answer.Header.TTL
+		}
+	}
+	answerStr := strings.Join(answers, ", ")
+	rcode := dnsRCodeName(resp.Header.RCode)
+
+	cr.AddMetric(metric.NewMetric("rtt", "", metric.MetricNumber, rtt, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("answer_count", "", metric.MetricNumber, len(resp.Answers), ""))
+	cr.AddMetric(metric.NewMetric("answer", "", metric.MetricString, answerStr, ""))
+	cr.AddMetric(metric.NewMetric("rcode", "", metric.MetricString, rcode, ""))
+	if len(resp.Answers) > 0 {
+		cr.AddMetric(metric.NewMetric("ttl", "", metric.MetricNumber, int64(minTTL), metric.UnitSeconds))
+	}
+
+	// Answer Match
+	if len(ch.Details.AnswerMatch) > 0 {
+		re, err := regexp.Compile(ch.Details.AnswerMatch)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		match := ""
+		for _, answer := range answers {
+			if m := re.FindString(answer); m != "" {
+				match = m
+				break
+			}
+		}
+		cr.AddMetric(metric.NewMetric("answer_match", "", metric.MetricString, match, ""))
+	}
+
+	// Status Line
+	sl.Add("rcode", rcode)
+	sl.Add("answers", len(resp.Answers))
+	sl.Add("rtt", rtt)
+
+	if resp.Header.RCode == dnsmessage.RCodeSuccess {
+		crs.SetStateAvailable()
+	} else {
+		crs.SetStateUnavailable()
+	}
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,181 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTestServer is an in-process nameserver that answers every query from a fixed set of records
+type dnsTestServer struct {
+	conn    net.PacketConn
+	records map[string][]dnsmessage.Resource
+}
+
+func newDNSTestServer(t *testing.T, records map[string][]dnsmessage.Resource) *dnsTestServer {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &dnsTestServer{conn: conn, records: records}
+	go s.serve()
+	return s
+}
+
+func (s *dnsTestServer) port() int {
+	return s.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (s *dnsTestServer) close() {
+	s.conn.Close()
+}
+
+func (s *dnsTestServer) serve() {
+	buffer := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buffer[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+		question := query.Questions[0]
+
+		resp := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:            query.Header.ID,
+				Response:      true,
+				Authoritative: true,
+			},
+			Questions: query.Questions,
+		}
+		answers, ok := s.records[question.Name.String()+question.Type.String()]
+		if ok {
+			resp.Answers = answers
+		} else {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+		packed, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(packed, addr)
+	}
+}
+
+func dnsTestRecords() map[string][]dnsmessage.Resource {
+	name := dnsmessage.MustNewName("www.example.com.")
+	return map[string][]dnsmessage.Resource{
+		"www.example.com.TypeA": {
+			{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 11}},
+			},
+		},
+		"www.example.com.TypeMX": {
+			{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeMX, Class: dnsmessage.ClassINET, TTL: 3600},
+				Body:   &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")},
+			},
+		},
+	}
+}
+
+func TestDNSCheck_A(t *testing.T) {
+	server := newDNSTestServer(t, dnsTestRecords())
+	defer server.close()
+
+	ch := newTestCheck(t, "remote.dns", fmt.Sprintf(`{"port":%d,"query":"www.example.com","record_type":"A","answer_match":"192\\.0\\.2\\.1."}`,
+		server.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("rtt", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("answer_count", "", metric.MetricNumber, 2, ""),
+		ExpectMetric("answer", "", metric.MetricString, "192.0.2.10, 192.0.2.11", ""),
+		ExpectMetric("rcode", "", metric.MetricString, "NOERROR", ""),
+		ExpectMetric("ttl", "", metric.MetricNumber, int64(60), metric.UnitSeconds),
+		ExpectMetric("answer_match", "", metric.MetricString, "192.0.2.10", ""),
+	}, crs.Get(0).Metrics)
+}
+
+func TestDNSCheck_MX(t *testing.T) {
+	server := newDNSTestServer(t, dnsTestRecords())
+	defer server.close()
+
+	ch := newTestCheck(t, "remote.dns", fmt.Sprintf(`{"port":%d,"query":"www.example.com.","record_type":"mx"}`,
+		server.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available)
+	answer, err := crs.Get(0).GetMetric("answer").ToString()
+	require.NoError(t, err)
+	assert.Equal(t, "10 mail.example.com.", answer)
+}
+
+func TestDNSCheck_NXDOMAIN(t *testing.T) {
+	server := newDNSTestServer(t, dnsTestRecords())
+	defer server.close()
+
+	ch := newTestCheck(t, "remote.dns", fmt.Sprintf(`{"port":%d,"query":"missing.example.com","record_type":"A"}`,
+		server.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "rcode=NXDOMAIN")
+	rcode, err := crs.Get(0).GetMetric("rcode").ToString()
+	require.NoError(t, err)
+	assert.Equal(t, "NXDOMAIN", rcode)
+	assert.Nil(t, crs.Get(0).GetMetric("ttl"))
+}
+
+func TestDNSCheck_UnsupportedRecordType(t *testing.T) {
+	ch := newTestCheck(t, "remote.dns", `{"port":53,"query":"www.example.com","record_type":"HINFO"}`)
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "unsupported record type: HINFO", crs.Status)
+}
+
+func TestDNSCheck_InvalidAnswerMatch(t *testing.T) {
+	server := newDNSTestServer(t, dnsTestRecords())
+	defer server.close()
+
+	ch := newTestCheck(t, "remote.dns", fmt.Sprintf(`{"port":%d,"query":"www.example.com","record_type":"A","answer_match":"("}`,
+		server.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "error parsing regexp: missing closing ): `(`", crs.Status)
+}
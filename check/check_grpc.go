@@ -0,0 +1,326 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// GRPCHealthCheckPath is the method of the standard gRPC health service
+	GRPCHealthCheckPath = "/grpc.health.v1.Health/Check"
+	// MaxGRPCMessageLength bounds the size of the health check response
+	MaxGRPCMessageLength = int64(1024)
+
+	// grpcMessageHeaderLength covers the compressed flag and message length that prefix each message
+	grpcMessageHeaderLength = 5
+	grpcStatusOK            = "0"
+)
+
+// The HealthCheckResponse.ServingStatus values of grpc.health.v1
+const (
+	GRPCServingStatusUnknown        = 0
+	GRPCServingStatusServing        = 1
+	GRPCServingStatusNotServing     = 2
+	GRPCServingStatusServiceUnknown = 3
+)
+
+var (
+	// ErrGRPCMalformedResponse indicates the health check response could not be decoded
+	ErrGRPCMalformedResponse = errors.New("malformed health check response")
+
+	grpcServingStatusNames = map[uint64]string{
+		GRPCServingStatusUnknown:        "UNKNOWN",
+		GRPCServingStatusServing:        "SERVING",
+		GRPCServingStatusNotServing:     "NOT_SERVING",
+		GRPCServingStatusServiceUnknown: "SERVICE_UNKNOWN",
+	}
+)
+
+// GRPCCheck conveys gRPC health checks
+type GRPCCheck struct {
+	Base
+	protocheck.GRPCCheckDetails
+}
+
+// NewGRPCCheck - Constructor for a gRPC Check
+func NewGRPCCheck(base *Base) (Check, error) {
+	check := &GRPCCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_grpc",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *GRPCCheck) GenerateAddress() (string, error) {
+	portStr := strconv.FormatUint(ch.Details.Port, 10)
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, portStr), nil
+}
+
+// tlsConfig builds the client TLS configuration, where the server name follows the authority override
+func (ch *GRPCCheck) tlsConfig(host string) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         host,
+		NextProtos:         []string{http2.NextProtoTLS},
+	}
+	if ch.Details.ClientCert != "" || ch.Details.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(ch.Details.ClientCert), []byte(ch.Details.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// encodeGRPCHealthCheckRequest frames a HealthCheckRequest, which holds the service name as field 1
+func encodeGRPCHealthCheckRequest(service string) []byte {
+	var message bytes.Buffer
+	if service != "" {
+		message.WriteByte(0x0a)
+		length := make([]byte, binary.MaxVarintLen64)
+		message.Write(length[:binary.PutUvarint(length, uint64(len(service)))])
+		message.WriteString(service)
+	}
+	framed := make([]byte, grpcMessageHeaderLength, grpcMessageHeaderLength+message.Len())
+	binary.BigEndian.PutUint32(framed[1:], uint32(message.Len()))
+	return append(framed, message.Bytes()...)
+}
+
+// decodeGRPCHealthCheckResponse extracts the serving status, field 1, from a framed HealthCheckResponse
+func decodeGRPCHealthCheckResponse(framed []byte) (uint64, error) {
+	if len(framed) < grpcMessageHeaderLength || framed[0] != 0 {
+		return 0, ErrGRPCMalformedResponse
+	}
+	length := binary.BigEndian.Uint32(framed[1:])
+	message := framed[grpcMessageHeaderLength:]
+	if uint64(len(message)) < uint64(length) {
+		return 0, ErrGRPCMalformedResponse
+	}
+	message = message[:length]
+
+	status := uint64(GRPCServingStatusUnknown)
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, ErrGRPCMalformedResponse
+		}
+		message = message[n:]
+		switch key & 0x7 {
+		case 0: // varint
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, ErrGRPCMalformedResponse
+			}
+			message = message[n:]
+			if key>>3 == 1 {
+				status = value
+			}
+		case 2: // length delimited
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return 0, ErrGRPCMalformedResponse
+			}
+			message = message[n+int(length):]
+		default:
+			return 0, ErrGRPCMalformedResponse
+		}
+	}
+	return status, nil
+}
+
+// Run method implements Check.Run method for gRPC
+// please see Check interface for more information
+func (ch *GRPCCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+		"ssl":     ch.Details.UseSSL,
+		"service": ch.Details.Service,
+	}).Info("Running check")
+
+	authority := ch.Details.Authority
+	if authority == "" {
+		authority = addr
+	}
+	host := authority
+	if h, _, err := net.SplitHostPort(authority); err == nil {
+		host = h
+	}
+
+	var tlsConfig *tls.Config
+	scheme := "http"
+	if ch.Details.UseSSL {
+		scheme = "https"
+		tlsConfig, err = ch.tlsConfig(host)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection, where HTTP/2 is spoken without TLS by dialing the plain connection as if it were TLS
+	var connectEndTime int64
+	transport := &http2.Transport{
+		AllowHTTP: !ch.Details.UseSSL,
+		DialTLS: func(_, _ string, _ *tls.Config) (net.Conn, error) {
+			conn, err := dialContextWithDialer(context.Background(), nd, network, addr, tlsConfig)
+			connectEndTime = utils.NowTimestampMillis()
+			return conn, err
+		},
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: timeout}
+
+	// Health Check
+	req, err := http.NewRequest("POST", scheme+"://"+addr+GRPCHealthCheckPath,
+		bytes.NewReader(encodeGRPCHealthCheckRequest(ch.Details.Service)))
+	if err != nil {
+		return nil, err
+	}
+	req.Host = authority
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer resp.Body.Close()
+	body, err := ch.readLimit(resp.Body, MaxGRPCMessageLength)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	endtime := utils.NowTimestampMillis()
+
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectEndTime-starttime, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("rpc_latency", "", metric.MetricNumber, endtime-connectEndTime, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// TLS Metrics
+	if resp.TLS != nil {
+		if metrics := ch.AddTLSMetrics(cr, *resp.TLS); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		crs.SetStatus(fmt.Sprintf("HTTP status %d", resp.StatusCode))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// the status is sent as a trailer, or as a header when the server responds without a message
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	if code, err := strconv.ParseInt(grpcStatus, 10, 64); err == nil {
+		cr.AddMetric(metric.NewMetric("grpc_status", "", metric.MetricNumber, code, ""))
+	}
+	if grpcStatus != grpcStatusOK {
+		if unescaped, err := url.PathUnescape(grpcMessage); err == nil {
+			grpcMessage = unescaped
+		}
+		crs.SetStatus(fmt.Sprintf("grpc-status %s: %s", grpcStatus, grpcMessage))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	status, err := decodeGRPCHealthCheckResponse(body)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	statusName, ok := grpcServingStatusNames[status]
+	if !ok {
+		statusName = strconv.FormatUint(status, 10)
+	}
+	cr.AddMetric(metric.NewMetric("serving_status", "", metric.MetricString, statusName, ""))
+
+	// Status Line
+	sl.Add("status", statusName)
+	sl.Add("rpc_latency", endtime-connectEndTime)
+	crs.SetStatus(sl.String())
+
+	if status == GRPCServingStatusServing {
+		crs.SetStateAvailable()
+	} else {
+		crs.SetStateUnavailable()
+	}
+	return crs, nil
+}
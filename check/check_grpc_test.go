@@ -0,0 +1,139 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// grpcHealthHandler implements grpc.health.v1.Health/Check, answering with the status of each known service
+func grpcHealthHandler(t *testing.T, statuses map[string]byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/grpc.health.v1.Health/Check", r.URL.Path)
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		// skip the message header, field key and length
+		service := ""
+		if len(body) > 7 {
+			service = string(body[7:])
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("X-Authority", r.Host)
+
+		status, ok := statuses[service]
+		if !ok {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "unknown%20service")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, status})
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}
+}
+
+// serveH2C serves HTTP/2 without TLS on the listener
+func serveH2C(listener net.Listener, handler http.Handler) {
+	server := &http2.Server{}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+	}
+}
+
+func grpcTestStatuses() map[string]byte {
+	return map[string]byte{"": 1, "orders": 1, "billing": 2}
+}
+
+func TestGRPCCheck_Serving(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveH2C(listener, grpcHealthHandler(t, grpcTestStatuses()))
+
+	crs := runTestCheck(t, "remote.grpc", fmt.Sprintf(`{"port":%d,"service":"orders"}`, listener.Addr().(*net.TCPAddr).Port))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "status=SERVING")
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("tt_connect", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("rpc_latency", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("grpc_status", "", metric.MetricNumber, int64(0), ""),
+		ExpectMetric("serving_status", "", metric.MetricString, "SERVING", ""),
+	}, crs.Get(0).Metrics)
+}
+
+func TestGRPCCheck_NotServing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveH2C(listener, grpcHealthHandler(t, grpcTestStatuses()))
+
+	crs := runTestCheck(t, "remote.grpc", fmt.Sprintf(`{"port":%d,"service":"billing"}`,
+		listener.Addr().(*net.TCPAddr).Port))
+
+	assert.False(t, crs.Available)
+	serving, _ := crs.Get(0).GetMetric("serving_status").ToString()
+	assert.Equal(t, "NOT_SERVING", serving)
+}
+
+func TestGRPCCheck_UnknownService(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveH2C(listener, grpcHealthHandler(t, grpcTestStatuses()))
+
+	crs := runTestCheck(t, "remote.grpc", fmt.Sprintf(`{"port":%d,"service":"missing"}`,
+		listener.Addr().(*net.TCPAddr).Port))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "grpc-status 5: unknown service", crs.Status)
+	assert.Equal(t, int64(5), crs.Get(0).GetMetric("grpc_status").Value)
+}
+
+func TestGRPCCheck_TLS(t *testing.T) {
+	cert, err := tls.X509KeyPair(utils.LocalhostCert, utils.LocalhostKey)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(grpcHealthHandler(t, grpcTestStatuses()))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{http2.NextProtoTLS}}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.grpc", fmt.Sprintf(`{"port":%d,"ssl":true,"authority":"grpc.example.com:443"}`,
+		server.Listener.Addr().(*net.TCPAddr).Port))
+
+	assert.True(t, crs.Available, crs.Status)
+	ValidateMetrics(t, []string{"cert_issuer", "cert_end_in", "ssl_session_version"}, crs.Get(0))
+}
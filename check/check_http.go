@@ -17,18 +17,27 @@
 package check
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	protocol "github.com/racker/rackspace-monitoring-poller/protocol/check"
@@ -45,12 +54,21 @@ var (
 	DefaultPort = "80"
 	// DefaultSecurePort the default TLS port is 443
 	DefaultSecurePort = "443"
+	// FormContentType the content type of form payloads, unless another is given
+	FormContentType = "application/x-www-form-urlencoded"
+	// ErrHTTPBodyAndForm indicates both a request body and form fields were given
+	ErrHTTPBodyAndForm = errors.New("request_body and form are mutually exclusive")
 )
 
 // HTTPCheck conveys HTTP checks
 type HTTPCheck struct {
 	Base
 	protocol.HTTPCheckDetails
+
+	// oauth2Token is the token last obtained by the OAuth2 client credentials grant, which is reused until it expires
+	oauth2Token *oauth2Token
+	// previousBodyHash is the body_sha256 reported by the previous run, if body_hash is enabled
+	previousBodyHash string
 }
 
 // NewHTTPCheck - Constructor for an HTTP Check
@@ -68,39 +86,19 @@ func NewHTTPCheck(base *Base) (Check, error) {
 	return check, nil
 }
 
-func disableRedirects(req *http.Request, via []*http.Request) error {
-	return http.ErrUseLastResponse
-}
-
-// Run method implements Check.Run method for HTTP
-// please see Check interface for more information
-func (ch *HTTPCheck) Run() (*ResultSet, error) {
-	// TODO: refactor.  High cyclomatic complexity (21)
-	log.WithFields(log.Fields{
-		"prefix": ch.GetLogPrefix(),
-		"type":   ch.CheckType,
-		"id":     ch.Id,
-	}).Debug("Running HTTP Check")
-
-	ctx, cancel := context.WithTimeout(context.Background(), ch.GetTimeoutDuration())
-	defer cancel()
-
-	sl := utils.NewStatusLine()
-	cr := NewResult()
-	crs := NewResultSet(ch, cr)
-	starttime := utils.NowTimestampMillis()
-
-	// Parse URL and Replace Host with IP
-	parsed, err := url.Parse(ch.Details.Url)
+// targetURL parses rawURL and replaces its host with the target IP, keeping the port or defaulting it by scheme.
+// The host originally given is also returned, for use in the Host header and as the TLS server name.
+func (ch *Base) targetURL(rawURL string) (*url.URL, string, error) {
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	host, port, err := net.SplitHostPort(parsed.Host)
 	if err != nil {
 		if strings.Contains(err.Error(), "missing port in address") {
 			if len(port) == 0 {
-				if parsed.Scheme == "http" {
+				if parsed.Scheme == "http" || parsed.Scheme == "ws" {
 					port = DefaultPort
 				} else {
 					port = DefaultSecurePort
@@ -108,12 +106,12 @@ func (ch *HTTPCheck) Run() (*ResultSet, error) {
 				host = parsed.Host
 			}
 		} else {
-			return nil, err
+			return nil, "", err
 		}
 	}
 	ip, err := ch.GetTargetIP()
 	if err != nil && err != ErrInvalidTargetIP {
-		return crs, err
+		return nil, "", err
 	}
 	if ip == "" {
 		log.WithFields(log.Fields{
@@ -122,104 +120,310 @@ func (ch *HTTPCheck) Run() (*ResultSet, error) {
 		ip = host
 	}
 	parsed.Host = net.JoinHostPort(ip, port)
-	url := parsed.String()
+	return parsed, host, nil
+}
+
+// newJSONMetric converts a value located by a utils.JSONPath to a metric of the corresponding type, where objects
+// and arrays are conveyed as their JSON encoding and null has no metric
+func newJSONMetric(name string, value interface{}) *metric.Metric {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return metric.NewMetric(name, "", metric.MetricNumber, i, "")
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return metric.NewMetric(name, "", metric.MetricString, v.String(), "")
+		}
+		return metric.NewMetric(name, "", metric.MetricFloat, f, "")
+	case bool:
+		return metric.NewMetric(name, "", metric.MetricBool, v, "")
+	case string:
+		return metric.NewMetric(name, "", metric.MetricString, v, "")
+	}
+	encoded, _ := json.Marshal(value)
+	return metric.NewMetric(name, "", metric.MetricString, string(encoded), "")
+}
+
+func disableRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
 
-	var netClient *http.Client
-	tlsConfig := &tls.Config{InsecureSkipVerify: true, ServerName: host}
+// isHTTPNetworkError determines if a request failed to reach the server, rather than failing for reasons such as
+// the server's certificate not being verified
+func isHTTPNetworkError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// newHTTPClient sets up a client whose connections are made to the target, using the configuration created by
+// newTLSConfig
+func (ch *Base) newHTTPClient(tlsConfig *tls.Config, followRedirects bool) *http.Client {
 	transport := &http.Transport{
 		DisableKeepAlives: true,
 		TLSClientConfig:   tlsConfig,
 		DialContext:       NewCustomDialContext(ch.TargetResolver),
 	}
-	netClient = &http.Client{Transport: transport}
+	netClient := &http.Client{Transport: transport}
 
 	// Setup Redirects
-	if !ch.Details.FollowRedirects {
+	if !followRedirects {
 		netClient.CheckRedirect = disableRedirects
 	}
+	return netClient
+}
 
-	// Setup Method
-	method := strings.ToUpper(ch.Details.Method)
+// maxHTTPRedirects is the number of redirects followed before giving up, as with the http.Client default
+const maxHTTPRedirects = 10
 
-	log.WithFields(log.Fields{
-		"prefix": ch.GetLogPrefix(),
-		"method": method,
-		"url":    url,
-	}).Info("Running check")
+// httpHop records when a request passed through each of its phases, where following a redirect begins another hop
+type httpHop struct {
+	url          string
+	code         int
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	end          time.Time
+}
 
-	// Setup Request
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		crs.SetStatusFromError(err)
-		crs.SetStateUnavailable()
-		return crs, nil
+// millisBetween is the time elapsed between two phases, which is zero unless both occurred
+func millisBetween(from, to time.Time) int64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return int64(to.Sub(from) / time.Millisecond)
+}
+
+// addPhaseMetrics adds the time spent in each phase of the hop, where a phase that did not occur, such as the TLS
+// handshake of a plain HTTP request, took no time
+func (h *httpHop) addPhaseMetrics(cr *Result, dimension string) {
+	cr.AddMetric(metric.NewMetric("dns_lookup_time", dimension, metric.MetricNumber, millisBetween(h.dnsStart, h.dnsDone), metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("tcp_connect_time", dimension, metric.MetricNumber, millisBetween(h.connectStart, h.connectDone), metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("tls_handshake_time", dimension, metric.MetricNumber, millisBetween(h.tlsStart, h.tlsDone), metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("request_write_time", dimension, metric.MetricNumber, millisBetween(h.gotConn, h.wroteRequest), metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("server_processing_time", dimension, metric.MetricNumber, millisBetween(h.wroteRequest, h.firstByte), metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("content_transfer_time", dimension, metric.MetricNumber, millisBetween(h.firstByte, h.end), metric.UnitMilliseconds))
+}
+
+// httpTimings traces a request through its phases, hop by hop
+type httpTimings struct {
+	sync.Mutex
+	hops    []*httpHop
+	nextURL string
+}
+
+// current is the hop in progress, which is nil until a connection is first sought
+func (t *httpTimings) current() *httpHop {
+	if len(t.hops) == 0 {
+		return nil
 	}
+	return t.hops[len(t.hops)-1]
+}
 
-	// Setup Auth
-	if len(ch.Details.AuthUser) > 0 && len(ch.Details.AuthPassword) > 0 {
-		req.SetBasicAuth(ch.Details.AuthUser, ch.Details.AuthPassword)
+// mark records the time of a phase of the hop in progress
+func (t *httpTimings) mark(phase func(hop *httpHop, now time.Time)) {
+	now := time.Now()
+	t.Lock()
+	defer t.Unlock()
+	if hop := t.current(); hop != nil {
+		phase(hop, now)
+	}
+}
+
+// followRedirect is used as the CheckRedirect of a client following redirects, ending the hop that was redirected
+func (t *httpTimings) followRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxHTTPRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxHTTPRedirects)
+	}
+	now := time.Now()
+	t.Lock()
+	defer t.Unlock()
+	if hop := t.current(); hop != nil {
+		hop.end = now
+		if req.Response != nil {
+			hop.code = req.Response.StatusCode
+		}
+	}
+	t.nextURL = req.URL.String()
+	return nil
+}
+
+// finish ends the final hop, once the body of its response has been read
+func (t *httpTimings) finish(code int) *httpHop {
+	now := time.Now()
+	t.Lock()
+	defer t.Unlock()
+	hop := t.current()
+	if hop == nil {
+		hop = &httpHop{url: t.nextURL, start: now}
+		t.hops = append(t.hops, hop)
+	}
+	hop.code = code
+	hop.end = now
+	return hop
+}
+
+// redirects is the number of redirects followed
+func (t *httpTimings) redirects() int {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.hops) == 0 {
+		return 0
+	}
+	return len(t.hops) - 1
+}
+
+// addHopResults adds a result per hop to crs, dimensioned by hop number
+func (t *httpTimings) addHopResults(crs *ResultSet) {
+	t.Lock()
+	defer t.Unlock()
+	for i, hop := range t.hops {
+		dimension := fmt.Sprintf("hop_%d", i+1)
+		hopResult := NewResult(
+			metric.NewMetric("url", dimension, metric.MetricString, hop.url, ""),
+			metric.NewMetric("code", dimension, metric.MetricString, strconv.Itoa(hop.code), ""),
+			metric.NewMetric("duration", dimension, metric.MetricNumber, millisBetween(hop.start, hop.end), metric.UnitMilliseconds),
+		)
+		hop.addPhaseMetrics(hopResult, dimension)
+		crs.Add(hopResult)
 	}
+}
+
+// newHTTPRequest sets up a request that adds tt_connect and tt_firstbyte, relative to starttime, to cr. The
+// phases of the request are traced by the httpTimings returned.
+func newHTTPRequest(ctx context.Context, cr *Result, starttime int64, method, url string, body io.Reader) (*http.Request, *httpTimings, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	timings := &httpTimings{nextURL: url}
+
 	// Setup Tracing
 	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			now := time.Now()
+			timings.Lock()
+			defer timings.Unlock()
+			timings.hops = append(timings.hops, &httpHop{url: timings.nextURL, start: now})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.dnsDone = now })
+		},
+		ConnectStart: func(network, addr string) {
+			timings.mark(func(hop *httpHop, now time.Time) {
+				if hop.connectStart.IsZero() {
+					hop.connectStart = now
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.tlsStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.tlsDone = now })
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.gotConn = now })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.wroteRequest = now })
+		},
 		GotFirstResponseByte: func() {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.firstByte = now })
 			firstbytetime := utils.NowTimestampMillis()
 			cr.AddMetric(metric.NewMetric("tt_firstbyte", "", metric.MetricNumber, firstbytetime-starttime, "milliseconds"))
 		},
 		ConnectDone: func(network, addr string, err error) {
+			timings.mark(func(hop *httpHop, now time.Time) { hop.connectDone = now })
 			connectdonetime := utils.NowTimestampMillis()
 			cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectdonetime-starttime, "milliseconds"))
 
 		},
 	}
-	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace)), timings, nil
+}
 
-	// Add Headers
-	req.Header.Add("User-Agent", UserAgent)
-	req.Host = host
-	for key, value := range ch.Details.Headers {
-		req.Header.Add(key, value)
+// newHTTPRequestBody encodes the payload of a request, being either the form fields or the body, which is decoded
+// from base64 when isBase64. No payload is sent when neither is given.
+func newHTTPRequestBody(body string, isBase64 bool, form map[string]string) (io.Reader, error) {
+	switch {
+	case len(form) > 0:
+		if body != "" {
+			return nil, ErrHTTPBodyAndForm
+		}
+		values := make(url.Values, len(form))
+		for key, value := range form {
+			values.Set(key, value)
+		}
+		return strings.NewReader(values.Encode()), nil
+	case isBase64:
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(decoded), nil
+	case body != "":
+		return strings.NewReader(body), nil
 	}
+	return nil, nil
+}
 
-	// Perform Request
-	resp, err := netClient.Do(req)
-	if err != nil {
-		crs.SetStatus("connection refused")
-		crs.SetStateUnavailable()
-		return crs, nil
+// setHTTPContentType sets the content type of the payload, where form payloads default to FormContentType unless
+// the headers already gave one
+func setHTTPContentType(req *http.Request, contentType string, form bool) {
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	} else if form && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", FormContentType)
 	}
-	defer resp.Body.Close()
+}
 
-	// Read Body
-	body, err := ch.readLimit(resp.Body, MaxHTTPResponseBodyLength)
-	if err != nil {
-		crs.SetStatusFromError(err)
-		crs.SetStateUnavailable()
-		return crs, nil
+// addHTTPHeaders adds the user agent, the host originally given and the configured headers to req
+func addHTTPHeaders(req *http.Request, host string, headers map[string]string) {
+	req.Header.Add("User-Agent", UserAgent)
+	req.Host = host
+	for key, value := range headers {
+		req.Header.Add(key, value)
 	}
-	endtime := utils.NowTimestampMillis()
+}
 
-	// Parse Body
-	if len(ch.Details.Body) > 0 {
-		re, err := regexp.Compile(ch.Details.Body)
+// addHTTPBodyMetrics adds body_match, when bodyRegex is given, and body_match_<key> for each of bodyMatches.
+// It reports whether bodyRegex matched, which it always does when empty.
+func addHTTPBodyMetrics(cr *Result, body []byte, bodyRegex string, bodyMatches map[string]string) (bool, error) {
+	matched := true
+	if len(bodyRegex) > 0 {
+		re, err := regexp.Compile(bodyRegex)
 		if err != nil {
-			crs.SetStatusFromError(err)
-			crs.SetStateUnavailable()
-			return crs, nil
+			return false, err
 		}
 		if m := re.FindSubmatch(body); m != nil {
 			cr.AddMetric(metric.NewMetric("body_match", "", metric.MetricString, string(m[0]), "string"))
 		} else {
 			cr.AddMetric(metric.NewMetric("body_match", "", metric.MetricString, "", "string"))
+			matched = false
 		}
 	}
 
 	// Body Matches
-	for key, regex := range ch.Details.BodyMatches {
+	for key, regex := range bodyMatches {
 		re, err := regexp.Compile(regex)
 		if err != nil {
-			crs.SetStatusFromError(err)
-			crs.SetStateUnavailable()
-			return crs, nil
+			return false, err
 		}
 		if m := re.FindSubmatch(body); m != nil {
 			cr.AddMetric(metric.NewMetric(fmt.Sprintf("body_match_%s", key), "", metric.MetricString, string(m[1]), ""))
@@ -227,7 +431,117 @@ func (ch *HTTPCheck) Run() (*ResultSet, error) {
 			cr.AddMetric(metric.NewMetric(fmt.Sprintf("body_match_%s", key), "", metric.MetricString, "", ""))
 		}
 	}
+	return matched, nil
+}
+
+// addHTTPJSONPathMetrics adds a metric for each of jsonPaths located within body, returning the sorted names of
+// the assertions that evaluated false
+func addHTTPJSONPathMetrics(cr *Result, body []byte, jsonPaths map[string]string) ([]string, error) {
+	if len(jsonPaths) == 0 {
+		return nil, nil
+	}
+	doc, err := utils.DecodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	var failedAssertions []string
+	for key, expr := range jsonPaths {
+		path, err := utils.CompileJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := path.Evaluate(doc)
+		if !ok {
+			continue
+		}
+		if m := newJSONMetric(key, value); m != nil {
+			cr.AddMetric(m)
+		}
+		if path.IsAssertion() && value == false {
+			failedAssertions = append(failedAssertions, key)
+		}
+	}
+	sort.Strings(failedAssertions)
+	return failedAssertions, nil
+}
 
+// httpHeaderValue combines the values of the response header named, as a list separated by commas per RFC 7230
+func httpHeaderValue(header http.Header, name string) (string, bool) {
+	values, ok := header[http.CanonicalHeaderKey(name)]
+	return strings.Join(values, ", "), ok
+}
+
+// addHTTPHeaderMetrics adds header_match_<key> for each of headerMatches, which is empty when the header is absent
+// or does not match
+func addHTTPHeaderMetrics(cr *Result, header http.Header, headerMatches map[string]protocol.HTTPHeaderMatch) error {
+	for key, match := range headerMatches {
+		re, err := regexp.Compile(match.Regex)
+		if err != nil {
+			return err
+		}
+		captured := ""
+		value, _ := httpHeaderValue(header, match.Header)
+		if m := re.FindStringSubmatch(value); m != nil {
+			captured = m[0]
+			if len(m) > 1 {
+				captured = m[1]
+			}
+		}
+		cr.AddMetric(metric.NewMetric(fmt.Sprintf("header_match_%s", key), "", metric.MetricString, captured, ""))
+	}
+	return nil
+}
+
+// checkHTTPHeaders asserts the response carries each of the required headers, matching its regex if not empty,
+// and none of the forbidden headers, matching its regex if not empty. It returns the sorted descriptions of the
+// assertions that failed, such as "header Server forbidden".
+func checkHTTPHeaders(header http.Header, required, forbidden map[string]string) ([]string, error) {
+	var failedAssertions []string
+	for name, regex := range required {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := httpHeaderValue(header, name)
+		if !ok {
+			failedAssertions = append(failedAssertions, fmt.Sprintf("header %s missing", name))
+		} else if !re.MatchString(value) {
+			failedAssertions = append(failedAssertions, fmt.Sprintf("header %s mismatch", name))
+		}
+	}
+	for name, regex := range forbidden {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := httpHeaderValue(header, name); ok && re.MatchString(value) {
+			failedAssertions = append(failedAssertions, fmt.Sprintf("header %s forbidden", name))
+		}
+	}
+	sort.Strings(failedAssertions)
+	return failedAssertions, nil
+}
+
+// httpBodyHash computes the hex encoded SHA-256 of the body, as truncated to MaxHTTPResponseBodyLength, after
+// removing each match of the ignore regexes, such as timestamps or nonces that vary between responses
+func httpBodyHash(body []byte, ignore []string) (string, error) {
+	if int64(len(body)) > MaxHTTPResponseBodyLength {
+		body = body[:MaxHTTPResponseBodyLength]
+	}
+	for _, regex := range ignore {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return "", err
+		}
+		body = re.ReplaceAllLiteral(body, nil)
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// addHTTPResponseMetrics adds the status code, duration and size of a response, returning whether the body was
+// truncated
+func addHTTPResponseMetrics(cr *Result, resp *http.Response, body []byte, duration int64) int64 {
 	truncated := int64(0)
 	if int64(len(body)) > MaxHTTPResponseBodyLength {
 		truncated = int64(1)
@@ -260,9 +574,184 @@ func (ch *HTTPCheck) Run() (*ResultSet, error) {
 	cr.AddMetric(metric.NewMetric("code_500", "", metric.MetricNumber, code500, ""))
 
 	cr.AddMetric(metric.NewMetric("code", "", metric.MetricString, codeStr, ""))
-	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, "milliseconds"))
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, duration, "milliseconds"))
 	cr.AddMetric(metric.NewMetric("bytes", "", metric.MetricNumber, len(body), "bytes"))
 	cr.AddMetric(metric.NewMetric("truncated", "", metric.MetricNumber, truncated, "bool"))
+	return truncated
+}
+
+// perform sends the request of the check, which carries the Authorization header given unless it is empty. The
+// phases of the request are traced by the httpTimings returned.
+func (ch *HTTPCheck) perform(ctx context.Context, netClient *http.Client, cr *Result, starttime int64,
+	method, url, host, authorization string) (*http.Request, *http.Response, *httpTimings, error) {
+	// Setup Request
+	reqBody, err := newHTTPRequestBody(ch.Details.RequestBody, ch.Details.Base64Body, ch.Details.Form)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	req, timings, err := newHTTPRequest(ctx, cr, starttime, method, url, reqBody)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ch.Details.FollowRedirects {
+		netClient.CheckRedirect = timings.followRedirect
+	}
+
+	// Setup Auth
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	} else if ch.usesBasicAuth() {
+		req.SetBasicAuth(ch.Details.AuthUser, ch.Details.AuthPassword)
+	}
+
+	// Add Headers
+	addHTTPHeaders(req, host, ch.Details.Headers)
+	setHTTPContentType(req, ch.Details.ContentType, len(ch.Details.Form) > 0)
+
+	resp, err := netClient.Do(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return req, resp, timings, nil
+}
+
+// Run method implements Check.Run method for HTTP
+// please see Check interface for more information
+func (ch *HTTPCheck) Run() (*ResultSet, error) {
+	log.WithFields(log.Fields{
+		"prefix": ch.GetLogPrefix(),
+		"type":   ch.CheckType,
+		"id":     ch.Id,
+	}).Debug("Running HTTP Check")
+
+	ctx, cancel := context.WithTimeout(context.Background(), ch.GetTimeoutDuration())
+	defer cancel()
+
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	// Parse URL and Replace Host with IP
+	parsed, host, err := ch.targetURL(ch.Details.Url)
+	if err != nil {
+		return nil, err
+	}
+	url := parsed.String()
+
+	tlsConfig, err := ch.newTLSConfig(ch.Details.TLSDetails, host)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	netClient := ch.newHTTPClient(tlsConfig, ch.Details.FollowRedirects)
+
+	// Setup Method
+	method := strings.ToUpper(ch.Details.Method)
+
+	log.WithFields(log.Fields{
+		"prefix": ch.GetLogPrefix(),
+		"method": method,
+		"url":    url,
+	}).Info("Running check")
+
+	// Setup Auth
+	authorization, err := ch.authorization(ctx, tlsConfig)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Perform Request
+	req, resp, timings, err := ch.perform(ctx, netClient, cr, starttime, method, url, host, authorization)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		authorization, err = ch.challengeResponse(req, resp)
+		if err != nil || authorization != "" {
+			resp.Body.Close()
+		}
+		if err == nil && authorization != "" {
+			_, resp, timings, err = ch.perform(ctx, netClient, cr, starttime, method, url, host, authorization)
+		}
+	}
+	if err != nil {
+		if isHTTPNetworkError(err) {
+			crs.SetStatus("connection refused")
+		} else {
+			crs.SetStatusFromError(err)
+		}
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer resp.Body.Close()
+
+	// Read Body
+	body, err := ch.readLimit(resp.Body, MaxHTTPResponseBodyLength)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	endtime := utils.NowTimestampMillis()
+
+	// Timings
+	timings.finish(resp.StatusCode).addPhaseMetrics(cr, "")
+	if ch.Details.FollowRedirects {
+		cr.AddMetric(metric.NewMetric("redirects", "", metric.MetricNumber, timings.redirects(), ""))
+		if timings.redirects() > 0 {
+			timings.addHopResults(crs)
+		}
+	}
+
+	// Parse Body
+	if _, err := addHTTPBodyMetrics(cr, body, ch.Details.Body, ch.Details.BodyMatches); err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// JSON Paths
+	failedAssertions, err := addHTTPJSONPathMetrics(cr, body, ch.Details.JSONPaths)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Headers
+	if err := addHTTPHeaderMetrics(cr, resp.Header, ch.Details.HeaderMatches); err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	failedHeaders, err := checkHTTPHeaders(resp.Header, ch.Details.RequiredHeaders, ch.Details.ForbiddenHeaders)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	failedAssertions = append(failedAssertions, failedHeaders...)
+
+	// Content Hash
+	if ch.Details.BodyHash {
+		hash, err := httpBodyHash(body, ch.Details.BodyHashIgnore)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		// the first run has nothing to compare against, so reports the content as unchanged
+		changed := ch.previousBodyHash != "" && hash != ch.previousBodyHash
+		ch.previousBodyHash = hash
+		cr.AddMetric(metric.NewMetric("body_sha256", "", metric.MetricString, hash, ""))
+		cr.AddMetric(metric.NewMetric("content_changed", "", metric.MetricBool, changed, ""))
+		if changed {
+			sl.AddOption("content_changed")
+		}
+	}
+
+	truncated := addHTTPResponseMetrics(cr, resp, body, endtime-starttime)
 
 	if ch.Details.IncludeBody {
 		cr.AddMetric(metric.NewMetric("body", "", metric.MetricString, string(body), ""))
@@ -282,6 +771,12 @@ func (ch *HTTPCheck) Run() (*ResultSet, error) {
 	sl.Add("bytes", len(body))
 	sl.Add("truncated", truncated)
 
+	if len(failedAssertions) > 0 {
+		crs.SetStatus(fmt.Sprintf("assertion failed: %s", strings.Join(failedAssertions, ", ")))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
 	crs.SetStateAvailable()
 	crs.SetStatus(sl.String())
 	return crs, nil
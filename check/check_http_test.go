@@ -16,16 +16,24 @@ package check_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -339,6 +347,569 @@ func TestHTTPSuccessBodyMatch(t *testing.T) {
 	}
 }
 
+const jsonHealth = `{"status":"ok","uptime":86400,"load":0.25,"ready":true,"version":{"major":2},"checks":[{"name":"db","ok":false}]}`
+
+func jsonResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, jsonHealth)
+}
+
+func runJSONPathsCheck(t *testing.T, url string, jsonPaths string) *check.ResultSet {
+	return runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","json_paths":%s}`, url, jsonPaths))
+}
+
+func TestHTTPSuccessJSONPaths(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(jsonResponse))
+	defer ts.Close()
+
+	crs := runJSONPathsCheck(t, ts.URL, `{
+		"status":"$.status",
+		"uptime":"uptime",
+		"load":"$.load",
+		"ready":"$['ready']",
+		"major":"version.major",
+		"db":"$.checks[0]",
+		"check_count":"checks.#",
+		"missing":"$.missing",
+		"status_ok":"$.status == \"ok\"",
+		"uptime_day":"$.uptime >= 86400"
+	}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	expected := []*metric.Metric{
+		metric.NewMetric("status", "", metric.MetricString, "ok", ""),
+		metric.NewMetric("uptime", "", metric.MetricNumber, int64(86400), ""),
+		metric.NewMetric("load", "", metric.MetricFloat, 0.25, ""),
+		metric.NewMetric("ready", "", metric.MetricBool, true, ""),
+		metric.NewMetric("major", "", metric.MetricNumber, int64(2), ""),
+		metric.NewMetric("db", "", metric.MetricString, `{"name":"db","ok":false}`, ""),
+		metric.NewMetric("check_count", "", metric.MetricNumber, int64(1), ""),
+		metric.NewMetric("status_ok", "", metric.MetricBool, true, ""),
+		metric.NewMetric("uptime_day", "", metric.MetricBool, true, ""),
+	}
+	for _, m := range expected {
+		assert.Equal(t, m, crs.Get(0).GetMetric(m.Name))
+	}
+	assert.Nil(t, crs.Get(0).GetMetric("missing"))
+}
+
+func TestHTTPJSONPathsAssertionFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(jsonResponse))
+	defer ts.Close()
+
+	crs := runJSONPathsCheck(t, ts.URL, `{
+		"status":"$.status",
+		"db_ok":"$.checks[0].ok == true",
+		"degraded":"$.status != 'ok'",
+		"healthy":"$.health == 'ok'"
+	}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "assertion failed: db_ok, degraded, healthy", crs.Status)
+	assert.Equal(t, false, crs.Get(0).GetMetric("db_ok").Value)
+	assert.Equal(t, "ok", crs.Get(0).GetMetric("status").Value)
+}
+
+func TestHTTPJSONPathsInvalidJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(staticResponse))
+	defer ts.Close()
+
+	crs := runJSONPathsCheck(t, ts.URL, `{"status":"$.status"}`)
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "invalid JSON")
+}
+
+// securityHeaders responds with headers typically asserted by checks
+func securityHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+	w.Header().Add("Cache-Control", "no-cache")
+	w.Header().Add("Cache-Control", "max-age=0")
+	w.Header().Set("Server", "nginx/1.13.12")
+	fmt.Fprint(w, staticHello)
+}
+
+func TestHTTPHeaderMatches(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(securityHeaders))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","header_matches":{
+		"hsts_max_age":{"header":"strict-transport-security","regex":"max-age=(\\d+)"},
+		"cache":{"header":"Cache-Control","regex":".*"},
+		"etag":{"header":"ETag","regex":".*"},
+		"server":{"header":"Server","regex":"^apache"}
+	}}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	cr := crs.Get(0)
+	assert.Equal(t, "31536000", cr.GetMetric("header_match_hsts_max_age").Value)
+	assert.Equal(t, "no-cache, max-age=0", cr.GetMetric("header_match_cache").Value)
+	assert.Equal(t, "", cr.GetMetric("header_match_etag").Value)
+	assert.Equal(t, "", cr.GetMetric("header_match_server").Value)
+}
+
+func TestHTTPHeaderAssertions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(securityHeaders))
+	defer ts.Close()
+
+	// securityHeaders announces nginx with its version, which TestHTTPHeaderAssertionsFailed forbids, so only a
+	// server that is not announced is forbidden here
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s",
+		"required_headers":{"Strict-Transport-Security":"max-age=\\d{7,}","Cache-Control":"no-cache"},
+		"forbidden_headers":{"X-Powered-By":"","Server":"^Apache"}}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "code=200")
+}
+
+func TestHTTPHeaderAssertionsFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(securityHeaders))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s",
+		"required_headers":{"Strict-Transport-Security":"max-age=\\d{9,}","Content-Security-Policy":""},
+		"forbidden_headers":{"Server":"/[0-9.]+","X-Powered-By":""}}`, ts.URL))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "assertion failed: header Content-Security-Policy missing, header Server forbidden, "+
+		"header Strict-Transport-Security mismatch", crs.Status)
+}
+
+func TestHTTPHeaderInvalidRegex(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(securityHeaders))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","required_headers":{"Server":"("}}`, ts.URL))
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "missing closing )")
+}
+
+// changingPage responds with a page stamped with the time and a nonce, whose content is given by the pointer
+func changingPage(content *string) http.HandlerFunc {
+	nonce := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonce++
+		fmt.Fprintf(w, "<html><!-- generated %s nonce=%d -->%s</html>", time.Now().Format(time.RFC3339Nano), nonce, *content)
+	}
+}
+
+func TestHTTPBodyHash(t *testing.T) {
+	page := "<html>" + staticHello + "</html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, page)
+	}))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","body_hash":true}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	sum := sha256.Sum256([]byte(page))
+	assert.Equal(t, hex.EncodeToString(sum[:]), crs.Get(0).GetMetric("body_sha256").Value)
+	assert.Equal(t, false, crs.Get(0).GetMetric("content_changed").Value)
+}
+
+func TestHTTPBodyHashContentChanged(t *testing.T) {
+	content := "Welcome"
+	ts := httptest.NewServer(changingPage(&content))
+	defer ts.Close()
+	ch := newTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","body_hash":true,
+		"body_hash_ignore":["generated \\S+", "nonce=\\d+"]}`, ts.URL))
+
+	run := func() *check.ResultSet {
+		crs, err := ch.Run()
+		require.NoError(t, err)
+		require.True(t, crs.Available, crs.Status)
+		return crs
+	}
+
+	first := run()
+	assert.Equal(t, false, first.Get(0).GetMetric("content_changed").Value)
+	second := run()
+	assert.Equal(t, false, second.Get(0).GetMetric("content_changed").Value)
+	assert.Equal(t, first.Get(0).GetMetric("body_sha256").Value, second.Get(0).GetMetric("body_sha256").Value)
+
+	content = "Defaced"
+	third := run()
+	assert.Equal(t, true, third.Get(0).GetMetric("content_changed").Value)
+	assert.Contains(t, third.Status, "content_changed")
+	fourth := run()
+	assert.Equal(t, false, fourth.Get(0).GetMetric("content_changed").Value)
+}
+
+func TestHTTPBodyHashWithoutNormalization(t *testing.T) {
+	content := "Welcome"
+	ts := httptest.NewServer(changingPage(&content))
+	defer ts.Close()
+	ch := newTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","body_hash":true}`, ts.URL))
+
+	_, err := ch.Run()
+	require.NoError(t, err)
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t, true, crs.Get(0).GetMetric("content_changed").Value)
+}
+
+// echoRequest responds with the method, content type and payload of the request
+func echoRequest(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	fmt.Fprintf(w, "method=%s\ncontent-type=%s\nbody=%s\n", r.Method, r.Header.Get("Content-Type"), body)
+}
+
+const echoMatches = `{"method":"method=(.*)","content_type":"content-type=(.*)","body":"body=(.*)"}`
+
+func TestHTTPRequestBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(echoRequest))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","method":"put","content_type":"application/json",
+		"request_body":"{\"name\":\"poller\"}","body_matches":%s}`, ts.URL, echoMatches))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "PUT", crs.Get(0).GetMetric("body_match_method").Value)
+	assert.Equal(t, "application/json", crs.Get(0).GetMetric("body_match_content_type").Value)
+	assert.Equal(t, `{"name":"poller"}`, crs.Get(0).GetMetric("body_match_body").Value)
+}
+
+func TestHTTPRequestBodyBase64(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(echoRequest))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","method":"post","content_type":"application/octet-stream",
+		"request_body":"%s","request_body_base64":true,"body_matches":%s}`,
+		ts.URL, base64.StdEncoding.EncodeToString([]byte("\x00\x01binary")), echoMatches))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "\x00\x01binary", crs.Get(0).GetMetric("body_match_body").Value)
+}
+
+func TestHTTPRequestBodyInvalidBase64(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(echoRequest))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","method":"post","request_body":"not base64!",
+		"request_body_base64":true}`, ts.URL))
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "illegal base64 data")
+}
+
+func TestHTTPRequestForm(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(echoRequest))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","method":"post","form":{"user":"alice","q":"a&b"},
+		"body_matches":%s}`, ts.URL, echoMatches))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, check.FormContentType, crs.Get(0).GetMetric("body_match_content_type").Value)
+	assert.Equal(t, "q=a%26b&user=alice", crs.Get(0).GetMetric("body_match_body").Value)
+}
+
+func TestHTTPRequestBodyAndForm(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(echoRequest))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","method":"post","request_body":"x","form":{"user":"alice"}}`,
+		ts.URL))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, check.ErrHTTPBodyAndForm.Error(), crs.Status)
+}
+
+func TestHTTPTimingPhases(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, staticHello)
+	}))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s"}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"dns_lookup_time", "tcp_connect_time", "tls_handshake_time", "request_write_time",
+		"server_processing_time", "content_transfer_time"}, cr)
+	serverProcessing, _ := cr.GetMetric("server_processing_time").ToInt64()
+	assert.True(t, serverProcessing >= 20, "server_processing_time %d", serverProcessing)
+	duration, _ := cr.GetMetric("duration").ToInt64()
+	assert.True(t, serverProcessing <= duration)
+	assert.Nil(t, cr.GetMetric("redirects"))
+	assert.Equal(t, 1, crs.Length())
+}
+
+func redirectingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusMovedPermanently))
+	mux.HandleFunc("/c", staticResponse)
+	mux.Handle("/loop", http.RedirectHandler("/loop", http.StatusFound))
+	return mux
+}
+
+func TestHTTPFollowRedirectsHops(t *testing.T) {
+	ts := httptest.NewServer(redirectingHandler())
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s/a","follow_redirects":true}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "200", crs.Get(0).GetMetric("code").Value)
+	assert.Equal(t, 2, crs.Get(0).GetMetric("redirects").Value)
+	require.Equal(t, 4, crs.Length())
+
+	expected := []struct {
+		path string
+		code string
+	}{{"/a", "302"}, {"/b", "301"}, {"/c", "200"}}
+	for i, hop := range expected {
+		cr := crs.Get(i + 1)
+		assert.True(t, strings.HasSuffix(cr.GetMetric("url").Value.(string), hop.path), "url of hop %d", i+1)
+		assert.Equal(t, hop.code, cr.GetMetric("code").Value)
+		assert.Equal(t, fmt.Sprintf("hop_%d", i+1), cr.GetMetric("duration").Dimension)
+		ValidateMetrics(t, []string{"tcp_connect_time", "server_processing_time"}, cr)
+	}
+}
+
+func TestHTTPFollowRedirectsLoop(t *testing.T) {
+	ts := httptest.NewServer(redirectingHandler())
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s/loop","follow_redirects":true}`, ts.URL))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "stopped after 10 redirects", crs.Status)
+}
+
+func TestHTTPBearerAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","auth_type":"bearer","auth_token":"abc123"}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "200", crs.Get(0).GetMetric("code").Value)
+}
+
+var digestParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,]*))`)
+
+// digestHandler challenges requests to authenticate as user, with password, by SHA-256 digest auth
+func digestHandler(t *testing.T, requests *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		authorization := r.Header.Get("Authorization")
+		if strings.HasPrefix(authorization, "Digest ") {
+			params := make(map[string]string)
+			for _, m := range digestParam.FindAllStringSubmatch(authorization, -1) {
+				params[m[1]] = m[2] + m[3]
+			}
+			h := func(s string) string {
+				sum := sha256.Sum256([]byte(s))
+				return hex.EncodeToString(sum[:])
+			}
+			assert.Equal(t, "/protected?x=1", params["uri"])
+			assert.Equal(t, "opaque-value", params["opaque"])
+			ha1 := h("user:test@example.com:password")
+			ha2 := h(r.Method + ":" + params["uri"])
+			expected := h(strings.Join([]string{ha1, "nonce-value", params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+			if params["response"] == expected {
+				fmt.Fprint(w, staticHello)
+				return
+			}
+		}
+		w.Header().Add("WWW-Authenticate", `Basic realm="test@example.com"`)
+		w.Header().Add("WWW-Authenticate", `Digest realm="test@example.com", qop="auth", algorithm=SHA-256, `+
+			`nonce="nonce-value", opaque="opaque-value"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func TestHTTPDigestAuth(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(digestHandler(t, &requests))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s/protected?x=1","method":"post","request_body":"payload",
+		"auth_type":"digest","auth_user":"user","auth_password":"password","body":"Hello"}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "200", crs.Get(0).GetMetric("code").Value)
+	assert.Equal(t, "Hello", crs.Get(0).GetMetric("body_match").Value)
+	assert.Equal(t, 2, requests)
+}
+
+func TestHTTPDigestAuthWrongPassword(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(digestHandler(t, &requests))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s/protected?x=1","auth_type":"digest","auth_user":"user",
+		"auth_password":"wrong"}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "401", crs.Get(0).GetMetric("code").Value)
+	assert.Equal(t, 2, requests)
+}
+
+// unsupportedDigestChallenge challenges with an algorithm that is not supported, ahead of the handler's challenges
+func unsupportedDigestChallenge(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("WWW-Authenticate", `Digest realm="test@example.com", qop="auth", algorithm=SHA-512-256, `+
+			`nonce="nonce-value"`)
+		if handler != nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func TestHTTPDigestAuthSkipsUnsupportedChallenge(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(unsupportedDigestChallenge(digestHandler(t, &requests)))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s/protected?x=1","auth_type":"digest","auth_user":"user",
+		"auth_password":"password"}`, ts.URL))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "200", crs.Get(0).GetMetric("code").Value)
+	assert.Equal(t, 2, requests)
+}
+
+func TestHTTPDigestAuthUnsupportedChallenge(t *testing.T) {
+	ts := httptest.NewServer(unsupportedDigestChallenge(nil))
+	defer ts.Close()
+
+	crs := runTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","auth_type":"digest","auth_user":"user",
+		"auth_password":"password"}`, ts.URL))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "unsupported digest algorithm SHA-512-256", crs.Status)
+}
+
+// oauth2Servers provides a token endpoint issuing tokens that expire in expiresIn seconds and an API accepting
+// the tokens issued, other than those revoked
+type oauth2Servers struct {
+	tokens    *httptest.Server
+	api       *httptest.Server
+	issued    int
+	expiresIn int
+	revoked   map[string]bool
+}
+
+func newOAuth2Servers(t *testing.T, expiresIn int) *oauth2Servers {
+	s := &oauth2Servers{expiresIn: expiresIn, revoked: make(map[string]bool)}
+	s.tokens = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "poller" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "client_credentials", r.PostFormValue("grant_type"))
+		assert.Equal(t, "read:health read:metrics", r.PostFormValue("scope"))
+		s.issued++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"t-%d","token_type":"bearer","expires_in":%d}`, s.issued, s.expiresIn)
+	}))
+	s.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !strings.HasPrefix(token, "t-") || s.revoked[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	return s
+}
+
+func (s *oauth2Servers) Close() {
+	s.tokens.Close()
+	s.api.Close()
+}
+
+func (s *oauth2Servers) newCheck(t *testing.T, clientSecret string) check.Check {
+	return newTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","auth_type":"oauth2","oauth2":{"token_url":"%s/token",
+		"client_id":"poller","client_secret":"%s","scopes":["read:health","read:metrics"]}}`,
+		s.api.URL, s.tokens.URL, clientSecret))
+}
+
+func runHTTPCheckCode(t *testing.T, ch check.Check) string {
+	crs, err := ch.Run()
+	require.NoError(t, err)
+	require.True(t, crs.Available, crs.Status)
+	return crs.Get(0).GetMetric("code").Value.(string)
+}
+
+func TestHTTPOAuth2TokenCached(t *testing.T) {
+	servers := newOAuth2Servers(t, 3600)
+	defer servers.Close()
+	ch := servers.newCheck(t, "s3cret")
+
+	assert.Equal(t, "200", runHTTPCheckCode(t, ch))
+	assert.Equal(t, "200", runHTTPCheckCode(t, ch))
+	assert.Equal(t, 1, servers.issued)
+}
+
+func TestHTTPOAuth2TokenExpiring(t *testing.T) {
+	// tokens expiring within the margin are renewed every run
+	servers := newOAuth2Servers(t, 5)
+	defer servers.Close()
+	ch := servers.newCheck(t, "s3cret")
+
+	assert.Equal(t, "200", runHTTPCheckCode(t, ch))
+	assert.Equal(t, "200", runHTTPCheckCode(t, ch))
+	assert.Equal(t, 2, servers.issued)
+}
+
+func TestHTTPOAuth2TokenRevoked(t *testing.T) {
+	servers := newOAuth2Servers(t, 3600)
+	defer servers.Close()
+	servers.revoked["t-1"] = true
+	ch := servers.newCheck(t, "s3cret")
+
+	assert.Equal(t, "401", runHTTPCheckCode(t, ch))
+	assert.Equal(t, "200", runHTTPCheckCode(t, ch))
+	assert.Equal(t, 2, servers.issued)
+}
+
+func TestHTTPOAuth2TokenRequestFailed(t *testing.T) {
+	servers := newOAuth2Servers(t, 3600)
+	defer servers.Close()
+
+	crs, err := servers.newCheck(t, "wrong").Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "oauth2 token request returned status 401", crs.Status)
+}
+
+func TestHTTPOAuth2TokenTLSDetails(t *testing.T) {
+	servers := newOAuth2Servers(t, 3600)
+	defer servers.Close()
+	tokens := httptest.NewTLSServer(servers.tokens.Config.Handler)
+	defer tokens.Close()
+
+	newCheck := func(verify string) check.Check {
+		return newTestCheck(t, "remote.http", fmt.Sprintf(`{"url":"%s","auth_type":"oauth2","tls_verify":"%s",
+			"oauth2":{"token_url":"%s/token","client_id":"poller","client_secret":"s3cret",
+			"scopes":["read:health","read:metrics"]}}`, servers.api.URL, verify, tokens.URL))
+	}
+
+	// the token endpoint's certificate is not trusted unless verification is skipped
+	crs, err := newCheck("").Run()
+	require.NoError(t, err)
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "oauth2 token request failed")
+	assert.Equal(t, 0, servers.issued)
+
+	assert.Equal(t, "200", runHTTPCheckCode(t, newCheck("skip")))
+	assert.Equal(t, 1, servers.issued)
+}
+
 func TestHTTPClosed(t *testing.T) {
 	// Create a server then close it
 	ts := httptest.NewServer(http.HandlerFunc(staticResponse))
@@ -499,3 +1070,104 @@ func TestHTTP_TLS(t *testing.T) {
 		t.Fatal("certificate should have unknown authority")
 	}
 }
+
+// runHTTPTLSCheck checks the server, whose listener is reached by the hostname, with TLS details added to the details
+func runHTTPTLSCheck(t *testing.T, ts *httptest.Server, hostname string, details map[string]interface{}) *check.ResultSet {
+	details["url"] = fmt.Sprintf("https://%s:%d/", hostname, ts.Listener.Addr().(*net.TCPAddr).Port)
+	encoded, err := json.Marshal(details)
+	require.NoError(t, err)
+	return runTestCheck(t, "remote.http", string(encoded))
+}
+
+func TestHTTP_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	clientCert, clientKey := pki.issue(t, "poller")
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "internal.example.com", r.TLS.ServerName)
+		assert.Equal(t, "poller", r.TLS.PeerCertificates[0].Subject.CommonName)
+		fmt.Fprint(w, staticHello)
+	}))
+	ts.TLS = pki.serverConfig(t, "internal.example.com", true)
+	ts.StartTLS()
+	defer ts.Close()
+
+	crs := runHTTPTLSCheck(t, ts, "api.example.com", map[string]interface{}{
+		"ca_cert":         string(pki.CACert),
+		"client_cert":     string(clientCert),
+		"client_key":      string(clientKey),
+		"tls_server_name": "internal.example.com",
+		"tls_min_version": "1.2",
+		"tls_verify":      "verify_and_fail",
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.NotContains(t, crs.Status, "sslerror")
+	assert.Nil(t, crs.Get(0).GetMetric("cert_error"))
+	assert.Equal(t, "/CN=internal.example.com", crs.Get(0).GetMetric("cert_subject").Value)
+}
+
+func TestHTTP_TLSVerifyModes(t *testing.T) {
+	pki := newTestPKI(t)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(staticResponse))
+	ts.TLS = pki.serverConfig(t, "api.example.com", false)
+	ts.StartTLS()
+	defer ts.Close()
+
+	t.Run("verify", func(t *testing.T) {
+		crs := runHTTPTLSCheck(t, ts, "api.example.com", map[string]interface{}{"tls_verify": "verify"})
+
+		assert.True(t, crs.Available, crs.Status)
+		assert.Contains(t, crs.Status, "sslerror")
+		assert.NotNil(t, crs.Get(0).GetMetric("cert_error"))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		crs := runHTTPTLSCheck(t, ts, "api.example.com", map[string]interface{}{"tls_verify": "skip"})
+
+		assert.True(t, crs.Available, crs.Status)
+		assert.NotContains(t, crs.Status, "sslerror")
+		assert.Nil(t, crs.Get(0).GetMetric("cert_error"))
+	})
+
+	t.Run("verify_and_fail", func(t *testing.T) {
+		crs := runHTTPTLSCheck(t, ts, "api.example.com", map[string]interface{}{"tls_verify": "verify_and_fail"})
+
+		assert.False(t, crs.Available)
+		assert.Contains(t, crs.Status, "certificate signed by unknown authority")
+	})
+
+	t.Run("wrong server name", func(t *testing.T) {
+		crs := runHTTPTLSCheck(t, ts, "other.example.com", map[string]interface{}{
+			"ca_cert":    string(pki.CACert),
+			"tls_verify": "verify_and_fail",
+		})
+
+		assert.False(t, crs.Available)
+		assert.Contains(t, crs.Status, "other.example.com")
+	})
+}
+
+func TestHTTP_TLSInvalidDetails(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(staticResponse))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		details map[string]interface{}
+		status  string
+	}{
+		{name: "ca_cert", details: map[string]interface{}{"ca_cert": "garbage"}, status: check.ErrNoCACerts.Error()},
+		{name: "client_cert", details: map[string]interface{}{"client_cert": "garbage", "client_key": "garbage"}, status: "failed to find any PEM data in certificate input"},
+		{name: "tls_min_version", details: map[string]interface{}{"tls_min_version": "2.0"}, status: "unsupported tls_min_version 2.0"},
+		{name: "tls_verify", details: map[string]interface{}{"tls_verify": "sometimes"}, status: "unsupported tls_verify sometimes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crs := runHTTPTLSCheck(t, ts, "127.0.0.1", tt.details)
+
+			assert.False(t, crs.Available)
+			assert.Equal(t, tt.status, crs.Status)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultHTTPTransactionExpectedCode accepts the success and redirection status codes
+	defaultHTTPTransactionExpectedCode = "[23].."
+)
+
+var (
+	// ErrHTTPTransactionNoSteps indicates the check details did not include any steps
+	ErrHTTPTransactionNoSteps = errors.New("no steps")
+
+	httpTransactionVariable = regexp.MustCompile(`\$\{(\w+)\}`)
+)
+
+// HTTPTransactionCheck conveys HTTP transaction checks, which perform a sequence of requests sharing cookies, where
+// each step is reported as a result dimensioned by step number
+type HTTPTransactionCheck struct {
+	Base
+	protocheck.HTTPTransactionCheckDetails
+}
+
+// NewHTTPTransactionCheck - Constructor for an HTTP transaction Check
+func NewHTTPTransactionCheck(base *Base) (Check, error) {
+	check := &HTTPTransactionCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_http_transaction",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// targetCookieJar keys cookies by the host given in the URL of a step, rather than the target IP its requests are
+// actually sent to
+type targetCookieJar struct {
+	jar  http.CookieJar
+	host string
+}
+
+func (j *targetCookieJar) hostURL(u *url.URL) *url.URL {
+	hostURL := *u
+	hostURL.Host = j.host
+	return &hostURL
+}
+
+func (j *targetCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(j.hostURL(u), cookies)
+}
+
+func (j *targetCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(j.hostURL(u))
+}
+
+// httpTransactionCaptures holds the values captured by the steps performed so far
+type httpTransactionCaptures map[string]string
+
+// substitute replaces each ${name} within s by the value captured as name
+func (c httpTransactionCaptures) substitute(s string) (string, error) {
+	var undefined string
+	substituted := httpTransactionVariable.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		value, ok := c[name]
+		if !ok && undefined == "" {
+			undefined = name
+		}
+		return value
+	})
+	if undefined != "" {
+		return "", fmt.Errorf("undefined capture %s", undefined)
+	}
+	return substituted, nil
+}
+
+// capture locates the value described by capture within body, reporting false when it is not present
+func (c httpTransactionCaptures) capture(body []byte, capture protocheck.HTTPTransactionCapture) (string, bool, error) {
+	switch {
+	case capture.JSONPath != "":
+		path, err := utils.CompileJSONPath(capture.JSONPath)
+		if err != nil {
+			return "", false, err
+		}
+		doc, err := utils.DecodeJSON(body)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid JSON: %v", err)
+		}
+		value, ok := path.Evaluate(doc)
+		if !ok || value == nil {
+			return "", false, nil
+		}
+		if s, ok := value.(string); ok {
+			return s, true, nil
+		}
+		encoded, _ := json.Marshal(value)
+		return string(encoded), true, nil
+	case capture.Regex != "":
+		re, err := regexp.Compile(capture.Regex)
+		if err != nil {
+			return "", false, err
+		}
+		m := re.FindSubmatch(body)
+		if m == nil {
+			return "", false, nil
+		}
+		if len(m) > 1 {
+			return string(m[1]), true, nil
+		}
+		return string(m[0]), true, nil
+	}
+	return "", false, errors.New("capture requires a regex or json_path")
+}
+
+// httpTransactionDimension names the dimension of a step's metrics
+func httpTransactionDimension(index int) string {
+	return fmt.Sprintf("step_%d", index+1)
+}
+
+// httpTransactionLabel identifies a step within the status, by name when it has one
+func httpTransactionLabel(index int, step protocheck.HTTPTransactionStep) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return strconv.Itoa(index + 1)
+}
+
+// runStep performs a single step, adding its metrics to cr and its captures to captures. The error returned
+// describes why the step failed, which includes the response not satisfying the assertions of the step.
+func (ch *HTTPTransactionCheck) runStep(ctx context.Context, jar http.CookieJar, captures httpTransactionCaptures,
+	step protocheck.HTTPTransactionStep, cr *Result) (*TLSMetrics, error) {
+	starttime := utils.NowTimestampMillis()
+
+	// Substitute Captures
+	rawURL, err := captures.substitute(step.Url)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(step.Headers))
+	for key, value := range step.Headers {
+		if headers[key], err = captures.substitute(value); err != nil {
+			return nil, err
+		}
+	}
+	requestBody, err := captures.substitute(step.RequestBody)
+	if err != nil {
+		return nil, err
+	}
+	form := make(map[string]string, len(step.Form))
+	for key, value := range step.Form {
+		if form[key], err = captures.substitute(value); err != nil {
+			return nil, err
+		}
+	}
+	body, err := newHTTPRequestBody(requestBody, step.Base64Body, form)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedCode := step.ExpectedCode
+	if expectedCode == "" {
+		expectedCode = defaultHTTPTransactionExpectedCode
+	}
+	codeRegexp, err := regexp.Compile("^(?:" + expectedCode + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse URL and Replace Host with IP
+	parsed, host, err := ch.targetURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	url := parsed.String()
+
+	tlsConfig, err := ch.newTLSConfig(ch.Details.TLSDetails, host)
+	if err != nil {
+		return nil, err
+	}
+	netClient := ch.newHTTPClient(tlsConfig, step.FollowRedirects)
+	netClient.Jar = &targetCookieJar{jar: jar, host: host}
+
+	method := strings.ToUpper(step.Method)
+
+	log.WithFields(log.Fields{
+		"prefix": ch.GetLogPrefix(),
+		"step":   step.Name,
+		"method": method,
+		"url":    url,
+	}).Debug("Running step")
+
+	// Setup Request
+	req, timings, err := newHTTPRequest(ctx, cr, starttime, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if step.FollowRedirects {
+		netClient.CheckRedirect = timings.followRedirect
+	}
+	addHTTPHeaders(req, host, headers)
+	setHTTPContentType(req, step.ContentType, len(form) > 0)
+
+	// Perform Request
+	resp, err := netClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read Body
+	respBody, err := ch.readLimit(resp.Body, MaxHTTPResponseBodyLength)
+	if err != nil {
+		return nil, err
+	}
+	endtime := utils.NowTimestampMillis()
+
+	timings.finish(resp.StatusCode).addPhaseMetrics(cr, "")
+	addHTTPResponseMetrics(cr, resp, respBody, endtime-starttime)
+
+	// TLS
+	var tlsMetrics *TLSMetrics
+	if resp.TLS != nil {
+		tlsMetrics = ch.AddTLSMetrics(cr, *resp.TLS)
+	}
+
+	// Assertions
+	matched, err := addHTTPBodyMetrics(cr, respBody, step.Body, nil)
+	if err != nil {
+		return tlsMetrics, err
+	}
+	failedAssertions, err := addHTTPJSONPathMetrics(cr, respBody, step.JSONPaths)
+	if err != nil {
+		return tlsMetrics, err
+	}
+	if !codeRegexp.MatchString(strconv.Itoa(resp.StatusCode)) {
+		return tlsMetrics, fmt.Errorf("unexpected code %d", resp.StatusCode)
+	}
+	if !matched {
+		return tlsMetrics, errors.New("body did not match")
+	}
+	if len(failedAssertions) > 0 {
+		return tlsMetrics, fmt.Errorf("assertion failed: %s", strings.Join(failedAssertions, ", "))
+	}
+
+	// Captures
+	for name, capture := range step.Captures {
+		value, ok, err := captures.capture(respBody, capture)
+		if err != nil {
+			return tlsMetrics, err
+		}
+		if !ok {
+			return tlsMetrics, fmt.Errorf("capture %s not found", name)
+		}
+		captures[name] = value
+	}
+
+	return tlsMetrics, nil
+}
+
+// Run method implements Check.Run method for HTTP transactions
+// please see Check interface for more information
+func (ch *HTTPTransactionCheck) Run() (*ResultSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ch.GetTimeoutDuration())
+	defer cancel()
+
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	log.WithFields(log.Fields{
+		"prefix": ch.GetLogPrefix(),
+		"steps":  len(ch.Details.Steps),
+	}).Info("Running check")
+
+	if len(ch.Details.Steps) == 0 {
+		crs.SetStatus(ErrHTTPTransactionNoSteps.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// the jar is shared by all steps, but only lasts for a single run
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	captures := make(httpTransactionCaptures)
+
+	for i, step := range ch.Details.Steps {
+		stepResult := NewResult()
+		tlsMetrics, err := ch.runStep(ctx, jar, captures, step, stepResult)
+		if tlsMetrics != nil && !tlsMetrics.Verified {
+			sl.AddOption("sslerror")
+		}
+		if len(stepResult.Metrics) > 0 {
+			dimension := httpTransactionDimension(i)
+			for _, m := range stepResult.Metrics {
+				m.Dimension = dimension
+			}
+			crs.Add(stepResult)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"prefix": ch.GetLogPrefix(),
+				"step":   i + 1,
+				"err":    err,
+			}).Debug("Step failed")
+
+			cr.AddMetric(metric.NewMetric("steps", "", metric.MetricNumber, i, ""))
+			cr.AddMetric(metric.NewMetric("failed_step", "", metric.MetricNumber, i+1, ""))
+			cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+			crs.SetStatus(fmt.Sprintf("step %s failed: %v", httpTransactionLabel(i, step), err))
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+	endtime := utils.NowTimestampMillis()
+
+	cr.AddMetric(metric.NewMetric("steps", "", metric.MetricNumber, len(ch.Details.Steps), ""))
+	cr.AddMetric(metric.NewMetric("failed_step", "", metric.MetricNumber, 0, ""))
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("steps", len(ch.Details.Steps))
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,152 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shopHandler requires a login, which sets a session cookie and provides a CSRF token to send with later requests
+func shopHandler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "shop.example.com", r.Host)
+		if r.PostFormValue("user") != "alice" || r.PostFormValue("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s-42", Path: "/"})
+		fmt.Fprint(w, `<form><input type="hidden" name="csrf" value="c-7"></form>`)
+	})
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s-42" || r.Header.Get("X-CSRF-Token") != "c-7" {
+			w.WriteHeader(http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/api/orders", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			fmt.Fprint(w, `{"orders":[{"id":"o-1"},{"id":"o-2"}]}`)
+		}
+	})
+	mux.HandleFunc("/api/orders/o-2", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			fmt.Fprint(w, `{"id":"o-2","status":"shipped"}`)
+		}
+	})
+	return mux
+}
+
+const shopSteps = `[
+	{"name":"login","method":"post","url":"http://shop.example.com:%[1]d/login",
+	 "headers":{"Content-Type":"application/x-www-form-urlencoded"},"request_body":"user=alice&password=%[2]s",
+	 "body":"csrf","captures":{"csrf":{"regex":"name=\"csrf\" value=\"([^\"]+)\""}}},
+	{"name":"orders","url":"http://shop.example.com:%[1]d/api/orders","headers":{"X-CSRF-Token":"${csrf}"},
+	 "json_paths":{"count":"$.orders.#"},"captures":{"order":{"json_path":"$.orders[-1].id"}}},
+	{"name":"order","url":"http://shop.example.com:%[1]d/api/orders/${order}","headers":{"X-CSRF-Token":"${csrf}"},
+	 "expected_code":"200","json_paths":{"shipped":"$.status == '%[3]s'"}}
+]`
+
+func shopServer(t *testing.T) (*httptest.Server, int) {
+	server := httptest.NewServer(shopHandler(t))
+	return server, server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestHTTPTransactionCheck_Success(t *testing.T) {
+	server, port := shopServer(t)
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.http_transaction", fmt.Sprintf(`{"steps":%s}`,
+		fmt.Sprintf(shopSteps, port, "secret", "shipped")))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "steps=3")
+	require.Equal(t, 4, crs.Length())
+	assert.Equal(t, 3, crs.Get(0).GetMetric("steps").Value)
+	assert.Equal(t, 0, crs.Get(0).GetMetric("failed_step").Value)
+
+	for i := 1; i <= 3; i++ {
+		step := crs.Get(i)
+		ValidateMetrics(t, []string{"code", "duration", "bytes", "tt_connect", "tt_firstbyte"}, step)
+		assert.Equal(t, "200", step.GetMetric("code").Value)
+		assert.Equal(t, fmt.Sprintf("step_%d", i), step.GetMetric("duration").Dimension)
+	}
+	assert.Equal(t, int64(2), crs.Get(2).GetMetric("count").Value)
+	assert.Equal(t, true, crs.Get(3).GetMetric("shipped").Value)
+}
+
+func TestHTTPTransactionCheck_AssertionFailed(t *testing.T) {
+	server, port := shopServer(t)
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.http_transaction", fmt.Sprintf(`{"steps":%s}`,
+		fmt.Sprintf(shopSteps, port, "secret", "delivered")))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "step order failed: assertion failed: shipped", crs.Status)
+	assert.Equal(t, 4, crs.Length())
+	assert.Equal(t, 2, crs.Get(0).GetMetric("steps").Value)
+	assert.Equal(t, 3, crs.Get(0).GetMetric("failed_step").Value)
+	assert.Equal(t, false, crs.Get(3).GetMetric("shipped").Value)
+}
+
+func TestHTTPTransactionCheck_UnexpectedCode(t *testing.T) {
+	server, port := shopServer(t)
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.http_transaction", fmt.Sprintf(`{"steps":%s}`,
+		fmt.Sprintf(shopSteps, port, "wrong", "shipped")))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "step login failed: unexpected code 401", crs.Status)
+	require.Equal(t, 2, crs.Length())
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("steps", "", metric.MetricNumber, 0, ""),
+		ExpectMetric("failed_step", "", metric.MetricNumber, 1, ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+	assert.Equal(t, "401", crs.Get(1).GetMetric("code").Value)
+}
+
+func TestHTTPTransactionCheck_UndefinedCapture(t *testing.T) {
+	server, port := shopServer(t)
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.http_transaction", fmt.Sprintf(`{"steps":%s}`,
+		fmt.Sprintf(`[{"url":"http://shop.example.com:%d/api/orders/${order}"}]`, port)))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "step 1 failed: undefined capture order", crs.Status)
+	assert.Equal(t, 1, crs.Length())
+}
+
+func TestHTTPTransactionCheck_NoSteps(t *testing.T) {
+	crs := runTestCheck(t, "remote.http_transaction", fmt.Sprintf(`{"steps":%s}`, `[]`))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, check.ErrHTTPTransactionNoSteps.Error(), crs.Status)
+}
@@ -0,0 +1,427 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ldapStartTLSOID names the StartTLS extended operation of RFC 4511
+	ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+	// ldapVersion is the protocol version sent in bind requests
+	ldapVersion = 3
+	// ldapDefaultFilter is the filter of searches that only give base_dn, which matches every entry
+	ldapDefaultFilter = "(objectClass=*)"
+	// ldapNoAttributes is the attribute selector that requests no attributes, since only entries are counted
+	ldapNoAttributes = "1.1"
+
+	// The protocol ops of LDAP messages, as defined by RFC 4511
+	ldapTagBindRequest           = utils.BERClassApplication | utils.BERConstructed | 0
+	ldapTagBindResponse          = utils.BERClassApplication | utils.BERConstructed | 1
+	ldapTagUnbindRequest         = utils.BERClassApplication | 2
+	ldapTagSearchRequest         = utils.BERClassApplication | utils.BERConstructed | 3
+	ldapTagSearchResultEntry     = utils.BERClassApplication | utils.BERConstructed | 4
+	ldapTagSearchResultDone      = utils.BERClassApplication | utils.BERConstructed | 5
+	ldapTagSearchResultReference = utils.BERClassApplication | utils.BERConstructed | 19
+	ldapTagExtendedRequest       = utils.BERClassApplication | utils.BERConstructed | 23
+	ldapTagExtendedResponse      = utils.BERClassApplication | utils.BERConstructed | 24
+	// ldapTagSimpleAuth carries the password of a simple bind
+	ldapTagSimpleAuth = utils.BERClassContext | 0
+
+	ldapResultSuccess           = 0
+	ldapResultSizeLimitExceeded = 4
+)
+
+var (
+	// DefaultLDAPPort is the port of ldap:// urls that do not give one
+	DefaultLDAPPort = "389"
+	// DefaultLDAPSPort is the port of ldaps:// urls that do not give one
+	DefaultLDAPSPort = "636"
+
+	// ErrLDAPMalformedResponse indicates an LDAP response did not have the structure of its protocol op
+	ErrLDAPMalformedResponse = errors.New("malformed LDAP response")
+	// ErrLDAPScheme indicates the url of an LDAP check is not ldap:// or ldaps://
+	ErrLDAPScheme = errors.New("url scheme must be ldap or ldaps")
+	// ErrLDAPSAndStartTLS indicates StartTLS was requested on a connection that is already TLS
+	ErrLDAPSAndStartTLS = errors.New("ldaps and starttls are mutually exclusive")
+)
+
+// ldapScopes maps the scopes of search requests, where the whole subtree is searched unless another is given
+var ldapScopes = map[string]int64{
+	"":                       2,
+	protocheck.LDAPScopeBase: 0,
+	protocheck.LDAPScopeOne:  1,
+	protocheck.LDAPScopeSub:  2,
+}
+
+// LDAPCheck conveys LDAP checks
+type LDAPCheck struct {
+	Base
+	protocheck.LDAPCheckDetails
+}
+
+// NewLDAPCheck - Constructor for an LDAP Check
+func NewLDAPCheck(base *Base) (Check, error) {
+	check := &LDAPCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_ldap",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// ldapStartTLS sends the StartTLS extended request, which is the first message of the connection
+func ldapStartTLS(conn net.Conn, serverName string) error {
+	request := utils.NewBERElement(utils.BERTagSequence,
+		utils.NewBERInteger(utils.BERTagInteger, 1),
+		utils.NewBERElement(ldapTagExtendedRequest,
+			utils.NewBERString(utils.BERClassContext|0, ldapStartTLSOID)))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	message, err := utils.ReadBERElement(conn)
+	if err != nil {
+		return err
+	}
+	code, diagnostic, err := ldapResult(message, ldapTagExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if code != ldapResultSuccess {
+		return fmt.Errorf("%v with result code %d: %s", ErrStartTLSRefused, code, diagnostic)
+	}
+	return nil
+}
+
+// ldapProtocolOp returns the protocol op of an LDAP message
+func ldapProtocolOp(message *utils.BERElement) (*utils.BERElement, error) {
+	if message.Tag != utils.BERTagSequence {
+		return nil, ErrLDAPMalformedResponse
+	}
+	children, err := message.Children()
+	if err != nil || len(children) < 2 {
+		return nil, ErrLDAPMalformedResponse
+	}
+	return children[1], nil
+}
+
+// ldapResult decodes the result code and diagnostic message of an LDAP response message, which carries the
+// protocol op given
+func ldapResult(message *utils.BERElement, op byte) (int64, string, error) {
+	protocolOp, err := ldapProtocolOp(message)
+	if err != nil || protocolOp.Tag != op {
+		return 0, "", ErrLDAPMalformedResponse
+	}
+	result, err := protocolOp.Children()
+	if err != nil || len(result) < 3 || result[0].Tag != utils.BERTagEnumerated {
+		return 0, "", ErrLDAPMalformedResponse
+	}
+	code, err := result[0].Int()
+	if err != nil {
+		return 0, "", ErrLDAPMalformedResponse
+	}
+	return code, string(result[2].Value), nil
+}
+
+// ldapConn exchanges the messages of an LDAP session
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// messageID is that of the last request, where 1 is taken by StartTLS
+	messageID int64
+}
+
+func newLDAPConn(conn net.Conn) *ldapConn {
+	return &ldapConn{conn: conn, reader: bufio.NewReader(conn), messageID: 1}
+}
+
+// send wraps the protocol op in a message with the next message ID
+func (c *ldapConn) send(protocolOp []byte) error {
+	c.messageID++
+	_, err := c.conn.Write(utils.NewBERElement(utils.BERTagSequence,
+		utils.NewBERInteger(utils.BERTagInteger, c.messageID),
+		protocolOp))
+	return err
+}
+
+// bind performs a simple bind, which is anonymous when the dn and password are empty
+func (c *ldapConn) bind(dn, password string) (int64, string, error) {
+	err := c.send(utils.NewBERElement(ldapTagBindRequest,
+		utils.NewBERInteger(utils.BERTagInteger, ldapVersion),
+		utils.NewBERString(utils.BERTagOctetString, dn),
+		utils.NewBERString(ldapTagSimpleAuth, password)))
+	if err != nil {
+		return 0, "", err
+	}
+	message, err := utils.ReadBERElement(c.reader)
+	if err != nil {
+		return 0, "", err
+	}
+	return ldapResult(message, ldapTagBindResponse)
+}
+
+// search counts the entries matched by the compiled filter, where search result references are skipped
+func (c *ldapConn) search(baseDN string, scope int64, sizeLimit uint64, timeLimit int64, filter []byte) (int, int64, string, error) {
+	err := c.send(utils.NewBERElement(ldapTagSearchRequest,
+		utils.NewBERString(utils.BERTagOctetString, baseDN),
+		utils.NewBERInteger(utils.BERTagEnumerated, scope),
+		utils.NewBERInteger(utils.BERTagEnumerated, 0),
+		utils.NewBERInteger(utils.BERTagInteger, int64(sizeLimit)),
+		utils.NewBERInteger(utils.BERTagInteger, timeLimit),
+		utils.NewBERElement(utils.BERTagBoolean, []byte{0}),
+		filter,
+		utils.NewBERElement(utils.BERTagSequence,
+			utils.NewBERString(utils.BERTagOctetString, ldapNoAttributes))))
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	entries := 0
+	for {
+		message, err := utils.ReadBERElement(c.reader)
+		if err != nil {
+			return entries, 0, "", err
+		}
+		protocolOp, err := ldapProtocolOp(message)
+		if err != nil {
+			return entries, 0, "", err
+		}
+		switch protocolOp.Tag {
+		case ldapTagSearchResultEntry:
+			entries++
+		case ldapTagSearchResultReference:
+		default:
+			code, diagnostic, err := ldapResult(message, ldapTagSearchResultDone)
+			return entries, code, diagnostic, err
+		}
+	}
+}
+
+// unbind ends the session, for which the server does not respond
+func (c *ldapConn) unbind() error {
+	return c.send(utils.NewBERElement(ldapTagUnbindRequest))
+}
+
+// withLDAPDefaultPort gives a url without a port the default port of its scheme, which targetURL would otherwise
+// take from HTTP
+func withLDAPDefaultPort(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Port() == "" {
+		switch parsed.Scheme {
+		case "ldap":
+			parsed.Host = net.JoinHostPort(parsed.Hostname(), DefaultLDAPPort)
+		case "ldaps":
+			parsed.Host = net.JoinHostPort(parsed.Hostname(), DefaultLDAPSPort)
+		}
+	}
+	return parsed.String(), nil
+}
+
+// Run method implements Check.Run method for LDAP
+// please see Check interface for more information
+func (ch *LDAPCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	// Parse URL and Replace Host with IP
+	rawURL, err := withLDAPDefaultPort(ch.Details.Url)
+	if err != nil {
+		return nil, err
+	}
+	parsed, host, err := ch.targetURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":   ch.GetLogPrefix(),
+		"url":      parsed.String(),
+		"starttls": ch.Details.StartTLS,
+	}).Info("Running check")
+
+	if parsed.Scheme != "ldap" && parsed.Scheme != "ldaps" {
+		crs.SetStatus(ErrLDAPScheme.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	ldaps := parsed.Scheme == "ldaps"
+	if ldaps && ch.Details.StartTLS {
+		crs.SetStatus(ErrLDAPSAndStartTLS.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Setup Search
+	search := ch.Details.BaseDN != "" || ch.Details.Filter != ""
+	var filter []byte
+	scope, ok := ldapScopes[ch.Details.Scope]
+	if search {
+		if !ok {
+			crs.SetStatus(fmt.Sprintf("unsupported scope %s", ch.Details.Scope))
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		filterString := ch.Details.Filter
+		if filterString == "" {
+			filterString = ldapDefaultFilter
+		}
+		if filter, err = utils.CompileLDAPFilter(filterString); err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if ldaps || ch.Details.StartTLS {
+		if tlsConfig, err = ch.newTLSConfig(ch.Details.TLSDetails, host); err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if ldaps {
+		conn, err = dialContextWithDialer(context.Background(), nd, network, parsed.Host, tlsConfig)
+	} else {
+		conn, err = dialContextWithDialer(context.Background(), nd, network, parsed.Host, nil)
+	}
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// StartTLS
+	if ch.Details.StartTLS {
+		tlsConn, err := startTLS(conn, protocheck.TCPStartTLSLDAP, tlsConfig)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		conn = tlsConn
+		cr.AddMetric(metric.NewMetric("tt_starttls", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+		sl.AddOption("starttls")
+	}
+
+	// TLS
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if metrics := ch.AddTLSMetrics(cr, tlsConn.ConnectionState()); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+	}
+
+	// Bind
+	lc := newLDAPConn(conn)
+	bindStart := utils.NowTimestampMillis()
+	code, diagnostic, err := lc.bind(ch.Details.BindDN, ch.Details.Password)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	bindTime := utils.NowTimestampMillis() - bindStart
+	cr.AddMetric(metric.NewMetric("bind_time", "", metric.MetricNumber, bindTime, metric.UnitMilliseconds))
+	if code != ldapResultSuccess {
+		cr.AddMetric(metric.NewMetric("result_code", "", metric.MetricNumber, code, ""))
+		crs.SetStatus(fmt.Sprintf("bind failed with result code %d: %s", code, diagnostic))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Search
+	entries := 0
+	if search {
+		searchStart := utils.NowTimestampMillis()
+		entries, code, diagnostic, err = lc.search(ch.Details.BaseDN, scope, ch.Details.SizeLimit,
+			int64(ch.GetTimeout()), filter)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		cr.AddMetric(metric.NewMetric("search_time", "", metric.MetricNumber, utils.NowTimestampMillis()-searchStart, metric.UnitMilliseconds))
+		cr.AddMetric(metric.NewMetric("entries", "", metric.MetricNumber, entries, ""))
+		switch code {
+		case ldapResultSuccess:
+		case ldapResultSizeLimitExceeded:
+			sl.AddOption("size_limit_exceeded")
+		default:
+			cr.AddMetric(metric.NewMetric("result_code", "", metric.MetricNumber, code, ""))
+			crs.SetStatus(fmt.Sprintf("search failed with result code %d: %s", code, diagnostic))
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+	cr.AddMetric(metric.NewMetric("result_code", "", metric.MetricNumber, code, ""))
+	lc.unbind()
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("bind_time", bindTime)
+	if search {
+		sl.Add("entries", entries)
+	}
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
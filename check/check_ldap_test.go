@@ -0,0 +1,332 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ldapTestServerName = "ldap.example.com"
+	ldapTestBindDN     = "cn=admin,dc=example,dc=com"
+	ldapTestPassword   = "secret"
+	ldapTestBaseDN     = "ou=people,dc=example,dc=com"
+	ldapTestEntries    = 3
+)
+
+// ldapTestResponse encodes a response message carrying an LDAPResult
+func ldapTestResponse(id int64, op byte, code int64, diagnostic string) []byte {
+	return utils.NewBERElement(utils.BERTagSequence,
+		utils.NewBERInteger(utils.BERTagInteger, id),
+		utils.NewBERElement(op,
+			utils.NewBERInteger(utils.BERTagEnumerated, code),
+			utils.NewBERString(utils.BERTagOctetString, ""),
+			utils.NewBERString(utils.BERTagOctetString, diagnostic)))
+}
+
+// ldapTestSearch plays a directory holding ldapTestEntries entries below ldapTestBaseDN, writing the entries
+// matched by the search request followed by its result
+func ldapTestSearch(conn net.Conn, id int64, request []*utils.BERElement) {
+	base := string(request[0].Value)
+	if base != ldapTestBaseDN {
+		conn.Write(ldapTestResponse(id, utils.BERClassApplication|utils.BERConstructed|5, 32, "No such object"))
+		return
+	}
+	scope, _ := request[1].Int()
+	sizeLimit, _ := request[3].Int()
+
+	matched := ldapTestEntries
+	if scope == 0 {
+		matched = 1
+	}
+	code := int64(0)
+	if sizeLimit > 0 && int64(matched) > sizeLimit {
+		matched = int(sizeLimit)
+		code = 4
+	}
+	for i := 0; i < matched; i++ {
+		conn.Write(utils.NewBERElement(utils.BERTagSequence,
+			utils.NewBERInteger(utils.BERTagInteger, id),
+			utils.NewBERElement(utils.BERClassApplication|utils.BERConstructed|4,
+				utils.NewBERString(utils.BERTagOctetString, fmt.Sprintf("uid=user%d,%s", i, base)),
+				utils.NewBERElement(utils.BERTagSequence))))
+	}
+	conn.Write(ldapTestResponse(id, utils.BERClassApplication|utils.BERConstructed|5, code, ""))
+}
+
+// serveLDAP plays an LDAP server for a single connection, upgrading it by StartTLS when config is given
+func serveLDAP(t *testing.T, conn net.Conn, config *tls.Config) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		message, err := utils.ReadBERElement(r)
+		if err != nil {
+			return
+		}
+		children, err := message.Children()
+		require.NoError(t, err)
+		require.Len(t, children, 2)
+		id, err := children[0].Int()
+		require.NoError(t, err)
+		op := children[1]
+		request, err := op.Children()
+		require.NoError(t, err)
+
+		switch op.Tag {
+		case utils.BERClassApplication | utils.BERConstructed | 23:
+			if config == nil {
+				conn.Write(ldapTestResponse(id, utils.BERClassApplication|utils.BERConstructed|24, 2, "StartTLS not supported"))
+				continue
+			}
+			conn.Write(ldapTestResponse(id, utils.BERClassApplication|utils.BERConstructed|24, 0, ""))
+			tlsConn := tls.Server(conn, config)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			defer tlsConn.Close()
+			conn = tlsConn
+			r = bufio.NewReader(conn)
+		case utils.BERClassApplication | utils.BERConstructed | 0:
+			require.Len(t, request, 3)
+			version, _ := request[0].Int()
+			assert.Equal(t, int64(3), version)
+			dn, password := string(request[1].Value), string(request[2].Value)
+			if dn == "" && password == "" || dn == ldapTestBindDN && password == ldapTestPassword {
+				conn.Write(ldapTestResponse(id, utils.BERClassApplication|utils.BERConstructed|1, 0, ""))
+			} else {
+				conn.Write(ldapTestResponse(id, utils.BERClassApplication|utils.BERConstructed|1, 49, "Invalid credentials"))
+			}
+		case utils.BERClassApplication | utils.BERConstructed | 3:
+			require.Len(t, request, 8)
+			ldapTestSearch(conn, id, request)
+		case utils.BERClassApplication | 2:
+			return
+		default:
+			t.Errorf("unexpected protocol op 0x%02x", op.Tag)
+			return
+		}
+	}
+}
+
+// startLDAPServer accepts connections on a local port, where tlsConfig enables ldaps and startTLSConfig enables
+// StartTLS
+func startLDAPServer(t *testing.T, tlsConfig, startTLSConfig *tls.Config) (net.Listener, int) {
+	var listener net.Listener
+	var err error
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveLDAP(t, conn, startTLSConfig)
+		}
+	}()
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+func ldapURL(scheme string, port int) string {
+	return fmt.Sprintf("%s://%s:%d", scheme, ldapTestServerName, port)
+}
+
+func TestLDAP_BindAndSearch(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":      ldapURL("ldap", port),
+		"bind_dn":  ldapTestBindDN,
+		"password": ldapTestPassword,
+		"base_dn":  ldapTestBaseDN,
+		"filter":   "(&(objectClass=person)(uid=*))",
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "entries=3")
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"tt_connect", "bind_time", "search_time", "entries", "result_code", "duration"}, cr)
+	assert.Equal(t, 3, cr.GetMetric("entries").Value)
+	assert.Equal(t, int64(0), cr.GetMetric("result_code").Value)
+	assert.Nil(t, cr.GetMetric("ssl_session_version"))
+}
+
+func TestLDAP_AnonymousBind(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{"url": ldapURL("ldap", port)})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.NotContains(t, crs.Status, "entries")
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"tt_connect", "bind_time", "result_code", "duration"}, cr)
+	assert.Nil(t, cr.GetMetric("search_time"))
+	assert.Nil(t, cr.GetMetric("entries"))
+}
+
+func TestLDAP_SearchScope(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":     ldapURL("ldap", port),
+		"base_dn": ldapTestBaseDN,
+		"scope":   "base",
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, 1, crs.Get(0).GetMetric("entries").Value)
+}
+
+func TestLDAP_SizeLimitExceeded(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":        ldapURL("ldap", port),
+		"base_dn":    ldapTestBaseDN,
+		"size_limit": 2,
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "size_limit_exceeded")
+	assert.Equal(t, 2, crs.Get(0).GetMetric("entries").Value)
+	assert.Equal(t, int64(4), crs.Get(0).GetMetric("result_code").Value)
+}
+
+func TestLDAP_InvalidCredentials(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":      ldapURL("ldap", port),
+		"bind_dn":  ldapTestBindDN,
+		"password": "wrong",
+		"base_dn":  ldapTestBaseDN,
+	})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "bind failed with result code 49: Invalid credentials", crs.Status)
+	assert.Equal(t, int64(49), crs.Get(0).GetMetric("result_code").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("search_time"))
+}
+
+func TestLDAP_NoSuchObject(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":     ldapURL("ldap", port),
+		"base_dn": "ou=missing,dc=example,dc=com",
+	})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "search failed with result code 32: No such object", crs.Status)
+	assert.Equal(t, int64(32), crs.Get(0).GetMetric("result_code").Value)
+	assert.Equal(t, 0, crs.Get(0).GetMetric("entries").Value)
+}
+
+func TestLDAP_LDAPS(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startLDAPServer(t, pki.serverConfig(t, ldapTestServerName, false), nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":     ldapURL("ldaps", port),
+		"base_dn": ldapTestBaseDN,
+		"ca_cert": string(pki.CACert),
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.NotContains(t, crs.Status, "sslerror")
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"ssl_session_version", "cert_subject"}, cr)
+	assert.Nil(t, cr.GetMetric("cert_error"))
+	assert.Nil(t, cr.GetMetric("tt_starttls"))
+	assert.Equal(t, 3, cr.GetMetric("entries").Value)
+}
+
+func TestLDAP_StartTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startLDAPServer(t, nil, pki.serverConfig(t, ldapTestServerName, false))
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{
+		"url":      ldapURL("ldap", port),
+		"bind_dn":  ldapTestBindDN,
+		"password": ldapTestPassword,
+		"base_dn":  ldapTestBaseDN,
+		"starttls": true,
+		"ca_cert":  string(pki.CACert),
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "starttls")
+	assert.NotContains(t, crs.Status, "sslerror")
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"tt_starttls", "ssl_session_version"}, cr)
+	assert.Nil(t, cr.GetMetric("cert_error"))
+	assert.Equal(t, 3, cr.GetMetric("entries").Value)
+}
+
+func TestLDAP_StartTLSRefused(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ldap", map[string]interface{}{"url": ldapURL("ldap", port), "starttls": true})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "STARTTLS refused with result code 2: StartTLS not supported", crs.Status)
+}
+
+func TestLDAP_InvalidDetails(t *testing.T) {
+	listener, port := startLDAPServer(t, nil, nil)
+	defer listener.Close()
+
+	for name, test := range map[string]struct {
+		url     string
+		details map[string]interface{}
+		status  string
+	}{
+		"scheme":   {"http://" + ldapTestServerName, map[string]interface{}{}, check.ErrLDAPScheme.Error()},
+		"starttls": {ldapURL("ldaps", port), map[string]interface{}{"starttls": true}, check.ErrLDAPSAndStartTLS.Error()},
+		"filter":   {ldapURL("ldap", port), map[string]interface{}{"filter": "(uid=x"}, `invalid filter "(uid=x": unterminated (`},
+		"scope":    {ldapURL("ldap", port), map[string]interface{}{"base_dn": ldapTestBaseDN, "scope": "all"}, "unsupported scope all"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			test.details["url"] = test.url
+			crs := runTestCheck(t, "remote.ldap", test.details)
+
+			assert.False(t, crs.Available)
+			assert.Equal(t, test.status, crs.Status)
+		})
+	}
+}
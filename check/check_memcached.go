@@ -0,0 +1,200 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMemcachedPort is the port used when the check details do not specify one
+	DefaultMemcachedPort = uint64(11211)
+	// MaxMemcachedStats bounds the number of lines read from a stats response
+	MaxMemcachedStats = 1024
+)
+
+var (
+	// DefaultMemcachedStats are the stats reported when the check details do not select any
+	DefaultMemcachedStats = []string{
+		"uptime",
+		"curr_connections",
+		"total_connections",
+		"curr_items",
+		"total_items",
+		"bytes",
+		"limit_maxbytes",
+		"evictions",
+		"cmd_get",
+		"cmd_set",
+		"get_hits",
+		"get_misses",
+	}
+
+	// ErrMemcachedMalformedStats indicates the stats response was not terminated by END
+	ErrMemcachedMalformedStats = errors.New("malformed stats response")
+)
+
+// MemcachedCheck conveys memcached checks
+type MemcachedCheck struct {
+	Base
+	protocheck.MemcachedCheckDetails
+}
+
+// NewMemcachedCheck - Constructor for a memcached Check
+func NewMemcachedCheck(base *Base) (Check, error) {
+	check := &MemcachedCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_memcached",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *MemcachedCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultMemcachedPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// readMemcachedStats reads STAT lines up to the terminating END
+func readMemcachedStats(text *textproto.Conn) (map[string]string, error) {
+	stats := make(map[string]string)
+	for i := 0; i < MaxMemcachedStats; i++ {
+		line, err := text.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case line == "END":
+			return stats, nil
+		case strings.HasPrefix(line, "STAT "):
+			fields := strings.SplitN(line, " ", 3)
+			if len(fields) == 3 {
+				stats[fields[1]] = fields[2]
+			}
+		case line == "ERROR", strings.HasPrefix(line, "CLIENT_ERROR"), strings.HasPrefix(line, "SERVER_ERROR"):
+			return nil, errors.New(line)
+		default:
+			return nil, ErrMemcachedMalformedStats
+		}
+	}
+	return nil, ErrMemcachedMalformedStats
+}
+
+// Run method implements Check.Run method for memcached
+// please see Check interface for more information
+func (ch *MemcachedCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	conn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	connectEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectEndTime-starttime, metric.UnitMilliseconds))
+
+	// Stats
+	text := textproto.NewConn(conn)
+	err = text.PrintfLine("stats")
+	var stats map[string]string
+	if err == nil {
+		stats, err = readMemcachedStats(text)
+	}
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	cr.AddMetric(metric.NewMetric("stats_time", "", metric.MetricNumber, utils.NowTimestampMillis()-connectEndTime, metric.UnitMilliseconds))
+
+	fields := ch.Details.Fields
+	if len(fields) == 0 {
+		fields = DefaultMemcachedStats
+	}
+	if version, ok := stats["version"]; ok {
+		cr.AddMetric(metric.NewMetric("version", "", metric.MetricString, version, ""))
+		sl.Add("version", version)
+	}
+	addStatMetrics(cr, stats, fields)
+
+	text.PrintfLine("quit")
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
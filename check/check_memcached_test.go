@@ -0,0 +1,89 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveMemcached handles a single session, answering stats with the given response
+func serveMemcached(listener net.Listener, response string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "stats":
+			conn.Write([]byte(response))
+		case "quit":
+			return
+		default:
+			conn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+func runMemcachedCheck(t *testing.T, response, details string) *check.ResultSet {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveMemcached(listener, response)
+
+	crs := runTestCheck(t, "remote.memcached", fmt.Sprintf(details, listener.Addr().(*net.TCPAddr).Port))
+	return crs
+}
+
+func TestMemcachedCheck_Stats(t *testing.T) {
+	crs := runMemcachedCheck(t, "STAT pid 42\r\nSTAT uptime 120\r\nSTAT version 1.6.9\r\nSTAT curr_connections 3\r\n"+
+		"STAT curr_items 250\r\nSTAT evictions 5\r\nEND\r\n", `{"port":%d}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "version=1.6.9")
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("tt_connect", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("stats_time", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("version", "", metric.MetricString, "1.6.9", ""),
+		ExpectMetric("uptime", "", metric.MetricNumber, int64(120), ""),
+		ExpectMetric("curr_connections", "", metric.MetricNumber, int64(3), ""),
+		ExpectMetric("curr_items", "", metric.MetricNumber, int64(250), ""),
+		ExpectMetric("evictions", "", metric.MetricNumber, int64(5), ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestMemcachedCheck_ServerError(t *testing.T) {
+	crs := runMemcachedCheck(t, "SERVER_ERROR out of memory\r\n", `{"port":%d}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "SERVER_ERROR out of memory", crs.Status)
+}
@@ -0,0 +1,634 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMySQLPort is the port used when the check details do not specify one
+	DefaultMySQLPort = uint64(3306)
+	// DefaultDatabaseQuery is the statement run once authenticated when the check details do not specify one
+	DefaultDatabaseQuery = "SELECT 1"
+
+	mysqlMaxPacketLength = 1<<24 - 1
+	mysqlCharsetUTF8     = 33
+
+	mysqlClientLongPassword     = 0x00000001
+	mysqlClientConnectWithDB    = 0x00000008
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSSL              = 0x00000800
+	mysqlClientTransactions     = 0x00002000
+	mysqlClientSecureConnection = 0x00008000
+	mysqlClientPluginAuth       = 0x00080000
+
+	mysqlComQuit  = 0x01
+	mysqlComQuery = 0x03
+
+	mysqlPacketOK         = 0x00
+	mysqlPacketAuthMore   = 0x01
+	mysqlPacketEOF        = 0xfe
+	mysqlPacketAuthSwitch = 0xfe
+	mysqlPacketErr        = 0xff
+
+	mysqlNativePassword      = "mysql_native_password"
+	mysqlCachingSHA2Password = "caching_sha2_password"
+
+	// caching_sha2_password status bytes sent in an AuthMoreData packet
+	mysqlFastAuthSuccess   = 3
+	mysqlPerformFullAuth   = 4
+	mysqlRequestPublicKey  = 2
+	mysqlAuthScrambleBytes = 20
+)
+
+var (
+	// ErrMySQLMalformedPacket indicates the server sent a packet that could not be decoded
+	ErrMySQLMalformedPacket = errors.New("malformed MySQL packet")
+	// ErrTLSNotSupported indicates TLS was required but the server does not offer it
+	ErrTLSNotSupported = errors.New("TLS not supported by server")
+)
+
+// MySQLCheck conveys MySQL checks
+type MySQLCheck struct {
+	Base
+	protocheck.MySQLCheckDetails
+}
+
+// NewMySQLCheck - Constructor for a MySQL Check
+func NewMySQLCheck(base *Base) (Check, error) {
+	check := &MySQLCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_mysql",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *MySQLCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultMySQLPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// mysqlError is decoded from an ERR packet
+type mysqlError struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *mysqlError) Error() string {
+	return fmt.Sprintf("Error %d (%s): %s", e.Code, e.State, e.Message)
+}
+
+func parseMySQLError(payload []byte) error {
+	if len(payload) < 3 {
+		return ErrMySQLMalformedPacket
+	}
+	e := &mysqlError{Code: binary.LittleEndian.Uint16(payload[1:])}
+	payload = payload[3:]
+	if len(payload) >= 6 && payload[0] == '#' {
+		e.State = string(payload[1:6])
+		payload = payload[6:]
+	}
+	e.Message = string(payload)
+	return e
+}
+
+// mysqlConn frames the packets of the MySQL client/server protocol
+type mysqlConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	seq    byte
+}
+
+func newMySQLConn(conn net.Conn) *mysqlConn {
+	return &mysqlConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// upgrade switches the framing over to the given connection, such as after a TLS handshake
+func (c *mysqlConn) upgrade(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+}
+
+func (c *mysqlConn) readPacket() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	c.seq = header[3] + 1
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return nil, ErrMySQLMalformedPacket
+	}
+	return payload, nil
+}
+
+func (c *mysqlConn) writePacket(payload []byte) error {
+	if len(payload) > mysqlMaxPacketLength {
+		return ErrMySQLMalformedPacket
+	}
+	packet := make([]byte, 4+len(payload))
+	packet[0] = byte(len(payload))
+	packet[1] = byte(len(payload) >> 8)
+	packet[2] = byte(len(payload) >> 16)
+	packet[3] = c.seq
+	copy(packet[4:], payload)
+	c.seq++
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// mysqlHandshake is decoded from the server's initial handshake packet
+type mysqlHandshake struct {
+	ProtocolVersion byte
+	ServerVersion   string
+	ConnectionID    uint32
+	Capabilities    uint32
+	AuthData        []byte
+	AuthPlugin      string
+}
+
+func readNullTerminated(payload []byte) (string, []byte, error) {
+	pos := bytes.IndexByte(payload, 0)
+	if pos < 0 {
+		return "", nil, ErrMySQLMalformedPacket
+	}
+	return string(payload[:pos]), payload[pos+1:], nil
+}
+
+func parseMySQLHandshake(payload []byte) (*mysqlHandshake, error) {
+	if payload[0] == mysqlPacketErr {
+		return nil, parseMySQLError(payload)
+	}
+	hs := &mysqlHandshake{ProtocolVersion: payload[0]}
+	version, rest, err := readNullTerminated(payload[1:])
+	if err != nil {
+		return nil, err
+	}
+	hs.ServerVersion = version
+	// connection id, first 8 bytes of auth data, filler, lower capability flags
+	if len(rest) < 15 {
+		return nil, ErrMySQLMalformedPacket
+	}
+	hs.ConnectionID = binary.LittleEndian.Uint32(rest)
+	hs.AuthData = append(hs.AuthData, rest[4:12]...)
+	hs.Capabilities = uint32(binary.LittleEndian.Uint16(rest[13:]))
+	rest = rest[15:]
+	// character set, status flags, upper capability flags, auth data length and 10 reserved bytes
+	if len(rest) < 16 {
+		hs.AuthPlugin = mysqlNativePassword
+		return hs, nil
+	}
+	hs.Capabilities |= uint32(binary.LittleEndian.Uint16(rest[3:])) << 16
+	authDataLength := int(rest[5])
+	rest = rest[16:]
+	if hs.Capabilities&mysqlClientSecureConnection != 0 {
+		part2Length := authDataLength - 8
+		if part2Length < 13 {
+			part2Length = 13
+		}
+		if len(rest) < part2Length {
+			return nil, ErrMySQLMalformedPacket
+		}
+		// the remainder of the auth data is NUL terminated
+		hs.AuthData = append(hs.AuthData, bytes.TrimRight(rest[:part2Length], "\x00")...)
+		rest = rest[part2Length:]
+	}
+	hs.AuthPlugin = mysqlNativePassword
+	if hs.Capabilities&mysqlClientPluginAuth != 0 && len(rest) > 0 {
+		hs.AuthPlugin = string(bytes.TrimRight(rest, "\x00"))
+	}
+	return hs, nil
+}
+
+func xorBytes(a, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i%len(b)]
+	}
+	return result
+}
+
+// scrambleMySQLPassword computes the auth response for the given plugin and server scramble
+func scrambleMySQLPassword(plugin string, scramble []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(scramble) > mysqlAuthScrambleBytes {
+		scramble = scramble[:mysqlAuthScrambleBytes]
+	}
+	switch plugin {
+	case mysqlNativePassword:
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		hash1 := sha1.Sum([]byte(password))
+		hash2 := sha1.Sum(hash1[:])
+		h := sha1.New()
+		h.Write(scramble)
+		h.Write(hash2[:])
+		return xorBytes(hash1[:], h.Sum(nil)), nil
+	case mysqlCachingSHA2Password:
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		hash1 := sha256.Sum256([]byte(password))
+		hash2 := sha256.Sum256(hash1[:])
+		h := sha256.New()
+		h.Write(hash2[:])
+		h.Write(scramble)
+		return xorBytes(hash1[:], h.Sum(nil)), nil
+	}
+	return nil, fmt.Errorf("unsupported auth plugin: %v", plugin)
+}
+
+func (ch *MySQLCheck) capabilities(tlsEnabled bool) uint32 {
+	capabilities := uint32(mysqlClientLongPassword | mysqlClientProtocol41 | mysqlClientTransactions |
+		mysqlClientSecureConnection | mysqlClientPluginAuth)
+	if ch.Details.Database != "" {
+		capabilities |= mysqlClientConnectWithDB
+	}
+	if tlsEnabled {
+		capabilities |= mysqlClientSSL
+	}
+	return capabilities
+}
+
+// sslRequest sends the truncated handshake response that asks the server to switch to TLS
+func (ch *MySQLCheck) sslRequest(mc *mysqlConn) error {
+	payload := make([]byte, 32)
+	binary.LittleEndian.PutUint32(payload, ch.capabilities(true))
+	binary.LittleEndian.PutUint32(payload[4:], mysqlMaxPacketLength)
+	payload[8] = mysqlCharsetUTF8
+	return mc.writePacket(payload)
+}
+
+func (ch *MySQLCheck) authenticate(mc *mysqlConn, hs *mysqlHandshake, tlsEnabled bool) error {
+	plugin := hs.AuthPlugin
+	scramble := hs.AuthData
+	authResponse, err := scrambleMySQLPassword(plugin, scramble, ch.Details.Password)
+	if err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	header := make([]byte, 32)
+	binary.LittleEndian.PutUint32(header, ch.capabilities(tlsEnabled))
+	binary.LittleEndian.PutUint32(header[4:], mysqlMaxPacketLength)
+	header[8] = mysqlCharsetUTF8
+	payload.Write(header)
+	payload.WriteString(ch.Details.Username)
+	payload.WriteByte(0)
+	payload.WriteByte(byte(len(authResponse)))
+	payload.Write(authResponse)
+	if ch.Details.Database != "" {
+		payload.WriteString(ch.Details.Database)
+		payload.WriteByte(0)
+	}
+	payload.WriteString(plugin)
+	payload.WriteByte(0)
+	if err := mc.writePacket(payload.Bytes()); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := mc.readPacket()
+		if err != nil {
+			return err
+		}
+		switch resp[0] {
+		case mysqlPacketOK:
+			return nil
+		case mysqlPacketErr:
+			return parseMySQLError(resp)
+		case mysqlPacketAuthSwitch:
+			name, rest, err := readNullTerminated(resp[1:])
+			if err != nil {
+				return err
+			}
+			plugin = name
+			scramble = bytes.TrimRight(rest, "\x00")
+			authResponse, err := scrambleMySQLPassword(plugin, scramble, ch.Details.Password)
+			if err != nil {
+				return err
+			}
+			if err := mc.writePacket(authResponse); err != nil {
+				return err
+			}
+		case mysqlPacketAuthMore:
+			if plugin != mysqlCachingSHA2Password || len(resp) < 2 {
+				return ErrMySQLMalformedPacket
+			}
+			switch resp[1] {
+			case mysqlFastAuthSuccess:
+				// the OK packet follows
+			case mysqlPerformFullAuth:
+				if err := ch.fullAuthentication(mc, scramble, tlsEnabled); err != nil {
+					return err
+				}
+			default:
+				return ErrMySQLMalformedPacket
+			}
+		default:
+			return ErrMySQLMalformedPacket
+		}
+	}
+}
+
+// fullAuthentication sends the password for caching_sha2_password, which is only done in the clear over TLS and is
+// otherwise encrypted with the server's RSA public key
+func (ch *MySQLCheck) fullAuthentication(mc *mysqlConn, scramble []byte, tlsEnabled bool) error {
+	password := append([]byte(ch.Details.Password), 0)
+	if tlsEnabled {
+		return mc.writePacket(password)
+	}
+
+	if err := mc.writePacket([]byte{mysqlRequestPublicKey}); err != nil {
+		return err
+	}
+	resp, err := mc.readPacket()
+	if err != nil {
+		return err
+	}
+	if resp[0] == mysqlPacketErr {
+		return parseMySQLError(resp)
+	}
+	block, _ := pem.Decode(resp[1:])
+	if block == nil {
+		return ErrMySQLMalformedPacket
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return ErrMySQLMalformedPacket
+	}
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, xorBytes(password, scramble), nil)
+	if err != nil {
+		return err
+	}
+	return mc.writePacket(encrypted)
+}
+
+// readMySQLLengthEncodedInt decodes a length-encoded integer, returning the value and the bytes consumed
+func readMySQLLengthEncodedInt(payload []byte) (uint64, int) {
+	switch payload[0] {
+	case 0xfc:
+		if len(payload) >= 3 {
+			return uint64(binary.LittleEndian.Uint16(payload[1:])), 3
+		}
+	case 0xfd:
+		if len(payload) >= 4 {
+			return uint64(payload[1]) | uint64(payload[2])<<8 | uint64(payload[3])<<16, 4
+		}
+	case 0xfe:
+		if len(payload) >= 9 {
+			return binary.LittleEndian.Uint64(payload[1:]), 9
+		}
+	default:
+		return uint64(payload[0]), 1
+	}
+	return 0, 0
+}
+
+// query runs the statement as a text protocol query and returns the number of rows in the result set
+func (ch *MySQLCheck) query(mc *mysqlConn, statement string) (int, error) {
+	mc.seq = 0
+	if err := mc.writePacket(append([]byte{mysqlComQuery}, statement...)); err != nil {
+		return 0, err
+	}
+	resp, err := mc.readPacket()
+	if err != nil {
+		return 0, err
+	}
+	switch resp[0] {
+	case mysqlPacketOK:
+		return 0, nil
+	case mysqlPacketErr:
+		return 0, parseMySQLError(resp)
+	}
+
+	columns, n := readMySQLLengthEncodedInt(resp)
+	if n == 0 {
+		return 0, ErrMySQLMalformedPacket
+	}
+	// column definitions are terminated by an EOF packet, as are the rows that follow
+	for i := uint64(0); i <= columns; i++ {
+		if _, err := mc.readPacket(); err != nil {
+			return 0, err
+		}
+	}
+	rows := 0
+	for {
+		resp, err := mc.readPacket()
+		if err != nil {
+			return rows, err
+		}
+		switch {
+		case resp[0] == mysqlPacketEOF && len(resp) < 9:
+			return rows, nil
+		case resp[0] == mysqlPacketErr:
+			return rows, parseMySQLError(resp)
+		}
+		rows++
+	}
+}
+
+// Run method implements Check.Run method for MySQL
+// please see Check interface for more information
+func (ch *MySQLCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if ch.TargetHostname != nil && *ch.TargetHostname != "" {
+		host = *ch.TargetHostname
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+		"ssl":     ch.Details.UseSSL,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	conn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	connectEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectEndTime-starttime, metric.UnitMilliseconds))
+
+	// Initial Handshake
+	mc := newMySQLConn(conn)
+	payload, err := mc.readPacket()
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	hs, err := parseMySQLHandshake(payload)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	handshakeEndTime := utils.NowTimestampMillis()
+	tlsSupported := hs.Capabilities&mysqlClientSSL != 0
+	cr.AddMetric(metric.NewMetric("handshake_time", "", metric.MetricNumber, handshakeEndTime-connectEndTime, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("server_version", "", metric.MetricString, hs.ServerVersion, ""))
+	cr.AddMetric(metric.NewMetric("protocol_version", "", metric.MetricNumber, int64(hs.ProtocolVersion), ""))
+	cr.AddMetric(metric.NewMetric("tls_supported", "", metric.MetricBool, tlsSupported, ""))
+
+	// TLS
+	if ch.Details.UseSSL && !tlsSupported {
+		crs.SetStatus(ErrTLSNotSupported.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	if tlsSupported {
+		if err := ch.sslRequest(mc); err != nil {
+			crs.SetStatusFromError(err)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			crs.SetStatusFromError(err)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		defer tlsConn.Close()
+		mc.upgrade(tlsConn)
+		sl.AddOption("ssl")
+		if metrics := ch.AddTLSMetrics(cr, tlsConn.ConnectionState()); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+	}
+
+	// Authentication and Query
+	authStartTime := utils.NowTimestampMillis()
+	authErr := ch.authenticate(mc, hs, tlsSupported)
+	if ch.Details.Username == "" {
+		// Without a username the handshake is still completed, as the anonymous user, since the server blocks a
+		// host whose connections repeatedly end mid-handshake once max_connect_errors is reached. The anonymous
+		// user being refused is an authentication error, which does not count towards that limit.
+		if _, refused := authErr.(*mysqlError); authErr != nil && !refused {
+			crs.SetStatusFromError(authErr)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	} else {
+		if authErr != nil {
+			crs.SetStatus(authErr.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		authEndTime := utils.NowTimestampMillis()
+		cr.AddMetric(metric.NewMetric("auth_time", "", metric.MetricNumber, authEndTime-authStartTime, metric.UnitMilliseconds))
+
+		statement := ch.Details.Query
+		if statement == "" {
+			statement = DefaultDatabaseQuery
+		}
+		rows, err := ch.query(mc, statement)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		cr.AddMetric(metric.NewMetric("query_time", "", metric.MetricNumber, utils.NowTimestampMillis()-authEndTime, metric.UnitMilliseconds))
+		cr.AddMetric(metric.NewMetric("rows", "", metric.MetricNumber, rows, ""))
+	}
+	if authErr == nil {
+		mc.seq = 0
+		mc.writePacket([]byte{mysqlComQuit})
+	}
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("version", hs.ServerVersion)
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
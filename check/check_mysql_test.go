@@ -0,0 +1,209 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mysqlTestScramble = "abcdefghijklmnopqrst"
+	mysqlTestPassword = "secret"
+)
+
+// mysqlTestServer handles a single session, authenticating with mysql_native_password and answering any query
+// with a single column result of two rows
+type mysqlTestServer struct {
+	conn net.Conn
+	seq  byte
+	tls  bool
+	// user is that of the handshake response, which is nil when the client did not complete the handshake
+	user []byte
+}
+
+func (s *mysqlTestServer) read() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return nil, err
+	}
+	s.seq = header[3] + 1
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(s.conn, payload)
+	return payload, err
+}
+
+func (s *mysqlTestServer) write(payload []byte) {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), s.seq}
+	s.seq++
+	s.conn.Write(append(header, payload...))
+}
+
+func (s *mysqlTestServer) handshake() {
+	capabilities := uint32(0x00000200 | 0x00008000 | 0x00080000)
+	if s.tls {
+		capabilities |= 0x00000800
+	}
+	var payload bytes.Buffer
+	payload.WriteByte(10)
+	payload.WriteString("8.0.34-test\x00")
+	payload.Write([]byte{7, 0, 0, 0})
+	payload.WriteString(mysqlTestScramble[:8])
+	payload.WriteByte(0)
+	payload.Write([]byte{byte(capabilities), byte(capabilities >> 8), 33, 2, 0})
+	payload.Write([]byte{byte(capabilities >> 16), byte(capabilities >> 24), 21})
+	payload.Write(make([]byte, 10))
+	payload.WriteString(mysqlTestScramble[8:] + "\x00")
+	payload.WriteString("mysql_native_password\x00")
+	s.write(payload.Bytes())
+}
+
+func (s *mysqlTestServer) expectedAuthResponse() []byte {
+	hash1 := sha1.Sum([]byte(mysqlTestPassword))
+	hash2 := sha1.Sum(hash1[:])
+	h := sha1.Sum(append([]byte(mysqlTestScramble), hash2[:]...))
+	for i := range h {
+		h[i] ^= hash1[i]
+	}
+	return h[:]
+}
+
+func (s *mysqlTestServer) serve(t *testing.T) {
+	defer s.conn.Close()
+	s.handshake()
+
+	response, err := s.read()
+	if err != nil {
+		return
+	}
+	if s.tls && len(response) == 32 {
+		cert, err := tls.X509KeyPair(utils.LocalhostCert, utils.LocalhostKey)
+		require.NoError(t, err)
+		tlsConn := tls.Server(s.conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		s.conn = tlsConn
+		if response, err = s.read(); err != nil {
+			return
+		}
+	}
+
+	// capabilities, max packet size, charset and filler precede the user name
+	rest := response[32:]
+	user := rest[:bytes.IndexByte(rest, 0)]
+	s.user = user
+	rest = rest[len(user)+1:]
+	authResponse := rest[1 : 1+int(rest[0])]
+	if string(user) != "monitor" || !bytes.Equal(authResponse, s.expectedAuthResponse()) {
+		s.write([]byte("\xff\x15\x04#28000Access denied for user"))
+		return
+	}
+	s.write([]byte{0, 0, 0, 2, 0, 0, 0})
+
+	for {
+		command, err := s.read()
+		if err != nil || command[0] == 0x01 {
+			return
+		}
+		s.write([]byte{1})
+		s.write([]byte("\x03def\x00\x00\x00\x011\x00\x0c\x3f\x00\x01\x00\x00\x00\x08\x81\x00\x00\x00\x00"))
+		s.write([]byte{0xfe, 0, 0, 2, 0})
+		s.write([]byte{1, '1'})
+		s.write([]byte{1, '2'})
+		s.write([]byte{0xfe, 0, 0, 2, 0})
+	}
+}
+
+func runMySQLCheck(t *testing.T, withTLS bool, details string) *check.ResultSet {
+	crs, _ := runMySQLCheckWithServer(t, withTLS, details)
+	return crs
+}
+
+// runMySQLCheckWithServer also returns the server once its session has ended
+func runMySQLCheckWithServer(t *testing.T, withTLS bool, details string) (*check.ResultSet, *mysqlTestServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	server := &mysqlTestServer{tls: withTLS}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server.conn = conn
+		server.serve(t)
+	}()
+
+	crs := runTestCheck(t, "remote.mysql", fmt.Sprintf(details, listener.Addr().(*net.TCPAddr).Port))
+	<-done
+	return crs, server
+}
+
+func TestMySQLCheck_Handshake(t *testing.T) {
+	crs, server := runMySQLCheckWithServer(t, false, `{"port":%d}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	// the handshake is completed as the anonymous user, rather than abandoned
+	assert.NotNil(t, server.user)
+	assert.Empty(t, server.user)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("tt_connect", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("handshake_time", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("server_version", "", metric.MetricString, "8.0.34-test", ""),
+		ExpectMetric("protocol_version", "", metric.MetricNumber, int64(10), ""),
+		ExpectMetric("tls_supported", "", metric.MetricBool, false, ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestMySQLCheck_Query(t *testing.T) {
+	crs := runMySQLCheck(t, true, `{"port":%d,"username":"monitor","password":"secret","query":"SELECT id FROM t"}`)
+
+	assert.True(t, crs.Available)
+	assert.Contains(t, crs.Status, "ssl")
+	ValidateMetrics(t, []string{"auth_time", "query_time", "cert_issuer", "ssl_session_version"}, crs.Get(0))
+	assert.Equal(t, 2, crs.Get(0).GetMetric("rows").Value)
+	assert.Equal(t, true, crs.Get(0).GetMetric("tls_supported").Value)
+}
+
+func TestMySQLCheck_AccessDenied(t *testing.T) {
+	crs := runMySQLCheck(t, false, `{"port":%d,"username":"monitor","password":"wrong"}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "Error 1045 (28000): Access denied for user", crs.Status)
+	assert.Nil(t, crs.Get(0).GetMetric("auth_time"))
+}
+
+func TestMySQLCheck_TLSRequired(t *testing.T) {
+	crs := runMySQLCheck(t, false, `{"port":%d,"ssl":true}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "TLS not supported by server", crs.Status)
+}
@@ -0,0 +1,246 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultNTPPort is the port used when the check details do not specify one
+	DefaultNTPPort = uint64(123)
+	// NTPPacketLength is the length of an NTP header without extension fields or authenticator
+	NTPPacketLength = 48
+
+	// replies carrying extension fields or an authenticator are longer, but only the header is consulted
+	ntpReceiveBufferSize = 1024
+
+	ntpVersion    = 4
+	ntpModeClient = 3
+	ntpModeServer = 4
+	// ntpLeapAlarm indicates the server's clock is not synchronized
+	ntpLeapAlarm = 3
+
+	// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and the Unix epoch (1970)
+	ntpEpochOffset = 2208988800
+)
+
+// ErrNTPInvalidResponse indicates the datagram received was not a server reply to our request
+var ErrNTPInvalidResponse = errors.New("invalid NTP response")
+
+// NTPCheck conveys NTP checks
+type NTPCheck struct {
+	Base
+	protocheck.NTPCheckDetails
+}
+
+// NewNTPCheck - Constructor for an NTP Check
+func NewNTPCheck(base *Base) (Check, error) {
+	check := &NTPCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_ntp",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *NTPCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultNTPPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// toNTPTime converts to the 64-bit NTP timestamp format of 32 bits of seconds and 32 bits of fraction
+func toNTPTime(t time.Time) uint64 {
+	nanos := uint64(t.UnixNano()) + ntpEpochOffset*uint64(time.Second)
+	seconds := nanos / uint64(time.Second)
+	fraction := ((nanos % uint64(time.Second)) << 32) / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// fromNTPTime converts from the 64-bit NTP timestamp format
+func fromNTPTime(t uint64) time.Time {
+	seconds := int64(t>>32) - ntpEpochOffset
+	nanos := int64(((t & 0xffffffff) * uint64(time.Second)) >> 32)
+	return time.Unix(seconds, nanos)
+}
+
+// fromNTPShort converts from the 32-bit NTP short format of 16 bits of seconds and 16 bits of fraction
+func fromNTPShort(s uint32) time.Duration {
+	return time.Duration((uint64(s) * uint64(time.Second)) >> 16)
+}
+
+// formatNTPReferenceID renders the reference ID as the four character code used by stratum 0 (kiss codes)
+// and stratum 1 (reference clocks) servers, or otherwise as the IPv4 address of the upstream server
+func formatNTPReferenceID(stratum uint8, refID []byte) string {
+	if stratum <= 1 {
+		return strings.TrimRight(string(refID), "\x00")
+	}
+	return net.IP(refID).String()
+}
+
+// ntpResponse holds the fields of interest of a server reply
+type ntpResponse struct {
+	Leap           uint8
+	Version        uint8
+	Stratum        uint8
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+	ReferenceID    string
+	Offset         time.Duration
+	Delay          time.Duration
+}
+
+func (ch *NTPCheck) query(network, addr string, timeout time.Duration) (*ntpResponse, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := make([]byte, NTPPacketLength)
+	req[0] = ntpVersion<<3 | ntpModeClient
+	originate := toNTPTime(time.Now())
+	binary.BigEndian.PutUint64(req[40:], originate)
+	t1 := fromNTPTime(originate)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, ntpReceiveBufferSize)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+		t4 := time.Now()
+		// the server echoes our transmit timestamp as its originate timestamp, anything else is stray
+		if n < NTPPacketLength || binary.BigEndian.Uint64(resp[24:]) != originate {
+			continue
+		}
+		if resp[0]&0x7 != ntpModeServer {
+			return nil, ErrNTPInvalidResponse
+		}
+
+		t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+		t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+		stratum := resp[1]
+		return &ntpResponse{
+			Leap:           resp[0] >> 6,
+			Version:        (resp[0] >> 3) & 0x7,
+			Stratum:        stratum,
+			RootDelay:      fromNTPShort(binary.BigEndian.Uint32(resp[4:])),
+			RootDispersion: fromNTPShort(binary.BigEndian.Uint32(resp[8:])),
+			ReferenceID:    formatNTPReferenceID(stratum, resp[12:16]),
+			Offset:         (t2.Sub(t1) + t3.Sub(t4)) / 2,
+			Delay:          t4.Sub(t1) - t3.Sub(t2),
+		}, nil
+	}
+}
+
+// Run method implements Check.Run method for NTP
+// please see Check interface for more information
+func (ch *NTPCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+	}).Info("Running check")
+
+	// Setup Network
+	network := "udp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "udp4"
+	case protocheck.ResolverIPV6:
+		network = "udp6"
+	}
+
+	resp, err := ch.query(network, addr, ch.GetTimeoutDuration())
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	offset := utils.ScaleFractionalDuration(resp.Offset, time.Second)
+	cr.AddMetric(metric.NewMetric("offset", "", metric.MetricFloat, offset, metric.UnitSeconds))
+	cr.AddMetric(metric.NewMetric("delay", "", metric.MetricFloat, utils.ScaleFractionalDuration(resp.Delay, time.Second), metric.UnitSeconds))
+	cr.AddMetric(metric.NewMetric("stratum", "", metric.MetricNumber, int64(resp.Stratum), ""))
+	cr.AddMetric(metric.NewMetric("reference_id", "", metric.MetricString, resp.ReferenceID, ""))
+	cr.AddMetric(metric.NewMetric("leap_indicator", "", metric.MetricNumber, int64(resp.Leap), ""))
+	cr.AddMetric(metric.NewMetric("version", "", metric.MetricNumber, int64(resp.Version), ""))
+	cr.AddMetric(metric.NewMetric("root_delay", "", metric.MetricFloat, utils.ScaleFractionalDuration(resp.RootDelay, time.Second), metric.UnitSeconds))
+	cr.AddMetric(metric.NewMetric("root_dispersion", "", metric.MetricFloat, utils.ScaleFractionalDuration(resp.RootDispersion, time.Second), metric.UnitSeconds))
+
+	// Status Line
+	sl.Add("stratum", resp.Stratum)
+	sl.Add("offset", offset)
+
+	switch {
+	case resp.Stratum == 0:
+		// a kiss-o'-death packet, where the reference ID carries the reason such as RATE or DENY
+		crs.SetStatus(fmt.Sprintf("kiss code %v", resp.ReferenceID))
+		crs.SetStateUnavailable()
+	case resp.Leap == ntpLeapAlarm:
+		crs.SetStatus("server clock not synchronized")
+		crs.SetStateUnavailable()
+	case ch.Details.MaxOffset > 0 && math.Abs(offset) > ch.Details.MaxOffset:
+		sl.AddOption("offset_exceeded")
+		crs.SetStatus(sl.String())
+		crs.SetStateUnavailable()
+	default:
+		crs.SetStatus(sl.String())
+		crs.SetStateAvailable()
+	}
+	return crs, nil
+}
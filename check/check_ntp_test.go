@@ -0,0 +1,112 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ntpTestTime encodes t in the NTP timestamp format
+func ntpTestTime(t time.Time) uint64 {
+	nanos := uint64(t.UnixNano()) + 2208988800*uint64(time.Second)
+	return (nanos/uint64(time.Second))<<32 | ((nanos%uint64(time.Second))<<32)/uint64(time.Second)
+}
+
+// serveNTP answers a single request as a server whose clock is skewed by the given amount
+func serveNTP(conn net.PacketConn, skew time.Duration, leap byte, stratum byte, refID []byte) {
+	buffer := make([]byte, 48)
+	n, addr, err := conn.ReadFrom(buffer)
+	if err != nil || n < 48 {
+		return
+	}
+	received := time.Now().Add(skew)
+
+	resp := make([]byte, 48)
+	resp[0] = leap<<6 | 4<<3 | 4
+	resp[1] = stratum
+	// root delay of 0.5s and root dispersion of 0.25s
+	binary.BigEndian.PutUint32(resp[4:], 0x8000)
+	binary.BigEndian.PutUint32(resp[8:], 0x4000)
+	copy(resp[12:16], refID)
+	copy(resp[24:32], buffer[40:48])
+	binary.BigEndian.PutUint64(resp[32:], ntpTestTime(received))
+	binary.BigEndian.PutUint64(resp[40:], ntpTestTime(time.Now().Add(skew)))
+	conn.WriteTo(resp, addr)
+}
+
+func runNTPCheck(t *testing.T, maxOffset float64, skew time.Duration, leap byte, stratum byte, refID []byte) *check.ResultSet {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveNTP(conn, skew, leap, stratum, refID)
+
+	return runTestCheck(t, "remote.ntp", map[string]interface{}{
+		"port":       conn.LocalAddr().(*net.UDPAddr).Port,
+		"max_offset": maxOffset,
+	})
+}
+
+func TestNTPCheck_Success(t *testing.T) {
+	crs := runNTPCheck(t, 5, 2*time.Second, 0, 1, []byte("GPS"))
+
+	require.True(t, crs.Available, crs.Status)
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"delay", "version"}, cr)
+
+	offset, err := cr.GetMetric("offset").ToFloat64()
+	require.NoError(t, err)
+	assert.InDelta(t, 2.0, offset, 0.1)
+	assert.Equal(t, int64(1), cr.GetMetric("stratum").Value)
+	assert.Equal(t, int64(0), cr.GetMetric("leap_indicator").Value)
+	assert.Equal(t, "GPS", cr.GetMetric("reference_id").Value)
+	assert.Equal(t, 0.5, cr.GetMetric("root_delay").Value)
+	assert.Equal(t, 0.25, cr.GetMetric("root_dispersion").Value)
+}
+
+func TestNTPCheck_ReferenceAddress(t *testing.T) {
+	crs := runNTPCheck(t, 0, 0, 0, 2, []byte{192, 0, 2, 1})
+
+	require.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "192.0.2.1", crs.Get(0).GetMetric("reference_id").Value)
+}
+
+func TestNTPCheck_OffsetExceeded(t *testing.T) {
+	crs := runNTPCheck(t, 1, -3*time.Second, 0, 2, []byte{192, 0, 2, 1})
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "offset_exceeded")
+}
+
+func TestNTPCheck_KissOfDeath(t *testing.T) {
+	crs := runNTPCheck(t, 0, 0, 0, 0, []byte("RATE"))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "kiss code RATE", crs.Status)
+}
+
+func TestNTPCheck_Unsynchronized(t *testing.T) {
+	crs := runNTPCheck(t, 0, 0, 3, 2, []byte{192, 0, 2, 1})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "server clock not synchronized", crs.Status)
+}
@@ -0,0 +1,588 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultPostgreSQLPort is the port used when the check details do not specify one
+	DefaultPostgreSQLPort = uint64(5432)
+	// DefaultPostgreSQLUser is the user named in the startup message when the check details do not specify one
+	DefaultPostgreSQLUser = "rackspace-monitoring-poller"
+	// MaxPostgreSQLMessageLength bounds the size of a single backend message
+	MaxPostgreSQLMessageLength = 1024 * 1024
+	// MaxSCRAMIterations bounds the iteration count a server may request for SCRAM, which otherwise could keep the
+	// check hashing the password long past its timeout
+	MaxSCRAMIterations = 100000
+
+	pgProtocolVersion = 196608
+	pgSSLRequestCode  = 80877103
+
+	pgAuthOK                = 0
+	pgAuthCleartextPassword = 3
+	pgAuthMD5Password       = 5
+	pgAuthSASL              = 10
+	pgAuthSASLContinue      = 11
+	pgAuthSASLFinal         = 12
+
+	pgSCRAMSHA256 = "SCRAM-SHA-256"
+)
+
+var (
+	// ErrPostgreSQLMalformedMessage indicates the server sent a message that could not be decoded
+	ErrPostgreSQLMalformedMessage = errors.New("malformed PostgreSQL message")
+	// ErrPostgreSQLServerSignature indicates the server failed to prove it knows the SCRAM password
+	ErrPostgreSQLServerSignature = errors.New("invalid SCRAM server signature")
+	// ErrSCRAMIterations indicates the server requested more than MaxSCRAMIterations SCRAM iterations
+	ErrSCRAMIterations = fmt.Errorf("SCRAM iteration count exceeds %d", MaxSCRAMIterations)
+)
+
+var pgAuthMethodNames = map[uint32]string{
+	pgAuthOK:                "trust",
+	pgAuthCleartextPassword: "password",
+	pgAuthMD5Password:       "md5",
+	pgAuthSASL:              "scram-sha-256",
+}
+
+// PostgreSQLCheck conveys PostgreSQL checks
+type PostgreSQLCheck struct {
+	Base
+	protocheck.PostgreSQLCheckDetails
+}
+
+// NewPostgreSQLCheck - Constructor for a PostgreSQL Check
+func NewPostgreSQLCheck(base *Base) (Check, error) {
+	check := &PostgreSQLCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_postgresql",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *PostgreSQLCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultPostgreSQLPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// pgError is decoded from an ErrorResponse message
+type pgError struct {
+	Severity string
+	Code     string
+	Message  string
+}
+
+func (e *pgError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Severity, e.Code, e.Message)
+}
+
+func parsePostgreSQLError(payload []byte) error {
+	e := &pgError{}
+	for len(payload) > 1 {
+		field := payload[0]
+		end := bytes.IndexByte(payload[1:], 0)
+		if end < 0 {
+			break
+		}
+		value := string(payload[1 : 1+end])
+		payload = payload[2+end:]
+		switch field {
+		case 'S':
+			e.Severity = value
+		case 'C':
+			e.Code = value
+		case 'M':
+			e.Message = value
+		}
+	}
+	return e
+}
+
+// pgConn frames the messages of the PostgreSQL frontend/backend protocol
+type pgConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newPostgreSQLConn(conn net.Conn) *pgConn {
+	return &pgConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// upgrade switches the framing over to the given connection, such as after a TLS handshake
+func (c *pgConn) upgrade(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+}
+
+func (c *pgConn) readMessage() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	length := int(binary.BigEndian.Uint32(header[1:]))
+	if length < 4 || length > MaxPostgreSQLMessageLength {
+		return 0, nil, ErrPostgreSQLMalformedMessage
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// writeMessage sends a message, where a type of zero is used for the untyped startup messages
+func (c *pgConn) writeMessage(msgType byte, payload []byte) error {
+	var buf bytes.Buffer
+	if msgType != 0 {
+		buf.WriteByte(msgType)
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(payload)+4))
+	buf.Write(length)
+	buf.Write(payload)
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+// sslRequest asks the server to switch to TLS and reports whether it agreed
+func (c *pgConn) sslRequest() (bool, error) {
+	code := make([]byte, 4)
+	binary.BigEndian.PutUint32(code, pgSSLRequestCode)
+	if err := c.writeMessage(0, code); err != nil {
+		return false, err
+	}
+	resp, err := c.reader.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch resp {
+	case 'S':
+		return true, nil
+	case 'N':
+		return false, nil
+	}
+	return false, ErrPostgreSQLMalformedMessage
+}
+
+func (ch *PostgreSQLCheck) startup(pc *pgConn, user string) error {
+	var payload bytes.Buffer
+	version := make([]byte, 4)
+	binary.BigEndian.PutUint32(version, pgProtocolVersion)
+	payload.Write(version)
+	params := []string{"user", user, "application_name", DefaultPostgreSQLUser}
+	if ch.Details.Database != "" {
+		params = append(params, "database", ch.Details.Database)
+	}
+	for _, param := range params {
+		payload.WriteString(param)
+		payload.WriteByte(0)
+	}
+	payload.WriteByte(0)
+	return pc.writeMessage(0, payload.Bytes())
+}
+
+// readAuthRequest reads the next Authentication message, returning its code and data
+func (c *pgConn) readAuthRequest() (uint32, []byte, error) {
+	msgType, payload, err := c.readMessage()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case msgType == 'E':
+		return 0, nil, parsePostgreSQLError(payload)
+	case msgType != 'R' || len(payload) < 4:
+		return 0, nil, ErrPostgreSQLMalformedMessage
+	}
+	return binary.BigEndian.Uint32(payload), payload[4:], nil
+}
+
+// authenticate answers the server's authentication request until it reports AuthenticationOk
+func (ch *PostgreSQLCheck) authenticate(pc *pgConn, code uint32, data []byte) error {
+	switch code {
+	case pgAuthOK:
+		return nil
+	case pgAuthCleartextPassword:
+		if err := pc.writeMessage('p', append([]byte(ch.Details.Password), 0)); err != nil {
+			return err
+		}
+	case pgAuthMD5Password:
+		if len(data) < 4 {
+			return ErrPostgreSQLMalformedMessage
+		}
+		if err := pc.writeMessage('p', append([]byte(pgMD5Password(ch.Details.Username, ch.Details.Password, data[:4])), 0)); err != nil {
+			return err
+		}
+	case pgAuthSASL:
+		if err := ch.scramSHA256(pc, data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported authentication method: %d", code)
+	}
+
+	code, _, err := pc.readAuthRequest()
+	if err != nil {
+		return err
+	}
+	if code != pgAuthOK {
+		return ErrPostgreSQLMalformedMessage
+	}
+	return nil
+}
+
+func pgMD5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// scramSaltedPassword is the Hi function of RFC 5802, which is PBKDF2 with HMAC-SHA-256 as the PRF
+func scramSaltedPassword(password string, salt []byte, iterations int) []byte {
+	u := hmacSHA256([]byte(password), salt, []byte{0, 0, 0, 1})
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		u = hmacSHA256([]byte(password), u)
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// parseSCRAMAttributes splits a SCRAM message such as r=...,s=...,i=... into its attributes
+func parseSCRAMAttributes(message string) map[string]string {
+	attributes := make(map[string]string)
+	for _, part := range strings.Split(message, ",") {
+		if len(part) >= 2 && part[1] == '=' {
+			attributes[part[:1]] = part[2:]
+		}
+	}
+	return attributes
+}
+
+// scramSHA256 performs the SCRAM-SHA-256 SASL exchange described by RFC 7677
+func (ch *PostgreSQLCheck) scramSHA256(pc *pgConn, mechanisms []byte) error {
+	if !bytes.Contains(mechanisms, []byte(pgSCRAMSHA256+"\x00")) {
+		return fmt.Errorf("unsupported SASL mechanisms: %s", strings.Trim(string(bytes.Replace(mechanisms, []byte{0}, []byte{' '}, -1)), " "))
+	}
+
+	nonceBytes := make([]byte, 18)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	clientNonce := base64.StdEncoding.EncodeToString(nonceBytes)
+	// the user name is taken from the startup message, so it is left empty here
+	clientFirstBare := "n=,r=" + clientNonce
+	clientFirst := "n,," + clientFirstBare
+
+	var initial bytes.Buffer
+	initial.WriteString(pgSCRAMSHA256)
+	initial.WriteByte(0)
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(clientFirst)))
+	initial.Write(length)
+	initial.WriteString(clientFirst)
+	if err := pc.writeMessage('p', initial.Bytes()); err != nil {
+		return err
+	}
+
+	code, data, err := pc.readAuthRequest()
+	if err != nil {
+		return err
+	}
+	if code != pgAuthSASLContinue {
+		return ErrPostgreSQLMalformedMessage
+	}
+	serverFirst := string(data)
+	attributes := parseSCRAMAttributes(serverFirst)
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil {
+		return err
+	}
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil || iterations < 1 || !strings.HasPrefix(attributes["r"], clientNonce) {
+		return ErrPostgreSQLMalformedMessage
+	}
+	if iterations > MaxSCRAMIterations {
+		return ErrSCRAMIterations
+	}
+
+	saltedPassword := scramSaltedPassword(ch.Details.Password, salt, iterations)
+	clientKey := hmacSHA256(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	clientFinalWithoutProof := "c=biws,r=" + attributes["r"]
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+	proof := xorBytes(clientKey, hmacSHA256(storedKey[:], authMessage))
+	clientFinal := clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)
+	if err := pc.writeMessage('p', []byte(clientFinal)); err != nil {
+		return err
+	}
+
+	code, data, err = pc.readAuthRequest()
+	if err != nil {
+		return err
+	}
+	if code != pgAuthSASLFinal {
+		return ErrPostgreSQLMalformedMessage
+	}
+	serverKey := hmacSHA256(saltedPassword, []byte("Server Key"))
+	serverSignature := base64.StdEncoding.EncodeToString(hmacSHA256(serverKey, authMessage))
+	if parseSCRAMAttributes(string(data))["v"] != serverSignature {
+		return ErrPostgreSQLServerSignature
+	}
+	return nil
+}
+
+// awaitReady consumes messages until ReadyForQuery, returning the parameters reported by the server
+func (c *pgConn) awaitReady() (map[string]string, error) {
+	params := make(map[string]string)
+	for {
+		msgType, payload, err := c.readMessage()
+		if err != nil {
+			return params, err
+		}
+		switch msgType {
+		case 'S':
+			parts := bytes.Split(payload, []byte{0})
+			if len(parts) >= 2 {
+				params[string(parts[0])] = string(parts[1])
+			}
+		case 'E':
+			return params, parsePostgreSQLError(payload)
+		case 'Z':
+			return params, nil
+		}
+	}
+}
+
+// query runs the statement using the simple query protocol and returns the number of rows returned
+func (c *pgConn) query(statement string) (int, error) {
+	if err := c.writeMessage('Q', append([]byte(statement), 0)); err != nil {
+		return 0, err
+	}
+	rows := 0
+	var queryErr error
+	for {
+		msgType, payload, err := c.readMessage()
+		if err != nil {
+			return rows, err
+		}
+		switch msgType {
+		case 'D':
+			rows++
+		case 'E':
+			queryErr = parsePostgreSQLError(payload)
+		case 'Z':
+			return rows, queryErr
+		}
+	}
+}
+
+// Run method implements Check.Run method for PostgreSQL
+// please see Check interface for more information
+func (ch *PostgreSQLCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if ch.TargetHostname != nil && *ch.TargetHostname != "" {
+		host = *ch.TargetHostname
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+		"ssl":     ch.Details.UseSSL,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	conn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	connectEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectEndTime-starttime, metric.UnitMilliseconds))
+
+	// TLS Negotiation
+	pc := newPostgreSQLConn(conn)
+	tlsSupported, err := pc.sslRequest()
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	cr.AddMetric(metric.NewMetric("tls_supported", "", metric.MetricBool, tlsSupported, ""))
+	if ch.Details.UseSSL && !tlsSupported {
+		crs.SetStatus(ErrTLSNotSupported.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	if tlsSupported {
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			crs.SetStatusFromError(err)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		defer tlsConn.Close()
+		pc.upgrade(tlsConn)
+		sl.AddOption("ssl")
+		if metrics := ch.AddTLSMetrics(cr, tlsConn.ConnectionState()); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+	}
+
+	// Startup, where the server answers with the authentication method it requires
+	user := ch.Details.Username
+	if user == "" {
+		user = DefaultPostgreSQLUser
+	}
+	if err := ch.startup(pc, user); err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	code, data, err := pc.readAuthRequest()
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	handshakeEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("handshake_time", "", metric.MetricNumber, handshakeEndTime-connectEndTime, metric.UnitMilliseconds))
+	authMethod, ok := pgAuthMethodNames[code]
+	if !ok {
+		authMethod = strconv.FormatUint(uint64(code), 10)
+	}
+	cr.AddMetric(metric.NewMetric("auth_method", "", metric.MetricString, authMethod, ""))
+
+	// Authentication and Query, skipped when no credentials are configured unless the server trusts the connection
+	if ch.Details.Username != "" || code == pgAuthOK {
+		if err := ch.authenticate(pc, code, data); err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		params, err := pc.awaitReady()
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		authEndTime := utils.NowTimestampMillis()
+		cr.AddMetric(metric.NewMetric("auth_time", "", metric.MetricNumber, authEndTime-handshakeEndTime, metric.UnitMilliseconds))
+		if version, ok := params["server_version"]; ok {
+			cr.AddMetric(metric.NewMetric("server_version", "", metric.MetricString, version, ""))
+			sl.Add("version", version)
+		}
+
+		statement := ch.Details.Query
+		if statement == "" {
+			statement = DefaultDatabaseQuery
+		}
+		rows, err := pc.query(statement)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		cr.AddMetric(metric.NewMetric("query_time", "", metric.MetricNumber, utils.NowTimestampMillis()-authEndTime, metric.UnitMilliseconds))
+		cr.AddMetric(metric.NewMetric("rows", "", metric.MetricNumber, rows, ""))
+
+		pc.writeMessage('X', nil)
+	}
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("auth", authMethod)
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,265 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	pgTestPassword = "secret"
+	pgTestSalt     = "saltsaltsalt"
+)
+
+// pgTestServer handles a single session, authenticating with the given method and answering any query with
+// three rows
+type pgTestServer struct {
+	conn   net.Conn
+	tls    bool
+	method string
+	// iterations overrides the SCRAM iteration count sent, which is otherwise one
+	iterations string
+}
+
+func (s *pgTestServer) read(typed bool) (byte, []byte, error) {
+	header := make([]byte, 4)
+	var msgType byte
+	if typed {
+		t := make([]byte, 1)
+		if _, err := io.ReadFull(s.conn, t); err != nil {
+			return 0, nil, err
+		}
+		msgType = t[0]
+	}
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header)-4)
+	_, err := io.ReadFull(s.conn, payload)
+	return msgType, payload, err
+}
+
+func (s *pgTestServer) write(msgType byte, payload []byte) {
+	header := []byte{msgType, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
+	s.conn.Write(append(header, payload...))
+}
+
+func (s *pgTestServer) auth(code uint32, data string) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, code)
+	s.write('R', append(payload, data...))
+}
+
+func (s *pgTestServer) fail(message string) {
+	s.write('E', []byte("SFATAL\x00C28P01\x00M"+message+"\x00\x00"))
+}
+
+func pgTestHMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// scram runs the server side of SCRAM-SHA-256 with a single iteration
+func (s *pgTestServer) scram() bool {
+	iterations := s.iterations
+	if iterations == "" {
+		iterations = "1"
+	}
+	s.auth(10, "SCRAM-SHA-256\x00\x00")
+	_, initial, err := s.read(true)
+	if err != nil {
+		return false
+	}
+	clientFirstBare := string(initial[bytes.IndexByte(initial, 0)+5+3:])
+	clientNonce := strings.TrimPrefix(clientFirstBare, "n=,r=")
+	serverFirst := "r=" + clientNonce + "server,s=" + base64.StdEncoding.EncodeToString([]byte(pgTestSalt)) + ",i=" + iterations
+	s.auth(11, serverFirst)
+
+	_, final, err := s.read(true)
+	if err != nil {
+		return false
+	}
+	withoutProof := string(final[:bytes.Index(final, []byte(",p="))])
+	proof, _ := base64.StdEncoding.DecodeString(string(final[len(withoutProof)+3:]))
+
+	salted := pgTestHMAC([]byte(pgTestPassword), pgTestSalt+"\x00\x00\x00\x01")
+	clientKey := pgTestHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+	signature := pgTestHMAC(storedKey[:], authMessage)
+	for i := range signature {
+		signature[i] ^= clientKey[i]
+	}
+	if !bytes.Equal(signature, proof) {
+		s.fail("password authentication failed")
+		return false
+	}
+	s.auth(12, "v="+base64.StdEncoding.EncodeToString(pgTestHMAC(pgTestHMAC(salted, "Server Key"), authMessage)))
+	return true
+}
+
+func (s *pgTestServer) md5() bool {
+	s.auth(5, "salt")
+	_, password, err := s.read(true)
+	if err != nil {
+		return false
+	}
+	inner := md5.Sum([]byte(pgTestPassword + "monitor"))
+	outer := md5.Sum([]byte(hex.EncodeToString(inner[:]) + "salt"))
+	if string(password) != "md5"+hex.EncodeToString(outer[:])+"\x00" {
+		s.fail("password authentication failed")
+		return false
+	}
+	return true
+}
+
+func (s *pgTestServer) serve(t *testing.T) {
+	defer s.conn.Close()
+
+	if _, _, err := s.read(false); err != nil {
+		return
+	}
+	if s.tls {
+		s.conn.Write([]byte{'S'})
+		cert, err := tls.X509KeyPair(utils.LocalhostCert, utils.LocalhostKey)
+		require.NoError(t, err)
+		tlsConn := tls.Server(s.conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		s.conn = tlsConn
+	} else {
+		s.conn.Write([]byte{'N'})
+	}
+	if _, _, err := s.read(false); err != nil {
+		return
+	}
+
+	switch s.method {
+	case "scram":
+		if !s.scram() {
+			return
+		}
+	case "md5":
+		if !s.md5() {
+			return
+		}
+	}
+	s.auth(0, "")
+	s.write('S', []byte("server_version\x0010.4\x00"))
+	s.write('Z', []byte{'I'})
+
+	for {
+		msgType, _, err := s.read(true)
+		if err != nil || msgType == 'X' {
+			return
+		}
+		s.write('T', []byte("\x00\x01id\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x17\x00\x04\xff\xff\xff\xff\x00\x00"))
+		for i := 0; i < 3; i++ {
+			s.write('D', []byte("\x00\x01\x00\x00\x00\x011"))
+		}
+		s.write('C', []byte("SELECT 3\x00"))
+		s.write('Z', []byte{'I'})
+	}
+}
+
+func runPostgreSQLCheck(t *testing.T, server *pgTestServer, details string) *check.ResultSet {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server.conn = conn
+		server.serve(t)
+	}()
+
+	crs := runTestCheck(t, "remote.postgresql", fmt.Sprintf(details, listener.Addr().(*net.TCPAddr).Port))
+	return crs
+}
+
+func TestPostgreSQLCheck_Handshake(t *testing.T) {
+	crs := runPostgreSQLCheck(t, &pgTestServer{method: "scram"}, `{"port":%d}`)
+
+	assert.True(t, crs.Available)
+	ValidateMetrics(t, []string{"tt_connect", "handshake_time", "duration"}, crs.Get(0))
+	authMethod, _ := crs.Get(0).GetMetric("auth_method").ToString()
+	assert.Equal(t, "scram-sha-256", authMethod)
+	assert.Equal(t, false, crs.Get(0).GetMetric("tls_supported").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("auth_time"))
+}
+
+func TestPostgreSQLCheck_SCRAM(t *testing.T) {
+	crs := runPostgreSQLCheck(t, &pgTestServer{method: "scram", tls: true},
+		`{"port":%d,"username":"monitor","password":"secret","database":"app","ssl":true}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "ssl")
+	ValidateMetrics(t, []string{"auth_time", "query_time", "cert_issuer"}, crs.Get(0))
+	version, _ := crs.Get(0).GetMetric("server_version").ToString()
+	assert.Equal(t, "10.4", version)
+	assert.Equal(t, 3, crs.Get(0).GetMetric("rows").Value)
+}
+
+func TestPostgreSQLCheck_MD5(t *testing.T) {
+	crs := runPostgreSQLCheck(t, &pgTestServer{method: "md5"}, `{"port":%d,"username":"monitor","password":"secret"}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, 3, crs.Get(0).GetMetric("rows").Value)
+}
+
+func TestPostgreSQLCheck_AuthFailed(t *testing.T) {
+	crs := runPostgreSQLCheck(t, &pgTestServer{method: "scram"}, `{"port":%d,"username":"monitor","password":"wrong"}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "FATAL 28P01: password authentication failed", crs.Status)
+}
+
+func TestPostgreSQLCheck_SCRAMIterationsExceeded(t *testing.T) {
+	crs := runPostgreSQLCheck(t, &pgTestServer{method: "scram", iterations: "2147483647"},
+		`{"port":%d,"username":"monitor","password":"secret"}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "SCRAM iteration count exceeds 100000", crs.Status)
+}
+
+func TestPostgreSQLCheck_TLSRequired(t *testing.T) {
+	crs := runPostgreSQLCheck(t, &pgTestServer{}, `{"port":%d,"ssl":true}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "TLS not supported by server", crs.Status)
+}
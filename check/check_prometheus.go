@@ -0,0 +1,354 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PrometheusAcceptHeader requests the text exposition format
+	PrometheusAcceptHeader = "text/plain;version=0.0.4"
+)
+
+var (
+	// MaxPrometheusResponseLength bounds the size of the scraped exposition
+	MaxPrometheusResponseLength = int64(4 * 1024 * 1024)
+
+	// ErrPrometheusNoSeries indicates the check details did not select any series
+	ErrPrometheusNoSeries = errors.New("no series selected")
+)
+
+// PrometheusCheck conveys Prometheus scrape checks
+type PrometheusCheck struct {
+	Base
+	protocheck.PrometheusCheckDetails
+}
+
+// NewPrometheusCheck - Constructor for a Prometheus Check
+func NewPrometheusCheck(base *Base) (Check, error) {
+	check := &PrometheusCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_prometheus",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// prometheusMatcher is the compiled form of a protocheck.PrometheusMatcher
+type prometheusMatcher struct {
+	label  string
+	equal  bool
+	value  string
+	regexp *regexp.Regexp
+}
+
+func newPrometheusMatcher(m protocheck.PrometheusMatcher) (*prometheusMatcher, error) {
+	matcher := &prometheusMatcher{label: m.Label, value: m.Value}
+	switch m.Op {
+	case "", "=":
+		matcher.equal = true
+	case "!=":
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, err
+		}
+		matcher.equal = m.Op == "=~"
+		matcher.regexp = re
+	default:
+		return nil, fmt.Errorf("unsupported matcher op: %v", m.Op)
+	}
+	return matcher, nil
+}
+
+func (m *prometheusMatcher) matches(labels map[string]string) bool {
+	value := labels[m.label]
+	if m.regexp != nil {
+		return m.regexp.MatchString(value) == m.equal
+	}
+	return (value == m.value) == m.equal
+}
+
+// prometheusLabels maps the labels of a sample, which become its dimension
+func prometheusLabels(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, pair := range m.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+// prometheusDimension renders labels as a dimension, sorted by label name such as code=200,method=get
+func prometheusDimension(labels map[string]string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(labels)+1)
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"="+extraValue)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatPrometheusFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// prometheusResults groups metrics into one result per dimension, where undimensioned metrics join the main result
+type prometheusResults struct {
+	main    *Result
+	results map[string]*Result
+	samples int
+}
+
+func (r *prometheusResults) add(name, dimension string, metricType int, value interface{}) {
+	cr := r.main
+	if dimension != "" {
+		var ok bool
+		if cr, ok = r.results[dimension]; !ok {
+			cr = NewResult()
+			r.results[dimension] = cr
+		}
+	}
+	cr.AddMetric(metric.NewMetric(name, dimension, metricType, value, ""))
+	r.samples++
+}
+
+// prometheusSelected determines if the labels satisfy all the matchers of any of the selectors
+func prometheusSelected(labels map[string]string, selectors [][]*prometheusMatcher) bool {
+selectorLoop:
+	for _, matchers := range selectors {
+		for _, matcher := range matchers {
+			if !matcher.matches(labels) {
+				continue selectorLoop
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// addFamily adds the samples of the family that are selected, where a summary or histogram contributes its sum,
+// count and each quantile or bucket
+func (r *prometheusResults) addFamily(family *dto.MetricFamily, selectors [][]*prometheusMatcher) {
+	name := family.GetName()
+	for _, m := range family.GetMetric() {
+		labels := prometheusLabels(m)
+		if !prometheusSelected(labels, selectors) {
+			continue
+		}
+		dimension := prometheusDimension(labels, "", "")
+
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			r.add(name, dimension, metric.MetricFloat, m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			r.add(name, dimension, metric.MetricFloat, m.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			r.add(name, dimension, metric.MetricFloat, m.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			summary := m.GetSummary()
+			r.add(name+"_sum", dimension, metric.MetricFloat, summary.GetSampleSum())
+			r.add(name+"_count", dimension, metric.MetricNumber, summary.GetSampleCount())
+			for _, q := range summary.GetQuantile() {
+				r.add(name, prometheusDimension(labels, "quantile", formatPrometheusFloat(q.GetQuantile())),
+					metric.MetricFloat, q.GetValue())
+			}
+		case dto.MetricType_HISTOGRAM:
+			histogram := m.GetHistogram()
+			r.add(name+"_sum", dimension, metric.MetricFloat, histogram.GetSampleSum())
+			r.add(name+"_count", dimension, metric.MetricNumber, histogram.GetSampleCount())
+			for _, b := range histogram.GetBucket() {
+				r.add(name+"_bucket", prometheusDimension(labels, "le", formatPrometheusFloat(b.GetUpperBound())),
+					metric.MetricNumber, b.GetCumulativeCount())
+			}
+		}
+	}
+}
+
+// Run method implements Check.Run method for Prometheus
+// please see Check interface for more information
+func (ch *PrometheusCheck) Run() (*ResultSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ch.GetTimeoutDuration())
+	defer cancel()
+
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	// Parse URL and Replace Host with IP
+	parsed, host, err := ch.targetURL(ch.Details.Url)
+	if err != nil {
+		return nil, err
+	}
+	url := parsed.String()
+
+	log.WithFields(log.Fields{
+		"prefix": ch.GetLogPrefix(),
+		"url":    url,
+	}).Info("Running check")
+
+	// Setup Selectors
+	if len(ch.Details.Series) == 0 {
+		crs.SetStatus(ErrPrometheusNoSeries.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	selectors := make(map[string][][]*prometheusMatcher)
+	for _, series := range ch.Details.Series {
+		matchers := make([]*prometheusMatcher, len(series.Matchers))
+		for i, m := range series.Matchers {
+			if matchers[i], err = newPrometheusMatcher(m); err != nil {
+				crs.SetStatus(err.Error())
+				crs.SetStateUnavailable()
+				return crs, nil
+			}
+		}
+		selectors[series.Name] = append(selectors[series.Name], matchers)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true, ServerName: host}
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   tlsConfig,
+		DialContext:       NewCustomDialContext(ch.TargetResolver),
+	}
+	netClient := &http.Client{Transport: transport}
+
+	// Setup Request
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	trace := &httptrace.ClientTrace{
+		ConnectDone: func(network, addr string, err error) {
+			cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	req.Header.Add("User-Agent", UserAgent)
+	req.Header.Add("Accept", PrometheusAcceptHeader)
+	req.Host = host
+	for key, value := range ch.Details.Headers {
+		req.Header.Add(key, value)
+	}
+
+	// Perform Request
+	resp, err := netClient.Do(req)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer resp.Body.Close()
+	body, err := ch.readLimit(resp.Body, MaxPrometheusResponseLength)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	endtime := utils.NowTimestampMillis()
+
+	cr.AddMetric(metric.NewMetric("code", "", metric.MetricString, strconv.Itoa(resp.StatusCode), ""))
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("bytes", "", metric.MetricNumber, len(body), "bytes"))
+
+	// TLS
+	if resp.TLS != nil {
+		if metrics := ch.AddTLSMetrics(cr, *resp.TLS); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		crs.SetStatus(fmt.Sprintf("HTTP status %d", resp.StatusCode))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	if int64(len(body)) > MaxPrometheusResponseLength {
+		crs.SetStatus(fmt.Sprintf("exposition exceeds %d bytes", MaxPrometheusResponseLength))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Parse Exposition
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	results := &prometheusResults{main: cr, results: make(map[string]*Result)}
+	for name, family := range families {
+		if familySelectors, ok := selectors[name]; ok {
+			results.addFamily(family, familySelectors)
+		}
+	}
+	cr.AddMetric(metric.NewMetric("series", "", metric.MetricNumber, results.samples, ""))
+
+	dimensions := make([]string, 0, len(results.results))
+	for dimension := range results.results {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+	for _, dimension := range dimensions {
+		crs.Add(results.results[dimension])
+	}
+
+	// Status Line
+	sl.Add("code", resp.StatusCode)
+	sl.Add("series", results.samples)
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,144 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+const prometheusExposition = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027
+http_requests_total{method="get",code="500"} 3
+http_requests_total{method="post",code="200"} 12
+# HELP process_open_fds Number of open file descriptors.
+# TYPE process_open_fds gauge
+process_open_fds 42
+# HELP rpc_duration_seconds A summary of the RPC duration in seconds.
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.05
+rpc_duration_seconds{quantile="0.99"} 0.2
+rpc_duration_seconds_sum 17.5
+rpc_duration_seconds_count 350
+# HELP request_size_bytes A histogram of request sizes.
+# TYPE request_size_bytes histogram
+request_size_bytes_bucket{le="100"} 10
+request_size_bytes_bucket{le="+Inf"} 15
+request_size_bytes_sum 2400
+request_size_bytes_count 15
+`
+
+func prometheusHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "metrics.example.com", r.Host)
+		assert.Contains(t, r.Header.Get("Accept"), "text/plain")
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, prometheusExposition)
+	}
+}
+
+// prometheusTestDetails scrapes the port given through a hostname that resolves to the target, for the series given
+const prometheusTestDetails = `{"url":"http://metrics.example.com:%d/metrics","headers":{"X-Token":"secret"},"series":%s}`
+
+// resultByDimension finds the result holding the metrics of a dimension
+func resultByDimension(crs *check.ResultSet, dimension string) *check.Result {
+	for i := 0; i < crs.Length(); i++ {
+		for _, m := range crs.Get(i).Metrics {
+			if m.Dimension == dimension {
+				return crs.Get(i)
+			}
+		}
+	}
+	return nil
+}
+
+func TestPrometheusCheck_Select(t *testing.T) {
+	server := httptest.NewServer(prometheusHandler(t))
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.prometheus", fmt.Sprintf(prometheusTestDetails, server.Listener.Addr().(*net.TCPAddr).Port, `[
+		{"name":"http_requests_total","matchers":[{"label":"method","value":"get"},{"label":"code","op":"=~","value":"2.."}]},
+		{"name":"process_open_fds"},
+		{"name":"not_exposed"}
+	]`))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, 2, crs.Length())
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("tt_connect", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("code", "", metric.MetricString, "200", ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("bytes", "", metric.MetricNumber, len(prometheusExposition), "bytes"),
+		ExpectMetric("series", "", metric.MetricNumber, 2, ""),
+		ExpectMetric("process_open_fds", "", metric.MetricFloat, 42.0, ""),
+	}, crs.Get(0).Metrics)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("http_requests_total", "code=200,method=get", metric.MetricFloat, 1027.0, ""),
+	}, crs.Get(1).Metrics)
+
+	req := check.NewMetricsPostRequest(crs, 0)
+	assert.Equal(t, "code=200,method=get", req.Params.Metrics[1].Dimension)
+}
+
+func TestPrometheusCheck_SummaryAndHistogram(t *testing.T) {
+	server := httptest.NewServer(prometheusHandler(t))
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.prometheus", fmt.Sprintf(prometheusTestDetails, server.Listener.Addr().(*net.TCPAddr).Port,
+		`[{"name":"rpc_duration_seconds"},{"name":"request_size_bytes"}]`))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, 17.5, crs.Get(0).GetMetric("rpc_duration_seconds_sum").Value)
+	assert.Equal(t, uint64(350), crs.Get(0).GetMetric("rpc_duration_seconds_count").Value)
+	assert.Equal(t, uint64(15), crs.Get(0).GetMetric("request_size_bytes_count").Value)
+	assert.Equal(t, 0.2, resultByDimension(crs, "quantile=0.99").GetMetric("rpc_duration_seconds").Value)
+	assert.Equal(t, uint64(10), resultByDimension(crs, "le=100").GetMetric("request_size_bytes_bucket").Value)
+	assert.Equal(t, uint64(15), resultByDimension(crs, "le=+Inf").GetMetric("request_size_bytes_bucket").Value)
+}
+
+func TestPrometheusCheck_InvalidMatcher(t *testing.T) {
+	server := httptest.NewServer(prometheusHandler(t))
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.prometheus", fmt.Sprintf(prometheusTestDetails, server.Listener.Addr().(*net.TCPAddr).Port,
+		`[{"name":"http_requests_total","matchers":[{"label":"code","op":"<","value":"300"}]}]`))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "unsupported matcher op: <", crs.Status)
+}
+
+func TestPrometheusCheck_NotOK(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.prometheus", fmt.Sprintf(prometheusTestDetails, server.Listener.Addr().(*net.TCPAddr).Port,
+		`[{"name":"process_open_fds"}]`))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "HTTP status 404", crs.Status)
+}
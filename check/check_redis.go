@@ -0,0 +1,300 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultRedisPort is the port used when the check details do not specify one
+	DefaultRedisPort = uint64(6379)
+	// MaxRedisReplyLength bounds the size of a bulk string reply, such as the output of INFO
+	MaxRedisReplyLength = 1024 * 1024
+)
+
+var (
+	// DefaultRedisInfoFields are the INFO fields reported when the check details do not select any
+	DefaultRedisInfoFields = []string{
+		"uptime_in_seconds",
+		"connected_clients",
+		"blocked_clients",
+		"used_memory",
+		"used_memory_rss",
+		"mem_fragmentation_ratio",
+		"total_connections_received",
+		"total_commands_processed",
+		"rejected_connections",
+		"expired_keys",
+		"evicted_keys",
+		"keyspace_hits",
+		"keyspace_misses",
+		"connected_slaves",
+	}
+
+	// ErrRedisMalformedReply indicates the server sent a reply that could not be decoded
+	ErrRedisMalformedReply = errors.New("malformed RESP reply")
+)
+
+// RedisCheck conveys Redis checks
+type RedisCheck struct {
+	Base
+	protocheck.RedisCheckDetails
+}
+
+// NewRedisCheck - Constructor for a Redis Check
+func NewRedisCheck(base *Base) (Check, error) {
+	check := &RedisCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_redis",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *RedisCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultRedisPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// redisError is decoded from a RESP error reply
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// writeRESPCommand sends the command as an array of bulk strings
+func writeRESPCommand(w io.Writer, args ...string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readRESPReply reads a simple string, error, integer or bulk string reply
+func readRESPReply(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", ErrRedisMalformedReply
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length > MaxRedisReplyLength {
+			return "", ErrRedisMalformedReply
+		}
+		if length < 0 {
+			return "", nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return "", err
+		}
+		return string(data[:length]), nil
+	}
+	return "", ErrRedisMalformedReply
+}
+
+// parseRedisInfo splits INFO output into its fields, skipping section headers
+func parseRedisInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if pos := strings.IndexByte(line, ':'); pos > 0 {
+			fields[line[:pos]] = line[pos+1:]
+		}
+	}
+	return fields
+}
+
+// addStatMetrics adds the selected statistics as metrics, where integers become numbers, other numeric values
+// become floats and anything else is reported as a string. Statistics the server did not report are skipped.
+func addStatMetrics(cr *Result, stats map[string]string, selected []string) {
+	for _, name := range selected {
+		value, ok := stats[name]
+		if !ok {
+			continue
+		}
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			cr.AddMetric(metric.NewMetric(name, "", metric.MetricNumber, i, ""))
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			cr.AddMetric(metric.NewMetric(name, "", metric.MetricFloat, f, ""))
+		} else {
+			cr.AddMetric(metric.NewMetric(name, "", metric.MetricString, value, ""))
+		}
+	}
+}
+
+// Run method implements Check.Run method for Redis
+// please see Check interface for more information
+func (ch *RedisCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	conn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+	reader := bufio.NewReader(conn)
+
+	// Authentication
+	if ch.Details.Password != "" {
+		args := []string{"AUTH", ch.Details.Password}
+		if ch.Details.Username != "" {
+			args = []string{"AUTH", ch.Details.Username, ch.Details.Password}
+		}
+		err := writeRESPCommand(conn, args...)
+		if err == nil {
+			_, err = readRESPReply(reader)
+		}
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
+	// Ping
+	pingStartTime := utils.NowTimestampMillis()
+	err = writeRESPCommand(conn, "PING")
+	var pong string
+	if err == nil {
+		pong, err = readRESPReply(reader)
+	}
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	if pong != "PONG" {
+		crs.SetStatus(fmt.Sprintf("unexpected PING reply: %v", pong))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	cr.AddMetric(metric.NewMetric("ping_time", "", metric.MetricNumber, utils.NowTimestampMillis()-pingStartTime, metric.UnitMilliseconds))
+
+	// Info
+	err = writeRESPCommand(conn, "INFO")
+	var info string
+	if err == nil {
+		info, err = readRESPReply(reader)
+	}
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	stats := parseRedisInfo(info)
+	fields := ch.Details.Fields
+	if len(fields) == 0 {
+		fields = DefaultRedisInfoFields
+	}
+	if version, ok := stats["redis_version"]; ok {
+		cr.AddMetric(metric.NewMetric("version", "", metric.MetricString, version, ""))
+		sl.Add("version", version)
+	}
+	if role, ok := stats["role"]; ok {
+		cr.AddMetric(metric.NewMetric("role", "", metric.MetricString, role, ""))
+	}
+	addStatMetrics(cr, stats, fields)
+
+	writeRESPCommand(conn, "QUIT")
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,133 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redisTestInfo = "# Server\r\nredis_version:6.2.6\r\nuptime_in_seconds:3600\r\n\r\n" +
+	"# Clients\r\nconnected_clients:12\r\nblocked_clients:0\r\n\r\n" +
+	"# Memory\r\nused_memory:1048576\r\nmem_fragmentation_ratio:1.25\r\n\r\n" +
+	"# Stats\r\nevicted_keys:7\r\n\r\n# Replication\r\nrole:master\r\n"
+
+// serveRedis handles a single session, requiring the password "secret" when one is given and answering PING
+// with the given reply
+func serveRedis(listener net.Listener, password, pong string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	authenticated := password == ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		var args []string
+		for i := 0; i < count; i++ {
+			reader.ReadString('\n')
+			arg, _ := reader.ReadString('\n')
+			args = append(args, strings.TrimSpace(arg))
+		}
+
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] != password {
+				conn.Write([]byte("-WRONGPASS invalid username-password pair\r\n"))
+				continue
+			}
+			authenticated = true
+			conn.Write([]byte("+OK\r\n"))
+		case !authenticated:
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+		case args[0] == "PING":
+			conn.Write([]byte("+" + pong + "\r\n"))
+		case args[0] == "INFO":
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(redisTestInfo), redisTestInfo)
+		case args[0] == "QUIT":
+			conn.Write([]byte("+OK\r\n"))
+			return
+		}
+	}
+}
+
+func runRedisCheck(t *testing.T, password, pong, details string) *check.ResultSet {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveRedis(listener, password, pong)
+
+	crs := runTestCheck(t, "remote.redis", fmt.Sprintf(details, listener.Addr().(*net.TCPAddr).Port))
+	return crs
+}
+
+func TestRedisCheck_Info(t *testing.T) {
+	crs := runRedisCheck(t, "secret", "PONG", `{"port":%d,"password":"secret"}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("tt_connect", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("ping_time", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("version", "", metric.MetricString, "6.2.6", ""),
+		ExpectMetric("role", "", metric.MetricString, "master", ""),
+		ExpectMetric("uptime_in_seconds", "", metric.MetricNumber, int64(3600), ""),
+		ExpectMetric("connected_clients", "", metric.MetricNumber, int64(12), ""),
+		ExpectMetric("blocked_clients", "", metric.MetricNumber, int64(0), ""),
+		ExpectMetric("used_memory", "", metric.MetricNumber, int64(1048576), ""),
+		ExpectMetric("mem_fragmentation_ratio", "", metric.MetricFloat, 1.25, ""),
+		ExpectMetric("evicted_keys", "", metric.MetricNumber, int64(7), ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestRedisCheck_SelectedFields(t *testing.T) {
+	crs := runRedisCheck(t, "", "PONG", `{"port":%d,"fields":["used_memory","missing"]}`)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, int64(1048576), crs.Get(0).GetMetric("used_memory").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("connected_clients"))
+	assert.Nil(t, crs.Get(0).GetMetric("missing"))
+}
+
+func TestRedisCheck_AuthFailed(t *testing.T) {
+	crs := runRedisCheck(t, "secret", "PONG", `{"port":%d,"password":"wrong"}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "WRONGPASS invalid username-password pair", crs.Status)
+}
+
+func TestRedisCheck_NoPong(t *testing.T) {
+	crs := runRedisCheck(t, "", "LOADING", `{"port":%d}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "unexpected PING reply: LOADING", crs.Status)
+	assert.Nil(t, crs.Get(0).GetMetric("ping_time"))
+}
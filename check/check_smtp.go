@@ -0,0 +1,270 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSMTPPort is the port used when the check details do not specify one
+	DefaultSMTPPort = uint64(25)
+	// DefaultSMTPEhlo is the name announced in EHLO when the check details do not specify one
+	DefaultSMTPEhlo = "localhost"
+)
+
+// SMTPCheck conveys SMTP checks
+type SMTPCheck struct {
+	Base
+	protocheck.SMTPCheckDetails
+}
+
+// NewSMTPCheck - Constructor for an SMTP Check
+func NewSMTPCheck(base *Base) (Check, error) {
+	check := &SMTPCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_smtp",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *SMTPCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultSMTPPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// exchange sends the given command, if any, and reads the response which must begin with expectCode.
+// The response code and, upon success, the time-to metric of the phase are added to the result.
+func (ch *SMTPCheck) exchange(text *textproto.Conn, cr *Result, starttime int64, phase string, expectCode int, format string, args ...interface{}) (string, error) {
+	if format != "" {
+		id, err := text.Cmd(format, args...)
+		if err != nil {
+			return "", err
+		}
+		text.StartResponse(id)
+		defer text.EndResponse(id)
+	}
+	code, msg, err := text.ReadResponse(expectCode)
+	if code != 0 {
+		cr.AddMetric(metric.NewMetric(phase+"_code", "", metric.MetricNumber, code, ""))
+	}
+	if err != nil {
+		return msg, err
+	}
+	cr.AddMetric(metric.NewMetric("tt_"+phase, "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+	return msg, nil
+}
+
+// ehlo greets the server and returns the extension keywords it advertised
+func (ch *SMTPCheck) ehlo(text *textproto.Conn, cr *Result, starttime int64) ([]string, error) {
+	name := ch.Details.Ehlo
+	if name == "" {
+		name = DefaultSMTPEhlo
+	}
+	msg, err := ch.exchange(text, cr, starttime, "ehlo", 250, "EHLO %s", name)
+	if err != nil {
+		return nil, err
+	}
+	// the first line is the server's greeting, each following line starts with an extension keyword
+	lines := strings.Split(msg, "\n")
+	extensions := make([]string, 0, len(lines))
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			extensions = append(extensions, strings.ToUpper(fields[0]))
+		}
+	}
+	cr.AddMetric(metric.NewMetric("extensions", "", metric.MetricString, strings.Join(extensions, ","), ""))
+	return extensions, nil
+}
+
+func smtpHasExtension(extensions []string, keyword string) bool {
+	for _, extension := range extensions {
+		if extension == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+func setSMTPFailure(crs *ResultSet, phase string, err error) {
+	if protoErr, ok := err.(*textproto.Error); ok {
+		crs.SetStatus(fmt.Sprintf("%s rejected: %03d %s", phase, protoErr.Code, protoErr.Msg))
+	} else {
+		crs.SetStatusFromError(err)
+	}
+	crs.SetStateUnavailable()
+}
+
+// Run method implements Check.Run method for SMTP
+// please see Check interface for more information
+func (ch *SMTPCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if ch.TargetHostname != nil && *ch.TargetHostname != "" {
+		host = *ch.TargetHostname
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":   ch.GetLogPrefix(),
+		"address":  addr,
+		"starttls": ch.Details.StartTLS,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	conn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+
+	text := textproto.NewConn(conn)
+
+	// Banner
+	banner, err := ch.exchange(text, cr, starttime, "banner", 220, "")
+	if err != nil {
+		setSMTPFailure(crs, "banner", err)
+		return crs, nil
+	}
+	if pos := strings.Index(banner, "\n"); pos >= 0 {
+		banner = banner[:pos]
+	}
+	if len(banner) > MaxTCPBannerLength {
+		banner = banner[:MaxTCPBannerLength]
+	}
+	cr.AddMetric(metric.NewMetric("banner", "", metric.MetricString, banner, ""))
+
+	// EHLO
+	extensions, err := ch.ehlo(text, cr, starttime)
+	if err != nil {
+		setSMTPFailure(crs, "ehlo", err)
+		return crs, nil
+	}
+
+	// STARTTLS
+	if ch.Details.StartTLS {
+		if !smtpHasExtension(extensions, "STARTTLS") {
+			crs.SetStatus("STARTTLS not supported")
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		if _, err := ch.exchange(text, cr, starttime, "starttls", 220, "STARTTLS"); err != nil {
+			setSMTPFailure(crs, "starttls", err)
+			return crs, nil
+		}
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			crs.SetStatusFromError(err)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		defer tlsConn.Close()
+		sl.AddOption("starttls")
+		if metrics := ch.AddTLSMetrics(cr, tlsConn.ConnectionState()); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+
+		// the session starts over once TLS is in place, so the server needs to be greeted again
+		text = textproto.NewConn(tlsConn)
+		if _, err := ch.ehlo(text, cr, starttime); err != nil {
+			setSMTPFailure(crs, "ehlo", err)
+			return crs, nil
+		}
+	}
+
+	// Envelope Probe
+	if ch.Details.From != "" {
+		if _, err := ch.exchange(text, cr, starttime, "mail_from", 250, "MAIL FROM:<%s>", ch.Details.From); err != nil {
+			setSMTPFailure(crs, "mail_from", err)
+			return crs, nil
+		}
+		if ch.Details.To != "" {
+			if _, err := ch.exchange(text, cr, starttime, "rcpt_to", 25, "RCPT TO:<%s>", ch.Details.To); err != nil {
+				setSMTPFailure(crs, "rcpt_to", err)
+				return crs, nil
+			}
+		}
+		// nothing is ever sent, so abandon the transaction
+		text.Cmd("RSET")
+		text.ReadResponse(250)
+	}
+
+	// be polite, but the outcome of QUIT has no bearing on the check
+	text.Cmd("QUIT")
+	text.ReadResponse(221)
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
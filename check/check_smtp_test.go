@@ -0,0 +1,122 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveSMTP handles a single SMTP session on the listener, accepting any recipient other than reject@example.com
+func serveSMTP(t *testing.T, listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 mail.example.com ESMTP test")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.Fields(line)[0])
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-mail.example.com greets you")
+			text.PrintfLine("250-PIPELINING")
+			text.PrintfLine("250-STARTTLS")
+			text.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			text.PrintfLine("220 go ahead")
+			cert, err := tls.X509KeyPair(utils.LocalhostCert, utils.LocalhostKey)
+			require.NoError(t, err)
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			text = textproto.NewConn(tlsConn)
+		case "MAIL":
+			text.PrintfLine("250 sender ok")
+		case "RCPT":
+			if strings.Contains(line, "reject@example.com") {
+				text.PrintfLine("550 no such user")
+			} else {
+				text.PrintfLine("250 recipient ok")
+			}
+		case "RSET":
+			text.PrintfLine("250 reset")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func runSMTPCheck(t *testing.T, details string) *check.ResultSet {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveSMTP(t, listener)
+
+	crs := runTestCheck(t, "remote.smtp", fmt.Sprintf(details, listener.Addr().(*net.TCPAddr).Port))
+	return crs
+}
+
+func TestSMTPCheck_Envelope(t *testing.T) {
+	crs := runSMTPCheck(t, `{"port":%d,"from":"poller@example.com","to":"postmaster@example.com"}`)
+
+	assert.True(t, crs.Available)
+	ValidateMetrics(t, []string{"tt_connect", "tt_banner", "tt_ehlo", "tt_mail_from", "tt_rcpt_to", "duration"}, crs.Get(0))
+	cr := crs.Get(0)
+	banner, _ := cr.GetMetric("banner").ToString()
+	assert.Equal(t, "mail.example.com ESMTP test", banner)
+	extensions, _ := cr.GetMetric("extensions").ToString()
+	assert.Equal(t, "PIPELINING,STARTTLS,8BITMIME", extensions)
+	assert.Equal(t, 250, cr.GetMetric("rcpt_to_code").Value)
+	assert.Nil(t, cr.GetMetric("cert_issuer"))
+}
+
+func TestSMTPCheck_StartTLS(t *testing.T) {
+	crs := runSMTPCheck(t, `{"port":%d,"starttls":true}`)
+
+	assert.True(t, crs.Available)
+	assert.Contains(t, crs.Status, "starttls")
+	ValidateMetrics(t, []string{"tt_starttls", "cert_issuer", "cert_end_in", "ssl_session_version"}, crs.Get(0))
+	assert.Equal(t, 220, crs.Get(0).GetMetric("starttls_code").Value)
+}
+
+func TestSMTPCheck_RecipientRejected(t *testing.T) {
+	crs := runSMTPCheck(t, `{"port":%d,"from":"poller@example.com","to":"reject@example.com"}`)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "rcpt_to rejected: 550 no such user", crs.Status)
+	assert.Equal(t, 550, crs.Get(0).GetMetric("rcpt_to_code").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("tt_rcpt_to"))
+}
@@ -0,0 +1,285 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSNMPPort is the port used when the check details do not specify one
+	DefaultSNMPPort = uint64(161)
+	// DefaultSNMPCommunity is the SNMPv2c community used when the check details do not specify one
+	DefaultSNMPCommunity = "public"
+
+	// SNMPOperationGet retrieves exactly the configured OIDs
+	SNMPOperationGet = "get"
+	// SNMPOperationWalk retrieves every OID beneath the configured OIDs
+	SNMPOperationWalk = "walk"
+
+	// SNMPMaxOIDs bounds the OIDs of a single GetRequest, since agents limit the size of their responses
+	SNMPMaxOIDs = 60
+	// SNMPMaxRepetitions is the number of variables requested by each GetBulkRequest of a walk
+	SNMPMaxRepetitions = 50
+	// DefaultSNMPMaxResults bounds the variables retrieved by the walks of a check that does not set max_results
+	DefaultSNMPMaxResults = 1000
+)
+
+var (
+	// ErrSNMPNoOIDs indicates the check details did not list any OIDs
+	ErrSNMPNoOIDs = errors.New("no OIDs configured")
+	// ErrSNMPNoValues indicates the agent did not return a value for any of the OIDs
+	ErrSNMPNoValues = errors.New("no values returned")
+)
+
+// SNMPCheck conveys SNMP checks
+type SNMPCheck struct {
+	Base
+	protocheck.SNMPCheckDetails
+}
+
+// NewSNMPCheck - Constructor for an SNMP Check
+func NewSNMPCheck(base *Base) (Check, error) {
+	check := &SNMPCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_snmp",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// client configures an SNMP session from the check details, which is connected by Run
+func (ch *SNMPCheck) client(deadline time.Time) (*utils.SNMPClient, error) {
+	client := &utils.SNMPClient{Deadline: deadline}
+	switch strings.ToLower(ch.Details.Version) {
+	case "", "2c", "v2c":
+		client.Version = utils.SNMPVersion2c
+		client.Community = ch.Details.Community
+		if client.Community == "" {
+			client.Community = DefaultSNMPCommunity
+		}
+	case "3", "v3":
+		usm, err := utils.NewSNMPUSM(strings.ToUpper(ch.Details.AuthProtocol), ch.Details.AuthPassword,
+			strings.ToUpper(ch.Details.PrivProtocol), ch.Details.PrivPassword)
+		if err != nil {
+			return nil, err
+		}
+		client.Version = utils.SNMPVersion3
+		client.UserName = ch.Details.Username
+		client.USM = usm
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version: %v", ch.Details.Version)
+	}
+	return client, nil
+}
+
+// addSNMPMetric adds the variable as a typed metric, returning false when the agent had no value for it
+func addSNMPMetric(cr *Result, name string, v utils.SNMPVariable) bool {
+	switch value := v.Value.(type) {
+	case int64:
+		cr.AddMetric(metric.NewMetric(name, "", metric.MetricNumber, value, ""))
+	case uint64:
+		if v.Type == utils.SNMPCounter64 {
+			cr.AddMetric(metric.NewMetric(name, "", metric.MetricNumber, value, ""))
+		} else {
+			// Counter32, Gauge32 and TimeTicks fit an int64
+			cr.AddMetric(metric.NewMetric(name, "", metric.MetricNumber, int64(value), ""))
+		}
+	case float32:
+		cr.AddMetric(metric.NewMetric(name, "", metric.MetricFloat, float64(value), ""))
+	case float64:
+		cr.AddMetric(metric.NewMetric(name, "", metric.MetricFloat, value, ""))
+	case string:
+		cr.AddMetric(metric.NewMetric(name, "", metric.MetricString, value, ""))
+	case []byte:
+		if v.Type != utils.BERTagOctetString {
+			return false
+		}
+		cr.AddMetric(metric.NewMetric(name, "", metric.MetricString, string(value), ""))
+	default:
+		// NoSuchObject, NoSuchInstance, EndOfMibView and Null carry no value
+		return false
+	}
+	return true
+}
+
+// setSNMPStatus reports a failed request, where only network errors are shortened
+func setSNMPStatus(crs *ResultSet, err error) {
+	if _, ok := err.(net.Error); ok {
+		crs.SetStatusFromError(err)
+	} else {
+		crs.SetStatus(err.Error())
+	}
+	crs.SetStateUnavailable()
+}
+
+// Run method implements Check.Run method for SNMP
+// please see Check interface for more information
+func (ch *SNMPCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+	// the timeout bounds the whole check, however many requests a walk takes
+	deadline := time.Now().Add(ch.GetTimeoutDuration())
+
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":    ch.GetLogPrefix(),
+		"address":   ip,
+		"version":   ch.Details.Version,
+		"operation": ch.Details.Operation,
+	}).Info("Running check")
+
+	if len(ch.Details.OIDs) == 0 {
+		crs.SetStatus(ErrSNMPNoOIDs.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	client, err := ch.client(deadline)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Setup Network
+	network := "udp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "udp4"
+	case protocheck.ResolverIPV6:
+		network = "udp6"
+	}
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultSNMPPort
+	}
+	nd := &net.Dialer{Deadline: deadline}
+	conn, err := nd.Dial(network, net.JoinHostPort(ip, strconv.FormatUint(port, 10)))
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	client.Conn = conn
+
+	values := 0
+	switch strings.ToLower(ch.Details.Operation) {
+	case "", SNMPOperationGet:
+		oids := make([]string, len(ch.Details.OIDs))
+		names := make(map[string]string)
+		for i, oid := range ch.Details.OIDs {
+			oids[i] = utils.NormalizeSNMPOID(oid.OID)
+			names[oids[i]] = oid.Name
+		}
+		// agents limit the number of variables in a single request
+		for start := 0; start < len(oids); start += SNMPMaxOIDs {
+			end := start + SNMPMaxOIDs
+			if end > len(oids) {
+				end = len(oids)
+			}
+			variables, err := client.Get(oids[start:end])
+			if err != nil {
+				setSNMPStatus(crs, err)
+				return crs, nil
+			}
+			for _, v := range variables {
+				name := names[v.OID]
+				if name == "" {
+					name = v.OID
+				}
+				if addSNMPMetric(cr, name, v) {
+					values++
+				}
+			}
+		}
+	case SNMPOperationWalk:
+		maxResults := ch.Details.MaxResults
+		if maxResults == 0 {
+			maxResults = DefaultSNMPMaxResults
+		}
+		walked := 0
+		for _, oid := range ch.Details.OIDs {
+			root := utils.NormalizeSNMPOID(oid.OID)
+			variables, err := client.Walk(root, SNMPMaxRepetitions, int(maxResults)-walked)
+			if err == utils.ErrSNMPTooManyVariables {
+				crs.SetStatus(fmt.Sprintf("walk exceeded max_results of %d", maxResults))
+				crs.SetStateUnavailable()
+				return crs, nil
+			}
+			if err != nil {
+				setSNMPStatus(crs, err)
+				return crs, nil
+			}
+			walked += len(variables)
+			prefix := oid.Name
+			if prefix == "" {
+				prefix = root
+			}
+			// each metric is named by the index of its OID beneath the root, such as ifInOctets.2
+			for _, v := range variables {
+				name := prefix + strings.TrimPrefix(v.OID, root)
+				if addSNMPMetric(cr, name, v) {
+					values++
+				}
+			}
+		}
+	default:
+		crs.SetStatus(fmt.Sprintf("unsupported operation: %v", ch.Details.Operation))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	if values == 0 {
+		crs.SetStatus(ErrSNMPNoValues.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("values", values)
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,354 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snmpTestUserName = "monitor"
+
+// snmpTestAgent is an in-process SNMPv2c agent serving GET, GETNEXT and GETBULK from a fixed MIB, which also serves
+// SNMPv3 requests of snmpTestUserName when it has a USM
+type snmpTestAgent struct {
+	conn      net.PacketConn
+	community string
+	usm       *utils.SNMPUSM
+	engineID  []byte
+	mib       []utils.SNMPVariable
+	// delay slows every response, and maxRepetitions caps those of GetBulkRequests, as a slow agent would
+	delay          time.Duration
+	maxRepetitions int64
+}
+
+func newSNMPTestAgent(t *testing.T, mib []utils.SNMPVariable, usm *utils.SNMPUSM) *snmpTestAgent {
+	a := listenSNMPTestAgent(t, mib, usm)
+	go a.serve()
+	return a
+}
+
+// listenSNMPTestAgent binds an agent that is yet to serve, such that it can be slowed first
+func listenSNMPTestAgent(t *testing.T, mib []utils.SNMPVariable, usm *utils.SNMPUSM) *snmpTestAgent {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	sort.Slice(mib, func(i, j int) bool { return utils.CompareSNMPOIDs(mib[i].OID, mib[j].OID) < 0 })
+
+	a := &snmpTestAgent{
+		conn:      conn,
+		community: "s3cret",
+		usm:       usm,
+		engineID:  []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 'a', 'g', 'e', 'n', 't'},
+		mib:       mib,
+	}
+	return a
+}
+
+func (a *snmpTestAgent) port() int {
+	return a.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (a *snmpTestAgent) close() {
+	a.conn.Close()
+}
+
+func (a *snmpTestAgent) get(oid string) utils.SNMPVariable {
+	for _, v := range a.mib {
+		if v.OID == oid {
+			return v
+		}
+	}
+	return utils.SNMPVariable{OID: oid, Type: utils.SNMPNoSuchObject}
+}
+
+func (a *snmpTestAgent) next(oid string) utils.SNMPVariable {
+	for _, v := range a.mib {
+		if utils.CompareSNMPOIDs(oid, v.OID) < 0 {
+			return v
+		}
+	}
+	return utils.SNMPVariable{OID: oid, Type: utils.SNMPEndOfMibView}
+}
+
+func (a *snmpTestAgent) respond(request utils.SNMPPDU) utils.SNMPPDU {
+	var variables []utils.SNMPVariable
+	for _, v := range request.Variables {
+		switch request.Type {
+		case utils.SNMPGetRequest:
+			variables = append(variables, a.get(v.OID))
+		case utils.SNMPGetNextRequest:
+			variables = append(variables, a.next(v.OID))
+		case utils.SNMPGetBulkRequest:
+			oid := v.OID
+			repetitions := request.ErrorIndex
+			if a.maxRepetitions > 0 && repetitions > a.maxRepetitions {
+				repetitions = a.maxRepetitions
+			}
+			for i := int64(0); i < repetitions; i++ {
+				next := a.next(oid)
+				variables = append(variables, next)
+				if next.Type == utils.SNMPEndOfMibView {
+					break
+				}
+				oid = next.OID
+			}
+		}
+	}
+	return utils.SNMPPDU{Type: utils.SNMPResponse, RequestID: request.RequestID, Variables: variables}
+}
+
+// report answers an SNMPv3 request that failed the USM with the usmStats counter of the failure
+func (a *snmpTestAgent) report(request *utils.SNMPMessage, counter string) *utils.SNMPMessage {
+	return &utils.SNMPMessage{
+		Version:     utils.SNMPVersion3,
+		MsgID:       request.MsgID,
+		EngineID:    a.engineID,
+		EngineBoots: 1,
+		EngineTime:  100,
+		PDU: utils.SNMPPDU{
+			Type:      utils.SNMPReport,
+			RequestID: request.PDU.RequestID,
+			Variables: []utils.SNMPVariable{{OID: counter, Type: utils.SNMPCounter32, Value: uint64(1)}},
+		},
+	}
+}
+
+func (a *snmpTestAgent) respondV3(request *utils.SNMPMessage, err error) *utils.SNMPMessage {
+	switch {
+	case a.usm == nil:
+		return nil
+	case err == utils.ErrSNMPWrongDigest:
+		return a.report(request, "1.3.6.1.6.3.15.1.1.5.0")
+	case err != nil:
+		return nil
+	case len(request.EngineID) == 0:
+		return a.report(request, "1.3.6.1.6.3.15.1.1.4.0")
+	case request.UserName != snmpTestUserName:
+		return a.report(request, "1.3.6.1.6.3.15.1.1.3.0")
+	}
+	return &utils.SNMPMessage{
+		Version:     utils.SNMPVersion3,
+		MsgID:       request.MsgID,
+		Flags:       request.Flags &^ utils.SNMPFlagReportable,
+		EngineID:    a.engineID,
+		EngineBoots: 1,
+		EngineTime:  100,
+		UserName:    request.UserName,
+		PDU:         a.respond(request.PDU),
+	}
+}
+
+func (a *snmpTestAgent) serve() {
+	buffer := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		request, err := utils.UnmarshalSNMPMessage(buffer[:n], a.usm)
+		if request == nil {
+			continue
+		}
+
+		var response *utils.SNMPMessage
+		if request.Version == utils.SNMPVersion3 {
+			response = a.respondV3(request, err)
+		} else if err == nil && request.Community == a.community {
+			response = &utils.SNMPMessage{
+				Version:   request.Version,
+				Community: request.Community,
+				PDU:       a.respond(request.PDU),
+			}
+		}
+		if response == nil {
+			continue
+		}
+		packed, err := response.Marshal(a.usm)
+		if err != nil {
+			continue
+		}
+		time.Sleep(a.delay)
+		a.conn.WriteTo(packed, addr)
+	}
+}
+
+func snmpTestMIB() []utils.SNMPVariable {
+	return []utils.SNMPVariable{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: utils.BERTagOctetString, Value: []byte("Test Switch")},
+		{OID: "1.3.6.1.2.1.1.3.0", Type: utils.SNMPTimeTicks, Value: uint64(123456)},
+		{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: utils.SNMPCounter32, Value: uint64(1000)},
+		{OID: "1.3.6.1.2.1.2.2.1.10.2", Type: utils.SNMPCounter32, Value: uint64(2000)},
+		{OID: "1.3.6.1.2.1.31.1.1.1.6.1", Type: utils.SNMPCounter64, Value: uint64(1) << 40},
+		{OID: "1.3.6.1.4.1.2021.10.1.5.1", Type: utils.BERTagInteger, Value: int64(42)},
+	}
+}
+
+func TestSNMPCheck_Get(t *testing.T) {
+	agent := newSNMPTestAgent(t, snmpTestMIB(), nil)
+	defer agent.close()
+
+	ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"version":"2c","community":"s3cret","oids":[
+		{"name":"sysDescr","oid":"1.3.6.1.2.1.1.1.0"},
+		{"name":"sysUpTime","oid":".1.3.6.1.2.1.1.3.0"},
+		{"name":"ifHCInOctets","oid":"1.3.6.1.2.1.31.1.1.1.6.1"},
+		{"name":"load","oid":"1.3.6.1.4.1.2021.10.1.5.1"},
+		{"name":"missing","oid":"1.3.6.1.2.1.1.9.0"}]}`, agent.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "values=4")
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("sysDescr", "", metric.MetricString, "Test Switch", ""),
+		ExpectMetric("sysUpTime", "", metric.MetricNumber, int64(123456), ""),
+		ExpectMetric("ifHCInOctets", "", metric.MetricNumber, uint64(1)<<40, ""),
+		ExpectMetric("load", "", metric.MetricNumber, int64(42), ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestSNMPCheck_Walk(t *testing.T) {
+	agent := newSNMPTestAgent(t, snmpTestMIB(), nil)
+	defer agent.close()
+
+	ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"community":"s3cret","operation":"walk","oids":[
+		{"name":"ifInOctets","oid":"1.3.6.1.2.1.2.2.1.10"}]}`, agent.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available, crs.Status)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("ifInOctets.1", "", metric.MetricNumber, int64(1000), ""),
+		ExpectMetric("ifInOctets.2", "", metric.MetricNumber, int64(2000), ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestSNMPCheck_WalkMaxResults(t *testing.T) {
+	agent := newSNMPTestAgent(t, snmpTestMIB(), nil)
+	defer agent.close()
+
+	ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"community":"s3cret","operation":"walk","max_results":3,"oids":[
+		{"name":"ifInOctets","oid":"1.3.6.1.2.1.2.2.1.10"},{"name":"mib2","oid":"1.3.6.1.2.1"}]}`, agent.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "walk exceeded max_results of 3", crs.Status)
+}
+
+func TestSNMPCheck_WalkTimeout(t *testing.T) {
+	agent := listenSNMPTestAgent(t, snmpTestMIB(), nil)
+	agent.delay = 600 * time.Millisecond
+	agent.maxRepetitions = 1
+	go agent.serve()
+	defer agent.close()
+
+	// each response arrives well within the timeout, but the walk as a whole does not
+	ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"community":"s3cret","operation":"walk","oids":[
+		{"name":"mib2","oid":"1.3.6.1.2.1"}]}`, agent.port()))
+	start := time.Now()
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "request timeout", crs.Status)
+	assert.True(t, time.Since(start) < 2500*time.Millisecond, "walk ran past the timeout")
+}
+
+func TestSNMPCheck_WrongCommunity(t *testing.T) {
+	agent := newSNMPTestAgent(t, snmpTestMIB(), nil)
+	defer agent.close()
+
+	ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"oids":[{"name":"sysDescr","oid":"1.3.6.1.2.1.1.1.0"}]}`,
+		agent.port()))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "timeout")
+}
+
+func TestSNMPCheck_UnsupportedPrivProtocol(t *testing.T) {
+	ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"version":"3","username":"monitor","auth_protocol":"SHA",
+		"auth_password":"authpass","priv_protocol":"ROT13","priv_password":"privpass",
+		"oids":[{"name":"sysDescr","oid":"1.3.6.1.2.1.1.1.0"}]}`, 161))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "unsupported priv_protocol: ROT13", crs.Status)
+}
+
+func TestSNMPCheck_V3(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		auth string
+		priv string
+	}{
+		{"noAuthNoPriv", "", ""},
+		{"authNoPriv", "MD5", ""},
+		{"MD5DES", "MD5", "DES"},
+		{"SHAAES", "SHA", "AES"},
+		{"SHA256AES256C", "SHA256", "AES256C"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			usm, err := utils.NewSNMPUSM(test.auth, "authpass", test.priv, "privpass")
+			require.NoError(t, err)
+			agent := newSNMPTestAgent(t, snmpTestMIB(), usm)
+			defer agent.close()
+
+			ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"version":"3","username":"monitor",
+				"auth_protocol":"`+test.auth+`","auth_password":"authpass",
+				"priv_protocol":"`+test.priv+`","priv_password":"privpass",
+				"oids":[{"name":"sysDescr","oid":"1.3.6.1.2.1.1.1.0"},{"name":"ifHCInOctets","oid":"1.3.6.1.2.1.31.1.1.1.6.1"}]}`, agent.port()))
+			crs, err := ch.Run()
+			require.NoError(t, err)
+
+			assert.True(t, crs.Available, crs.Status)
+			assert.Equal(t, "Test Switch", crs.Get(0).GetMetric("sysDescr").Value)
+			assert.Equal(t, uint64(1)<<40, crs.Get(0).GetMetric("ifHCInOctets").Value)
+		})
+	}
+}
+
+func TestSNMPCheck_V3Rejected(t *testing.T) {
+	usm, err := utils.NewSNMPUSM("SHA", "authpass", "AES", "privpass")
+	require.NoError(t, err)
+	agent := newSNMPTestAgent(t, snmpTestMIB(), usm)
+	defer agent.close()
+
+	for status, details := range map[string]string{
+		"wrong digest":      `"username":"monitor","auth_password":"wrongpass"`,
+		"unknown user name": `"username":"nobody","auth_password":"authpass"`,
+	} {
+		ch := newTestCheck(t, "remote.snmp", fmt.Sprintf(`{"port":%d,"version":"3",`+details+`,"auth_protocol":"SHA",
+			"priv_protocol":"AES","priv_password":"privpass","oids":[{"name":"sysDescr","oid":"1.3.6.1.2.1.1.1.0"}]}`, agent.port()))
+		crs, err := ch.Run()
+		require.NoError(t, err)
+
+		assert.False(t, crs.Available)
+		assert.Equal(t, status, crs.Status)
+	}
+}
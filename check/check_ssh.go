@@ -0,0 +1,313 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultSSHPort is the port used when the check details do not specify one
+	DefaultSSHPort = uint64(22)
+	// MaxSSHTranscriptLength bounds how much of each direction is retained to parse the version exchange and KEXINIT
+	MaxSSHTranscriptLength = 64 * 1024
+
+	sshMsgKexInit = 20
+	// the KEXINIT payload starts with the message number and a 16 byte cookie
+	sshKexInitHeaderLength = 17
+)
+
+var (
+	// ErrSSHHostKeyCaptured is used to abandon the handshake once the server has proven possession of its host key
+	ErrSSHHostKeyCaptured = errors.New("host key captured")
+	// ErrSSHKexInitMissing indicates the transcript did not contain a parsable version line and KEXINIT packet
+	ErrSSHKexInitMissing = errors.New("unable to parse key exchange init")
+)
+
+// SSHCheck conveys SSH checks
+type SSHCheck struct {
+	Base
+	protocheck.SSHCheckDetails
+}
+
+// NewSSHCheck - Constructor for an SSH Check
+func NewSSHCheck(base *Base) (Check, error) {
+	check := &SSHCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_ssh",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *SSHCheck) GenerateAddress() (string, error) {
+	port := ch.Details.Port
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10)), nil
+}
+
+// sshTranscript records the start of each direction of the connection. Everything up to and including the
+// KEXINIT packets is sent in the clear, so the negotiated algorithms can be derived from it.
+type sshTranscript struct {
+	net.Conn
+
+	mu      sync.Mutex
+	read    bytes.Buffer
+	written bytes.Buffer
+}
+
+func (t *sshTranscript) Read(b []byte) (int, error) {
+	n, err := t.Conn.Read(b)
+	t.mu.Lock()
+	if t.read.Len() < MaxSSHTranscriptLength {
+		t.read.Write(b[:n])
+	}
+	t.mu.Unlock()
+	return n, err
+}
+
+func (t *sshTranscript) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	if t.written.Len() < MaxSSHTranscriptLength {
+		t.written.Write(b)
+	}
+	t.mu.Unlock()
+	return t.Conn.Write(b)
+}
+
+func (t *sshTranscript) snapshot() (read []byte, written []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte(nil), t.read.Bytes()...), append([]byte(nil), t.written.Bytes()...)
+}
+
+// sshKexInit holds the algorithm name-lists of a KEXINIT message
+type sshKexInit struct {
+	KexAlgos            []string
+	HostKeyAlgos        []string
+	CiphersClientServer []string
+	CiphersServerClient []string
+	MACsClientServer    []string
+	MACsServerClient    []string
+}
+
+// parseSSHTranscript extracts the version line and the KEXINIT message that follows it
+func parseSSHTranscript(data []byte) (string, *sshKexInit, error) {
+	var version string
+	// the server may send other lines of text before the version line
+	for version == "" {
+		pos := bytes.IndexByte(data, '\n')
+		if pos < 0 {
+			return "", nil, ErrSSHKexInitMissing
+		}
+		line := strings.TrimRight(string(data[:pos]), "\r")
+		data = data[pos+1:]
+		if strings.HasPrefix(line, "SSH-") {
+			version = line
+		}
+	}
+
+	// binary packet: uint32 packet_length, byte padding_length, payload, padding
+	if len(data) < 5 {
+		return version, nil, ErrSSHKexInitMissing
+	}
+	packetLength := int(binary.BigEndian.Uint32(data))
+	paddingLength := int(data[4])
+	if packetLength > len(data)-4 || paddingLength+1 > packetLength {
+		return version, nil, ErrSSHKexInitMissing
+	}
+	payload := data[5 : 4+packetLength-paddingLength]
+	if len(payload) < sshKexInitHeaderLength || payload[0] != sshMsgKexInit {
+		return version, nil, ErrSSHKexInitMissing
+	}
+	payload = payload[sshKexInitHeaderLength:]
+
+	nameLists := make([][]string, 6)
+	for i := range nameLists {
+		if len(payload) < 4 {
+			return version, nil, ErrSSHKexInitMissing
+		}
+		length := int(binary.BigEndian.Uint32(payload))
+		if length > len(payload)-4 {
+			return version, nil, ErrSSHKexInitMissing
+		}
+		if length > 0 {
+			nameLists[i] = strings.Split(string(payload[4:4+length]), ",")
+		}
+		payload = payload[4+length:]
+	}
+
+	return version, &sshKexInit{
+		KexAlgos:            nameLists[0],
+		HostKeyAlgos:        nameLists[1],
+		CiphersClientServer: nameLists[2],
+		CiphersServerClient: nameLists[3],
+		MACsClientServer:    nameLists[4],
+		MACsServerClient:    nameLists[5],
+	}, nil
+}
+
+// negotiateSSHAlgorithm picks the first client algorithm also supported by the server, as specified by RFC 4253
+func negotiateSSHAlgorithm(client, server []string) string {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+func normalizeSSHFingerprint(fingerprint string) string {
+	return strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(fingerprint), "SHA256:"), "=")
+}
+
+// Run method implements Check.Run method for SSH
+// please see Check interface for more information
+func (ch *SSHCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	rawConn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	conn := &sshTranscript{Conn: rawConn}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+
+	// Key Exchange, which is abandoned as soon as the verified host key is presented so no authentication is attempted
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:    "rackspace-monitoring-poller",
+		Timeout: timeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return ErrSSHHostKeyCaptured
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	conn.Close()
+	if hostKey == nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	endtime := utils.NowTimestampMillis()
+
+	read, written := conn.snapshot()
+	banner, serverKexInit, err := parseSSHTranscript(read)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	_, clientKexInit, err := parseSSHTranscript(written)
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	fingerprint := ssh.FingerprintSHA256(hostKey)
+
+	cr.AddMetric(metric.NewMetric("banner", "", metric.MetricString, banner, ""))
+	cr.AddMetric(metric.NewMetric("kex_algorithm", "", metric.MetricString,
+		negotiateSSHAlgorithm(clientKexInit.KexAlgos, serverKexInit.KexAlgos), ""))
+	cr.AddMetric(metric.NewMetric("host_key_algorithm", "", metric.MetricString,
+		negotiateSSHAlgorithm(clientKexInit.HostKeyAlgos, serverKexInit.HostKeyAlgos), ""))
+	cr.AddMetric(metric.NewMetric("cipher", "", metric.MetricString,
+		negotiateSSHAlgorithm(clientKexInit.CiphersClientServer, serverKexInit.CiphersClientServer), ""))
+	cr.AddMetric(metric.NewMetric("mac", "", metric.MetricString,
+		negotiateSSHAlgorithm(clientKexInit.MACsClientServer, serverKexInit.MACsClientServer), ""))
+	cr.AddMetric(metric.NewMetric("host_key_type", "", metric.MetricString, hostKey.Type(), ""))
+	cr.AddMetric(metric.NewMetric("host_key_fingerprint", "", metric.MetricString, fingerprint, ""))
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Fingerprint Match
+	if ch.Details.Fingerprint != "" &&
+		normalizeSSHFingerprint(ch.Details.Fingerprint) != normalizeSSHFingerprint(fingerprint) {
+		crs.SetStatus("host key fingerprint mismatch: " + fingerprint)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Status Line
+	sl.Add("host_key_type", hostKey.Type())
+	sl.Add("duration", endtime-starttime)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSSHTestServer(t *testing.T) (net.Listener, ssh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-TestServer_1.0",
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("password rejected for %q", conn.User())
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// the poller hangs up during the handshake, so this is expected to fail
+		ssh.NewServerConn(conn, config)
+	}()
+
+	return listener, signer
+}
+
+func TestSSHCheck_Success(t *testing.T) {
+	listener, signer := newSSHTestServer(t)
+	defer listener.Close()
+
+	expected := ssh.FingerprintSHA256(signer.PublicKey())
+	crs := runTestCheck(t, "remote.ssh", fmt.Sprintf(`{"port":%d,"fingerprint":"%s"}`,
+		listener.Addr().(*net.TCPAddr).Port, expected))
+
+	require.True(t, crs.Available, crs.Status)
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"tt_connect", "duration", "kex_algorithm", "cipher", "mac"}, cr)
+
+	banner, _ := cr.GetMetric("banner").ToString()
+	assert.Equal(t, "SSH-2.0-TestServer_1.0", banner)
+	hostKeyType, _ := cr.GetMetric("host_key_type").ToString()
+	assert.Equal(t, "ecdsa-sha2-nistp256", hostKeyType)
+	hostKeyAlgorithm, _ := cr.GetMetric("host_key_algorithm").ToString()
+	assert.Equal(t, "ecdsa-sha2-nistp256", hostKeyAlgorithm)
+	fingerprint, _ := cr.GetMetric("host_key_fingerprint").ToString()
+	assert.Equal(t, expected, fingerprint)
+	kex, _ := cr.GetMetric("kex_algorithm").ToString()
+	assert.NotEmpty(t, kex)
+}
+
+func TestSSHCheck_FingerprintMismatch(t *testing.T) {
+	listener, signer := newSSHTestServer(t)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.ssh", fmt.Sprintf(`{"port":%d,"fingerprint":"%s"}`,
+		listener.Addr().(*net.TCPAddr).Port, "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "host key fingerprint mismatch: "+ssh.FingerprintSHA256(signer.PublicKey()), crs.Status)
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"regexp"
@@ -143,11 +144,24 @@ func (ch *TCPCheck) Run() (*ResultSet, error) {
 	starttime := utils.NowTimestampMillis()
 	addr, _ := ch.GenerateAddress()
 	log.WithFields(log.Fields{
-		"prefix":  ch.GetLogPrefix(),
-		"address": addr,
-		"ssl":     ch.Details.UseSSL,
+		"prefix":   ch.GetLogPrefix(),
+		"address":  addr,
+		"ssl":      ch.Details.UseSSL,
+		"starttls": ch.Details.StartTLS,
 	}).Info("Running check")
 
+	if ch.Details.UseSSL && ch.Details.StartTLS != "" {
+		crs.SetStatus(ErrTCPSSLAndStartTLS.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	script := len(ch.Details.Script) > 0
+	if script && (ch.Details.SendBody != "" || ch.Details.BannerMatch != "" || ch.Details.BodyMatch != "") {
+		crs.SetStatus(ErrTCPScriptExclusive.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
 	ctx := context.Background()
 	timeout := ch.GetTimeoutDuration()
 	nd := &net.Dialer{
@@ -164,10 +178,19 @@ func (ch *TCPCheck) Run() (*ResultSet, error) {
 		network = "tcp6"
 	}
 
+	// Setup TLS, which either starts with the connection or follows STARTTLS
+	var tlsConfig *tls.Config
+	if ch.Details.UseSSL || ch.Details.StartTLS != "" {
+		if tlsConfig, err = ch.newTLSConfig(ch.Details.TLSDetails, ch.serverName()); err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
 	// Connection
 	if ch.Details.UseSSL {
-		TLSconfig := &tls.Config{InsecureSkipVerify: true}
-		conn, err = dialContextWithDialer(ctx, nd, network, addr, TLSconfig)
+		conn, err = dialContextWithDialer(ctx, nd, network, addr, tlsConfig)
 	} else {
 		conn, err = dialContextWithDialer(ctx, nd, network, addr, nil)
 	}
@@ -189,6 +212,40 @@ func (ch *TCPCheck) Run() (*ResultSet, error) {
 	}).Debug("Setting deadline")
 	conn.SetDeadline(time.Now().Add(deadline))
 
+	// STARTTLS
+	if ch.Details.StartTLS != "" {
+		tlsConn, err := startTLS(conn, ch.Details.StartTLS, tlsConfig)
+		if err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		conn = tlsConn
+		cr.AddMetric(metric.NewMetric("tt_starttls", "", metric.MetricNumber, utils.NowTimestampMillis()-starttime, metric.UnitMilliseconds))
+	}
+
+	// Script
+	if script {
+		failed, err := ch.runScript(conn, crs, time.Now().Add(deadline))
+		endtime = utils.NowTimestampMillis()
+		cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			ch.AddTLSMetrics(cr, tlsConn.ConnectionState())
+		}
+		if err != nil {
+			cr.AddMetric(metric.NewMetric("steps", "", metric.MetricNumber, failed, ""))
+			cr.AddMetric(metric.NewMetric("failed_step", "", metric.MetricNumber, failed+1, ""))
+			crs.SetStatus(fmt.Sprintf("step %s failed: %v", tcpScriptLabel(failed, ch.Details.Script[failed]), err))
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		cr.AddMetric(metric.NewMetric("steps", "", metric.MetricNumber, len(ch.Details.Script), ""))
+		cr.AddMetric(metric.NewMetric("failed_step", "", metric.MetricNumber, 0, ""))
+		crs.SetStateAvailable()
+		crs.SetStatusSuccess()
+		return crs, nil
+	}
+
 	// Send Body
 	if len(ch.Details.SendBody) > 0 {
 		// TODO: this can throw an exception and stop the flow
@@ -252,8 +309,7 @@ func (ch *TCPCheck) Run() (*ResultSet, error) {
 	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
 
 	// TLS Metrics
-	if ch.Details.UseSSL {
-		tlsConn := conn.(*tls.Conn)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
 		ch.AddTLSMetrics(cr, tlsConn.ConnectionState())
 	}
 
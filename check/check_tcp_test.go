@@ -16,9 +16,12 @@
 package check_test
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"testing"
@@ -27,6 +30,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/racker/rackspace-monitoring-poller/check"
 	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -118,6 +122,94 @@ func TestTCP_TLSRunSuccess(t *testing.T) {
 	}
 }
 
+func TestTCP_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	clientCert, clientKey := pki.issue(t, "poller")
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", pki.serverConfig(t, "banner.example.com", true))
+	require.NoError(t, err)
+	listenPort := tlsListener.Addr().(*net.TCPAddr).Port
+
+	// Start TCP Server
+	server := utils.NewBannerServer()
+	go server.ServeTLS(tlsListener)
+
+	// Create Check
+	check := newTestCheck(t, "remote.tcp", map[string]interface{}{
+		"port":            listenPort,
+		"ssl":             true,
+		"banner_match":    "^SSH",
+		"ca_cert":         string(pki.CACert),
+		"client_cert":     string(clientCert),
+		"client_key":      string(clientKey),
+		"tls_server_name": "banner.example.com",
+		"tls_verify":      "verify_and_fail",
+	})
+
+	// Run check
+	crs, err := check.Run()
+	require.NoError(t, err)
+
+	// Shutdown server
+	server.Stop()
+	tlsListener.Close()
+
+	// Validate
+	assert.Equal(t, "success", crs.Status)
+	ValidateMetrics(t, []string{"duration", "tt_connect", "banner_match", "cert_subject"}, crs.Get(0))
+	assert.Nil(t, crs.Get(0).GetMetric("cert_error"))
+}
+
+func TestTCP_TLSVerifyAndFailRequiresServerName(t *testing.T) {
+	check := newTestCheck(t, "remote.tcp", `{"port":443,"ssl":true,"tls_verify":"verify_and_fail"}`)
+
+	crs, err := check.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "tls_server_name is required by verify_and_fail", crs.Status)
+}
+
+func TestTCP_TLSTargetHostname(t *testing.T) {
+	pki := newTestPKI(t)
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", pki.serverConfig(t, "localhost", false))
+	require.NoError(t, err)
+	listenPort := tlsListener.Addr().(*net.TCPAddr).Port
+
+	server := utils.NewBannerServer()
+	go server.ServeTLS(tlsListener)
+	defer server.Stop()
+
+	details, err := json.Marshal(map[string]interface{}{
+		"port":       listenPort,
+		"ssl":        true,
+		"ca_cert":    string(pki.CACert),
+		"tls_verify": "verify_and_fail",
+	})
+	require.NoError(t, err)
+	checkData := fmt.Sprintf(`{
+	  "id":"chTestTCP_TLSTargetHostname",
+	  "zone_id":"pzA",
+	  "entity_id":"enAAAAIPV4",
+	  "details":%s,
+	  "type":"remote.tcp",
+	  "timeout":15,
+	  "period":30,
+	  "target_hostname":"localhost",
+	  "target_resolver":"IPv4",
+	  "disabled":false
+	  }`, details)
+	check, err := check.NewCheck(context.Background(), []byte(checkData))
+	require.NoError(t, err)
+
+	crs, err := check.Run()
+	require.NoError(t, err)
+
+	// the target hostname is sent by SNI, so the certificate is verified against it
+	assert.Equal(t, "success", crs.Status)
+	assert.Equal(t, true, crs.Get(0).GetMetric("cert_hostname_match").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("cert_error"))
+}
+
 func TestTCPRunSuccess(t *testing.T) {
 	laddr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -208,3 +300,361 @@ func TestTCPRunFailureClosedPort(t *testing.T) {
 		t.Fatal("metric length should be 0")
 	}
 }
+
+// startPOPServer serves a POP3-like line protocol, where the password is secret and SLOW delays the response
+func startPOPServer(t *testing.T) (net.Listener, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				fmt.Fprint(conn, "+OK POP3 server ready v1.2\r\n")
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					switch line := scanner.Text(); {
+					case strings.HasPrefix(line, "USER "):
+						fmt.Fprint(conn, "+OK\r\n")
+					case line == "PASS secret":
+						fmt.Fprint(conn, "+OK 3 messages (1024 octets)\r\n")
+					case line == "SLOW":
+						time.Sleep(500 * time.Millisecond)
+						fmt.Fprint(conn, "+OK\r\n")
+					case line == "QUIT":
+						fmt.Fprint(conn, "+OK bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "-ERR invalid\r\n")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+func popScript(password string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"name": "greeting", "expect": `^\+OK POP3 server ready v(?P<version>\S+)\r\n`},
+		{"send": "USER bob\r\n", "expect": `^\+OK\r\n`},
+		{"name": "login", "send": "PASS " + password + "\r\n", "expect": `^\+OK (?P<messages>\d+) messages`, "timeout_ms": 300},
+		{"send": "QUIT\r\n", "expect": `\+OK bye`},
+	}
+}
+
+func TestTCPScript_Success(t *testing.T) {
+	listener, port := startPOPServer(t)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "script": popScript("secret")})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "success", crs.Status)
+	require.Equal(t, 5, crs.Length())
+	assert.Equal(t, 4, crs.Get(0).GetMetric("steps").Value)
+	assert.Equal(t, 0, crs.Get(0).GetMetric("failed_step").Value)
+	ValidateMetrics(t, []string{"tt_connect", "duration"}, crs.Get(0))
+
+	assert.Equal(t, "1.2", crs.Get(1).GetMetric("version").Value)
+	assert.Equal(t, "step_1", crs.Get(1).GetMetric("version").Dimension)
+	assert.Equal(t, "3", crs.Get(3).GetMetric("messages").Value)
+	for i := 1; i <= 4; i++ {
+		assert.Equal(t, fmt.Sprintf("step_%d", i), crs.Get(i).GetMetric("duration").Dimension)
+	}
+}
+
+func TestTCPScript_ExpectFailed(t *testing.T) {
+	listener, port := startPOPServer(t)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "script": popScript("wrong")})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, `step login failed: timed out waiting for "^\\+OK (?P<messages>\\d+) messages"`, crs.Status)
+	// the conversation stops at the failed step
+	assert.Equal(t, 4, crs.Length())
+	assert.Equal(t, 2, crs.Get(0).GetMetric("steps").Value)
+	assert.Equal(t, 3, crs.Get(0).GetMetric("failed_step").Value)
+	assert.Nil(t, crs.Get(3).GetMetric("messages"))
+}
+
+func TestTCPScript_StepTimeout(t *testing.T) {
+	listener, port := startPOPServer(t)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "script": []map[string]interface{}{
+		{"expect": `ready`},
+		{"send": "SLOW\r\n", "expect": `\+OK`, "timeout_ms": 100},
+	}})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, `step 2 failed: timed out waiting for "\\+OK"`, crs.Status)
+	duration, _ := crs.Get(2).GetMetric("duration").ToInt64()
+	assert.True(t, duration < 500, "duration %d", duration)
+}
+
+func TestTCPScript_ConnectionClosed(t *testing.T) {
+	listener, port := startPOPServer(t)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "script": []map[string]interface{}{
+		{"send": "QUIT\r\n", "expect": `bye\r\n`},
+		{"expect": `more`},
+	}})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, `step 2 failed: connection closed waiting for "more"`, crs.Status)
+}
+
+func TestTCPScript_ExclusiveWithSendBody(t *testing.T) {
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": 1, "script": popScript("secret"), "send_body": "hello"})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "script is mutually exclusive with send_body, banner_match and body_match", crs.Status)
+}
+
+// readUntil reads from the client until the data received ends with suffix
+func readUntil(r *bufio.Reader, suffix string) (string, error) {
+	var data []byte
+	for !strings.HasSuffix(string(data), suffix) {
+		c, err := r.ReadByte()
+		if err != nil {
+			return string(data), err
+		}
+		data = append(data, c)
+	}
+	return string(data), nil
+}
+
+// ldapExtendedResponse encodes the response to the StartTLS extended request of message ID 1
+func ldapExtendedResponse(code int64, diagnostic string) []byte {
+	return utils.NewBERElement(utils.BERTagSequence,
+		utils.NewBERInteger(utils.BERTagInteger, 1),
+		utils.NewBERElement(utils.BERClassApplication|utils.BERConstructed|24,
+			utils.NewBERInteger(utils.BERTagEnumerated, code),
+			utils.NewBERString(utils.BERTagOctetString, ""),
+			utils.NewBERString(utils.BERTagOctetString, diagnostic)))
+}
+
+// startTLSPreambles play the server side of each protocol's upgrade, reporting whether TLS was agreed
+var startTLSPreambles = map[string]func(t *testing.T, conn net.Conn, r *bufio.Reader) bool{
+	"smtp": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		fmt.Fprint(conn, "220 mail.example.com ESMTP\r\n")
+		line, _ := r.ReadString('\n')
+		assert.Equal(t, "EHLO localhost\r\n", line)
+		fmt.Fprint(conn, "250-mail.example.com\r\n250 STARTTLS\r\n")
+		line, _ = r.ReadString('\n')
+		assert.Equal(t, "STARTTLS\r\n", line)
+		fmt.Fprint(conn, "220 Ready to start TLS\r\n")
+		return true
+	},
+	"imap": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+		line, _ := r.ReadString('\n')
+		assert.Equal(t, "a001 STARTTLS\r\n", line)
+		fmt.Fprint(conn, "* CAPABILITY IMAP4rev1\r\na001 OK Begin TLS negotiation now\r\n")
+		return true
+	},
+	"pop3": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		fmt.Fprint(conn, "+OK POP3 ready\r\n")
+		line, _ := r.ReadString('\n')
+		assert.Equal(t, "STLS\r\n", line)
+		fmt.Fprint(conn, "+OK Begin TLS negotiation\r\n")
+		return true
+	},
+	"pop3_refused": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		fmt.Fprint(conn, "+OK POP3 ready\r\n")
+		r.ReadString('\n')
+		fmt.Fprint(conn, "-ERR TLS unavailable\r\n")
+		return false
+	},
+	"ftp": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		fmt.Fprint(conn, "220-Welcome\r\n220 FTP ready\r\n")
+		line, _ := r.ReadString('\n')
+		assert.Equal(t, "AUTH TLS\r\n", line)
+		fmt.Fprint(conn, "234 AUTH TLS successful\r\n")
+		return true
+	},
+	"ldap": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		request, err := utils.ReadBERElement(r)
+		require.NoError(t, err)
+		assert.Contains(t, string(request.Value), "1.3.6.1.4.1.1466.20037")
+		conn.Write(ldapExtendedResponse(0, ""))
+		return true
+	},
+	"ldap_refused": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		utils.ReadBERElement(r)
+		conn.Write(ldapExtendedResponse(2, "TLS already established"))
+		return false
+	},
+	"xmpp": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		header, _ := readUntil(r, "version='1.0'>")
+		assert.Contains(t, header, "to='tls.example.com'")
+		fmt.Fprint(conn, "<?xml version='1.0'?><stream:stream from='tls.example.com' id='s1' xmlns='jabber:client' "+
+			"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'><stream:features>"+
+			"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+		readUntil(r, "xmpp-tls'/>")
+		fmt.Fprint(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		return true
+	},
+	"postgresql": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		request := make([]byte, 8)
+		io.ReadFull(r, request)
+		assert.Equal(t, []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, request)
+		conn.Write([]byte{'S'})
+		return true
+	},
+	"postgresql_refused": func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+		io.ReadFull(r, make([]byte, 8))
+		conn.Write([]byte{'N'})
+		return false
+	},
+}
+
+// startStartTLSServer accepts connections that are upgraded to TLS once the preamble agrees
+func startStartTLSServer(t *testing.T, config *tls.Config, preamble func(*testing.T, net.Conn, *bufio.Reader) bool) (net.Listener, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if preamble(t, conn, bufio.NewReader(conn)) {
+				tlsConn := tls.Server(conn, config)
+				tlsConn.Handshake()
+				tlsConn.Close()
+			}
+			conn.Close()
+		}
+	}()
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestTCP_StartTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	config := pki.serverConfig(t, "tls.example.com", false)
+
+	for _, protocol := range []string{"smtp", "imap", "pop3", "ftp", "ldap", "xmpp", "postgresql"} {
+		t.Run(protocol, func(t *testing.T) {
+			listener, port := startStartTLSServer(t, config, startTLSPreambles[protocol])
+			defer listener.Close()
+
+			crs := runTestCheck(t, "remote.tcp", map[string]interface{}{
+				"port":            port,
+				"starttls":        protocol,
+				"ca_cert":         string(pki.CACert),
+				"tls_server_name": "tls.example.com",
+			})
+
+			assert.True(t, crs.Available, crs.Status)
+			assert.Equal(t, "success", crs.Status)
+			ValidateMetrics(t, []string{"tt_connect", "tt_starttls", "duration", "ssl_session_version", "cert_subject"}, crs.Get(0))
+			assert.Nil(t, crs.Get(0).GetMetric("cert_error"))
+		})
+	}
+}
+
+func TestTCP_StartTLSRefused(t *testing.T) {
+	pki := newTestPKI(t)
+	config := pki.serverConfig(t, "tls.example.com", false)
+
+	for protocol, status := range map[string]string{
+		"pop3":       "STARTTLS refused: -ERR TLS unavailable",
+		"ldap":       "STARTTLS refused with result code 2: TLS already established",
+		"postgresql": "STARTTLS refused",
+	} {
+		t.Run(protocol, func(t *testing.T) {
+			listener, port := startStartTLSServer(t, config, startTLSPreambles[protocol+"_refused"])
+			defer listener.Close()
+
+			crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "starttls": protocol})
+
+			assert.False(t, crs.Available)
+			assert.Equal(t, status, crs.Status)
+		})
+	}
+}
+
+func TestTCP_StartTLSXMPPStream(t *testing.T) {
+	for name, test := range map[string]struct {
+		serverName string
+		to         string
+	}{
+		"address": {"", ""},
+		"escaped": {"it's.example.com", " to='it&#39;s.example.com'"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			headers := make(chan string, 1)
+			listener, port := startStartTLSServer(t, nil, func(t *testing.T, conn net.Conn, r *bufio.Reader) bool {
+				header, _ := readUntil(r, "version='1.0'>")
+				headers <- header
+				// features without STARTTLS are self-closing
+				fmt.Fprint(conn, "<?xml version='1.0'?><stream:stream from='example.com' id='s1' xmlns='jabber:client' "+
+					"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'><stream:features/>")
+				return false
+			})
+			defer listener.Close()
+
+			details := map[string]interface{}{"starttls": "xmpp"}
+			if test.serverName != "" {
+				details["tls_server_name"] = test.serverName
+			}
+			details["port"] = port
+			crs := runTestCheck(t, "remote.tcp", details)
+
+			assert.False(t, crs.Available)
+			assert.Equal(t, "STARTTLS not supported", crs.Status)
+			assert.Equal(t, "<?xml version='1.0'?><stream:stream"+test.to+" xmlns='jabber:client' "+
+				"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", <-headers)
+		})
+	}
+}
+
+func TestTCP_StartTLSInvalid(t *testing.T) {
+	listener, port := startPOPServer(t)
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "starttls": "gopher"})
+	assert.False(t, crs.Available)
+	assert.Equal(t, "unsupported starttls gopher", crs.Status)
+
+	crs = runTestCheck(t, "remote.tcp", map[string]interface{}{"port": port, "starttls": "pop3", "ssl": true})
+	assert.False(t, crs.Available)
+	assert.Equal(t, "ssl and starttls are mutually exclusive", crs.Status)
+}
+
+func TestTCP_StartTLSWithScript(t *testing.T) {
+	pki := newTestPKI(t)
+	config := pki.serverConfig(t, "tls.example.com", false)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if startTLSPreambles["pop3"](t, conn, bufio.NewReader(conn)) {
+			tlsConn := tls.Server(conn, config)
+			fmt.Fprint(tlsConn, "+OK secured\r\n")
+			tlsConn.Close()
+		}
+	}()
+
+	crs := runTestCheck(t, "remote.tcp", map[string]interface{}{
+		"port":     listener.Addr().(*net.TCPAddr).Port,
+		"starttls": "pop3",
+		"script":   []map[string]interface{}{{"expect": `\+OK (?P<state>\w+)`}},
+	})
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, "secured", crs.Get(1).GetMetric("state").Value)
+	ValidateMetrics(t, []string{"ssl_session_version"}, crs.Get(0))
+}
@@ -18,7 +18,16 @@ package check_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
 	"testing"
 	"time"
 
@@ -182,3 +191,224 @@ func AssertMetrics(t *testing.T, expected []*ExpectedMetric, actual map[string]*
 
 	}
 }
+
+// newTestCheck creates a check of the type targeting 127.0.0.1 with a timeout of 2 seconds, where details is either
+// JSON or a value encoded as JSON
+func newTestCheck(t *testing.T, checkType string, details interface{}) check.Check {
+	detailsJSON, ok := details.(string)
+	if !ok {
+		encoded, err := json.Marshal(details)
+		require.NoError(t, err)
+		detailsJSON = string(encoded)
+	}
+	checkData := fmt.Sprintf(`{
+	  "id":"chTest",
+	  "zone_id":"pzA",
+	  "entity_id":"enAAAAIPV4",
+	  "details":%s,
+	  "type":"%s",
+	  "timeout":2,
+	  "period":30,
+	  "ip_addresses":{"default":"127.0.0.1"},
+	  "target_alias":"default",
+	  "target_hostname":"",
+	  "target_resolver":"IPv4",
+	  "disabled":false
+	  }`, detailsJSON, checkType)
+	ch, err := check.NewCheck(context.Background(), []byte(checkData))
+	require.NoError(t, err)
+	return ch
+}
+
+// runTestCheck runs a check created by newTestCheck
+func runTestCheck(t *testing.T, checkType string, details interface{}) *check.ResultSet {
+	crs, err := newTestCheck(t, checkType, details).Run()
+	require.NoError(t, err)
+	return crs
+}
+
+// testPKI issues certificates signed by a CA that only exists for the duration of a test
+type testPKI struct {
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	// CACert is the PEM encoding of the CA's certificate
+	CACert []byte
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testPKI{
+		caCert: cert,
+		caKey:  key,
+		CACert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial: 1,
+	}
+}
+
+// issue creates a certificate for the name, and 127.0.0.1, which is usable by both servers and clients. The PEM
+// encoding of the certificate and its key are returned.
+func (p *testPKI) issue(t *testing.T, name string) ([]byte, []byte) {
+	return p.issueUntil(t, name, time.Now().Add(24*time.Hour))
+}
+
+// issueUntil creates a certificate as issue does, which expires at notAfter
+func (p *testPKI) issueUntil(t *testing.T, name string, notAfter time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.caCert, &key.PublicKey, p.caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// serverConfig creates the configuration of a server presenting a certificate for the name, which requires clients
+// to present a certificate issued by the CA when requireClientCert
+func (p *testPKI) serverConfig(t *testing.T, name string, requireClientCert bool) *tls.Config {
+	certPEM, keyPEM := p.issue(t, name)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if requireClientCert {
+		config.ClientCAs = x509.NewCertPool()
+		config.ClientCAs.AddCert(p.caCert)
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+// intermediate creates a CA for the name, signed by this CA, which expires at notAfter
+func (p *testPKI) intermediate(t *testing.T, name string, notAfter time.Time) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(p.serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.caCert, &key.PublicKey, p.caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testPKI{
+		caCert: cert,
+		caKey:  key,
+		CACert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial: 1,
+	}
+}
+
+// leaf issues a certificate for the name, as parsed
+func (p *testPKI) leaf(t *testing.T, name string) *x509.Certificate {
+	certPEM, _ := p.issue(t, name)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestBase_AddTLSMetrics(t *testing.T) {
+	pki := newTestPKI(t)
+	intermediateExpiry := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	intermediate := pki.intermediate(t, "Test Intermediate", intermediateExpiry)
+	leaf := intermediate.leaf(t, "example.com")
+
+	var base check.Base
+	cr := check.NewResult()
+	tlsMetrics := base.AddTLSMetrics(cr, tls.ConnectionState{
+		Version:          0x0304,
+		CipherSuite:      0x1301,
+		ServerName:       "example.com",
+		PeerCertificates: []*x509.Certificate{leaf, intermediate.caCert},
+		OCSPResponse:     []byte{0x30},
+	})
+
+	// the test CA is not among the system roots
+	assert.False(t, tlsMetrics.Verified)
+	assert.True(t, tlsMetrics.HostnameMatched)
+	assert.True(t, intermediateExpiry.Equal(tlsMetrics.Expiry))
+
+	assert.Equal(t, "tls1.3", cr.GetMetric("ssl_session_version").Value)
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", cr.GetMetric("ssl_session_cipher").Value)
+	assert.Equal(t, true, cr.GetMetric("ocsp_stapled").Value)
+	assert.Equal(t, true, cr.GetMetric("cert_hostname_match").Value)
+	assert.Equal(t, "/CN=Test Intermediate", cr.GetMetric("cert_issuer").Value)
+	assert.Equal(t, 2, cr.GetMetric("cert_chain_length").Value)
+	assert.Equal(t, intermediateExpiry.Unix(), cr.GetMetric("cert_chain_end").Value)
+	assert.Equal(t, "/CN=Test CA", cr.GetMetric("cert_intermediate_1_issuer").Value)
+	assert.Equal(t, intermediateExpiry.Unix(), cr.GetMetric("cert_intermediate_1_end").Value)
+	chainEndIn, _ := cr.GetMetric("cert_chain_end_in").ToInt64()
+	assert.True(t, IsInRange(chainEndIn, int64(2*time.Hour/time.Second), 2))
+	assert.NotNil(t, cr.GetMetric("cert_error"))
+}
+
+func TestBase_AddTLSMetrics_HostnameMismatch(t *testing.T) {
+	pki := newTestPKI(t)
+
+	var base check.Base
+	cr := check.NewResult()
+	tlsMetrics := base.AddTLSMetrics(cr, tls.ConnectionState{
+		Version:          tls.VersionTLS12,
+		CipherSuite:      tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		ServerName:       "other.example.com",
+		PeerCertificates: []*x509.Certificate{pki.leaf(t, "example.com")},
+	})
+
+	assert.False(t, tlsMetrics.HostnameMatched)
+	assert.Equal(t, "tls1.2", cr.GetMetric("ssl_session_version").Value)
+	assert.Equal(t, "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256", cr.GetMetric("ssl_session_cipher").Value)
+	assert.Equal(t, false, cr.GetMetric("ocsp_stapled").Value)
+	assert.Equal(t, false, cr.GetMetric("cert_hostname_match").Value)
+	assert.Equal(t, 1, cr.GetMetric("cert_chain_length").Value)
+	assert.Equal(t, cr.GetMetric("cert_end").Value, cr.GetMetric("cert_chain_end").Value)
+	assert.Nil(t, cr.GetMetric("cert_intermediate_1_issuer"))
+}
+
+func TestBase_AddTLSMetrics_UnknownCipherSuite(t *testing.T) {
+	pki := newTestPKI(t)
+
+	var base check.Base
+	cr := check.NewResult()
+	base.AddTLSMetrics(cr, tls.ConnectionState{
+		Version:          0x0305,
+		CipherSuite:      0x00ff,
+		PeerCertificates: []*x509.Certificate{pki.leaf(t, "example.com")},
+	})
+
+	assert.Equal(t, "-", cr.GetMetric("ssl_session_version").Value)
+	assert.Equal(t, "0x00FF", cr.GetMetric("ssl_session_cipher").Value)
+	// the hostname is unknown without SNI
+	assert.Nil(t, cr.GetMetric("cert_hostname_match"))
+}
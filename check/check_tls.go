@@ -0,0 +1,222 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// TLSExpiryOK is reported by expiry_state when the certificates expire beyond the thresholds
+	TLSExpiryOK = "ok"
+	// TLSExpiryWarning is reported by expiry_state when a certificate expires within warn_days
+	TLSExpiryWarning = "warning"
+	// TLSExpiryCritical is reported by expiry_state when a certificate has expired or expires within critical_days
+	TLSExpiryCritical = "critical"
+)
+
+// tlsClientCertWait bounds the wait for a TLS 1.3 server to reject the client certificate
+const tlsClientCertWait = 500 * time.Millisecond
+
+// ErrTLSNoPort indicates the check details did not give the port of the TLS service
+var ErrTLSNoPort = errors.New("port is required")
+
+// TLSCheck conveys TLS checks, which report on the certificates presented by the handshake
+type TLSCheck struct {
+	Base
+	protocheck.TLSCheckDetails
+}
+
+// NewTLSCheck - Constructor for a TLS Check
+func NewTLSCheck(base *Base) (Check, error) {
+	check := &TLSCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_tls",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// tlsExpiryState classifies the time remaining until expiry against the thresholds, in days, where zero disables
+// a threshold
+func tlsExpiryState(remaining time.Duration, warnDays, criticalDays uint64) string {
+	const day = 24 * time.Hour
+	switch {
+	case remaining <= 0:
+		return TLSExpiryCritical
+	case criticalDays > 0 && remaining < time.Duration(criticalDays)*day:
+		return TLSExpiryCritical
+	case warnDays > 0 && remaining < time.Duration(warnDays)*day:
+		return TLSExpiryWarning
+	}
+	return TLSExpiryOK
+}
+
+// confirmTLSClientCert waits briefly for the server to reject the client certificate, where the server sending
+// data, closing the connection or remaining silent indicates the certificate was accepted
+func confirmTLSClientCert(conn *tls.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(tlsClientCertWait))
+	_, err := conn.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return nil
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Run method implements Check.Run method for TLS
+// please see Check interface for more information
+func (ch *TLSCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(ip, strconv.FormatUint(ch.Details.Port, 10))
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+	}).Info("Running check")
+
+	if ch.Details.Port == 0 {
+		crs.SetStatus(ErrTLSNoPort.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Setup TLS
+	tlsConfig, err := ch.newTLSConfig(ch.Details.TLSDetails, ch.serverName())
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	tlsConfig.NextProtos = ch.Details.ALPN
+	clientCertRequested := false
+	tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		clientCertRequested = true
+		if len(tlsConfig.Certificates) > 0 {
+			return &tlsConfig.Certificates[0], nil
+		}
+		return &tls.Certificate{}, nil
+	}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+	rawConn, err := dialContextWithDialer(context.Background(), nd, network, addr, nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer rawConn.Close()
+	connectEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectEndTime-starttime, metric.UnitMilliseconds))
+
+	// Handshake
+	rawConn.SetDeadline(time.Now().Add(timeout))
+	conn := tls.Client(rawConn, tlsConfig)
+	if err := conn.Handshake(); err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	state := conn.ConnectionState()
+	if clientCertRequested && state.Version == tlsVersion13 {
+		// a TLS 1.3 server only rejects the client certificate after the client considers the handshake complete
+		if err := confirmTLSClientCert(conn); err != nil {
+			crs.SetStatusFromError(err)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("tt_handshake", "", metric.MetricNumber, endtime-connectEndTime, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// TLS Metrics
+	tlsMetrics := ch.AddTLSMetrics(cr, state)
+	cr.AddMetric(metric.NewMetric("alpn_protocol", "", metric.MetricString, state.NegotiatedProtocol, ""))
+	cr.AddMetric(metric.NewMetric("client_cert_requested", "", metric.MetricBool, clientCertRequested, ""))
+
+	// Expiry
+	remaining := tlsMetrics.Expiry.Sub(time.Now())
+	days := int64(remaining / (24 * time.Hour))
+	expiryState := tlsExpiryState(remaining, ch.Details.WarnDays, ch.Details.CriticalDays)
+	cr.AddMetric(metric.NewMetric("days_to_expiry", "", metric.MetricNumber, days, ""))
+	cr.AddMetric(metric.NewMetric("expiry_state", "", metric.MetricString, expiryState, ""))
+
+	if expiryState == TLSExpiryCritical {
+		if remaining <= 0 {
+			crs.SetStatus(fmt.Sprintf("certificate expired %d days ago", -days))
+		} else {
+			crs.SetStatus(fmt.Sprintf("certificate expires in %d days", days))
+		}
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Status Line
+	sl.Add("version", tlsVersionName(state.Version))
+	sl.Add("days_to_expiry", days)
+	sl.Add("duration", endtime-starttime)
+	if expiryState == TLSExpiryWarning {
+		sl.AddOption("expiry_warning")
+	}
+	if !tlsMetrics.Verified {
+		sl.AddOption("sslerror")
+	}
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
@@ -0,0 +1,172 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tlsTestServerName = "tls.example.com"
+
+// startTLSServer accepts connections on a local port, closing each once the handshake completes
+func startTLSServer(t *testing.T, config *tls.Config) (net.Listener, int) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+// expiringServerConfig creates the configuration of a server presenting a certificate that expires at notAfter
+func expiringServerConfig(t *testing.T, pki *testPKI, notAfter time.Time) *tls.Config {
+	certPEM, keyPEM := pki.issueUntil(t, tlsTestServerName, notAfter)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}
+}
+
+// expiryDetails configures a check of the port trusting the PKI, with thresholds of 30 and 7 days
+func expiryDetails(pki *testPKI, port int) map[string]interface{} {
+	return map[string]interface{}{
+		"port":            port,
+		"ca_cert":         string(pki.CACert),
+		"tls_server_name": tlsTestServerName,
+		"warn_days":       30,
+		"critical_days":   7,
+	}
+}
+
+func TestTLS_Success(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startTLSServer(t, expiringServerConfig(t, pki, time.Now().Add(90*24*time.Hour+time.Hour)))
+	defer listener.Close()
+
+	details := expiryDetails(pki, port)
+	details["alpn"] = []string{"h2"}
+	crs := runTestCheck(t, "remote.tls", details)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "days_to_expiry=90")
+	assert.NotContains(t, crs.Status, "sslerror")
+	cr := crs.Get(0)
+	ValidateMetrics(t, []string{"tt_connect", "tt_handshake", "duration", "ssl_session_version", "ssl_session_cipher",
+		"cert_chain_length", "cert_chain_end_in"}, cr)
+	assert.Nil(t, cr.GetMetric("cert_error"))
+	assert.Equal(t, "h2", cr.GetMetric("alpn_protocol").Value)
+	assert.Equal(t, false, cr.GetMetric("client_cert_requested").Value)
+	assert.Equal(t, true, cr.GetMetric("cert_hostname_match").Value)
+	assert.Equal(t, int64(90), cr.GetMetric("days_to_expiry").Value)
+	assert.Equal(t, check.TLSExpiryOK, cr.GetMetric("expiry_state").Value)
+}
+
+func TestTLS_ExpiryWarning(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startTLSServer(t, expiringServerConfig(t, pki, time.Now().Add(20*24*time.Hour+time.Hour)))
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tls", expiryDetails(pki, port))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "days_to_expiry=20")
+	assert.Contains(t, crs.Status, "expiry_warning")
+	assert.Equal(t, check.TLSExpiryWarning, crs.Get(0).GetMetric("expiry_state").Value)
+}
+
+func TestTLS_ExpiryCritical(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startTLSServer(t, expiringServerConfig(t, pki, time.Now().Add(3*24*time.Hour+time.Hour)))
+	defer listener.Close()
+
+	crs := runTestCheck(t, "remote.tls", expiryDetails(pki, port))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "certificate expires in 3 days", crs.Status)
+	assert.Equal(t, check.TLSExpiryCritical, crs.Get(0).GetMetric("expiry_state").Value)
+}
+
+func TestTLS_Expired(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startTLSServer(t, expiringServerConfig(t, pki, time.Now().Add(-2*24*time.Hour-time.Hour)))
+	defer listener.Close()
+
+	// an expired certificate is critical without thresholds
+	crs := runTestCheck(t, "remote.tls", map[string]interface{}{"port": port, "tls_verify": "skip"})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "certificate expired 2 days ago", crs.Status)
+	assert.Equal(t, int64(-2), crs.Get(0).GetMetric("days_to_expiry").Value)
+}
+
+func TestTLS_ClientCert(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startTLSServer(t, pki.serverConfig(t, tlsTestServerName, true))
+	defer listener.Close()
+
+	clientCert, clientKey := pki.issue(t, "poller.example.com")
+	details := expiryDetails(pki, port)
+	details["client_cert"] = string(clientCert)
+	details["client_key"] = string(clientKey)
+	details["warn_days"] = 0
+	details["critical_days"] = 0
+	crs := runTestCheck(t, "remote.tls", details)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Nil(t, crs.Get(0).GetMetric("cert_error"))
+	assert.Equal(t, true, crs.Get(0).GetMetric("client_cert_requested").Value)
+}
+
+func TestTLS_ClientCertRequired(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, port := startTLSServer(t, pki.serverConfig(t, tlsTestServerName, true))
+	defer listener.Close()
+
+	clientCert, clientKey := pki.issue(t, "poller.example.com")
+	untrusted := newTestPKI(t)
+	untrustedCert, untrustedKey := untrusted.issue(t, "poller.example.com")
+	for name, details := range map[string]map[string]interface{}{
+		"none":      {"ca_cert": string(pki.CACert), "tls_server_name": tlsTestServerName},
+		"untrusted": {"client_cert": string(untrustedCert), "client_key": string(untrustedKey), "tls_verify": "skip"},
+		"trusted":   {"client_cert": string(clientCert), "client_key": string(clientKey), "tls_verify": "skip"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			details["port"] = port
+			crs := runTestCheck(t, "remote.tls", details)
+			assert.Equal(t, name == "trusted", crs.Available, crs.Status)
+		})
+	}
+}
+
+func TestTLS_NoPort(t *testing.T) {
+	crs := runTestCheck(t, "remote.tls", map[string]interface{}{})
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "port is required", crs.Status)
+}
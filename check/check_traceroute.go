@@ -0,0 +1,245 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTracerouteCount   = 3
+	defaultTracerouteMaxHops = 30
+
+	// TracerouteNoResponse is the address reported for a hop where none of the probes were answered
+	TracerouteNoResponse = "*"
+)
+
+// ErrTTLNotSupported indicates the pinger created by PingerFactory is unable to limit the TTL of its packets
+var ErrTTLNotSupported = errors.New("pinger does not support TTL")
+
+// TracerouteCheck conveys traceroute checks, where each hop is reported as a result dimensioned by hop number
+type TracerouteCheck struct {
+	Base
+	protocheck.TracerouteCheckDetails
+
+	// previousPath is the address of each hop seen by the previous run
+	previousPath []string
+}
+
+// NewTracerouteCheck - Constructor for a traceroute Check
+func NewTracerouteCheck(base *Base) (Check, error) {
+	check := &TracerouteCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_traceroute",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// tracerouteHop accumulates the probes sent to a single hop
+type tracerouteHop struct {
+	peer     string
+	received int
+	totalRTT time.Duration
+	reached  bool
+}
+
+// tracerouteDimension names the dimension of a hop's metrics
+func tracerouteDimension(ttl int) string {
+	return fmt.Sprintf("hop_%d", ttl)
+}
+
+// pathChanged compares two paths hop by hop, where hops that did not respond in either run match any address
+func pathChanged(previous, current []string) bool {
+	if len(previous) != len(current) {
+		return true
+	}
+	for i := range current {
+		if previous[i] != current[i] && previous[i] != TracerouteNoResponse && current[i] != TracerouteNoResponse {
+			return true
+		}
+	}
+	return false
+}
+
+// Run method implements Check.Run method for traceroute
+// please see Check interface for more information
+func (ch *TracerouteCheck) Run() (*ResultSet, error) {
+	targetIP, err := ch.GetTargetIP()
+	if err != nil {
+		return nil, err
+	}
+
+	var ipVersion string
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV6:
+		ipVersion = PingerIPv6
+	case protocheck.ResolverIPV4:
+		ipVersion = PingerIPv4
+	}
+
+	pinger, err := PingerFactory(ch.GetID(), targetIP, ipVersion)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":   ch.GetLogPrefix(),
+			"targetIP": targetIP,
+		}).Error("Failed to create pinger")
+		return nil, err
+	}
+	defer pinger.Close()
+	ttlPinger, ok := pinger.(TTLPinger)
+	if !ok {
+		return nil, ErrTTLNotSupported
+	}
+
+	count := int(ch.Details.Count)
+	if count <= 0 {
+		count = defaultTracerouteCount
+	}
+	maxHops := int(ch.Details.MaxHops)
+	if maxHops <= 0 {
+		maxHops = defaultTracerouteMaxHops
+	}
+	timeoutDuration := ch.GetTimeoutDuration()
+	deadline := time.Now().Add(timeoutDuration)
+	perProbeDuration := utils.MinOfDurations(1*time.Second, timeoutDuration/time.Duration(count*maxHops))
+
+	log.WithFields(log.Fields{
+		"prefix":           ch.GetLogPrefix(),
+		"targetIP":         targetIP,
+		"ipVersion":        ipVersion,
+		"maxHops":          maxHops,
+		"perProbeDuration": perProbeDuration,
+	}).Info("Running check")
+
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+
+	var probeErr error
+	var path []string
+	reached := false
+	seq := 0
+
+hopLoop:
+	for ttl := 1; ttl <= maxHops && !reached; ttl++ {
+		if time.Now().After(deadline) {
+			log.WithFields(log.Fields{
+				"prefix":   ch.GetLogPrefix(),
+				"targetIP": targetIP,
+				"ttl":      ttl,
+			}).Debug("Reached overall timeout")
+			break hopLoop
+		}
+
+		hop := tracerouteHop{peer: TracerouteNoResponse}
+		for i := 0; i < count; i++ {
+			seq++
+			resp := ttlPinger.PingTTL(seq, ttl, perProbeDuration)
+			if resp.Err != nil {
+				if !resp.Timeout {
+					// Latch non-timeout errors, such as a lack of privileges, since later probes will fail likewise
+					probeErr = resp.Err
+					break hopLoop
+				}
+				continue
+			}
+			if resp.Seq != seq {
+				// a late response to an earlier probe
+				continue
+			}
+			hop.received++
+			hop.totalRTT += resp.Rtt
+			if resp.Peer != nil {
+				hop.peer = resp.Peer.String()
+			}
+			if !resp.TTLExceeded {
+				hop.reached = true
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"prefix":   ch.GetLogPrefix(),
+			"targetIP": targetIP,
+			"ttl":      ttl,
+			"hop":      hop,
+		}).Debug("Probed hop")
+
+		dimension := tracerouteDimension(ttl)
+		hopResult := NewResult(
+			metric.NewMetric("address", dimension, metric.MetricString, hop.peer, ""),
+			metric.NewPercentMetricFromInt("loss", dimension, count-hop.received, count),
+		)
+		if hop.received > 0 {
+			rtt := hop.totalRTT / time.Duration(hop.received)
+			hopResult.AddMetric(metric.NewMetric("rtt", dimension, metric.MetricFloat, utils.ScaleFractionalDuration(rtt, time.Second), metric.UnitSeconds))
+		}
+		crs.Add(hopResult)
+
+		path = append(path, hop.peer)
+		reached = hop.reached
+	}
+
+	if probeErr != nil {
+		crs.SetStatusFromError(probeErr)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// the first run has nothing to compare against, so reports the path as unchanged
+	changed := ch.previousPath != nil && pathChanged(ch.previousPath, path)
+	// a hop that did not respond is remembered by the address last seen there
+	for i := range path {
+		if path[i] == TracerouteNoResponse && i < len(ch.previousPath) {
+			path[i] = ch.previousPath[i]
+		}
+	}
+	ch.previousPath = path
+
+	cr.AddMetric(metric.NewMetric("hops", "", metric.MetricNumber, len(path), ""))
+	cr.AddMetric(metric.NewMetric("reached", "", metric.MetricBool, reached, ""))
+	cr.AddMetric(metric.NewMetric("path_changed", "", metric.MetricBool, changed, ""))
+
+	if !reached {
+		crs.SetStatus(fmt.Sprintf("%s not reached within %d hops", targetIP, len(path)))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Status Line
+	sl.Add("hops", len(path))
+	if changed {
+		sl.AddOption("path_changed")
+	}
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
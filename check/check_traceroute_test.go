@@ -0,0 +1,188 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tracerouteCheckDataTemplate = `{
+	  "id":"chPzATRACE",
+	  "zone_id":"pzA",
+	  "entity_id":"enAAAAIPV4",
+	  "details":{"count":2,"max_hops":%d},
+	  "type":"remote.traceroute",
+	  "timeout":15,
+	  "period":30,
+	  "ip_addresses":{"default":"192.0.2.1"},
+	  "target_alias":"default",
+	  "target_hostname":"",
+	  "target_resolver":"IPv4",
+	  "disabled":false
+	  }`
+
+func setupTraceroute(t *testing.T, pinger check.Pinger) check.PingerFactorySpec {
+	originalFactory := check.PingerFactory
+	check.PingerFactory = func(identifier string, remoteAddr string, ipVersion string) (check.Pinger, error) {
+		assert.Equal(t, "192.0.2.1", remoteAddr)
+		assert.Equal(t, check.PingerIPv4, ipVersion)
+		return pinger, nil
+	}
+	return originalFactory
+}
+
+// expectHop expects the two probes of a hop, where a nil peer is a lost probe
+func expectHop(mock *MockTTLPinger, ttl int, peers [2]string, rtt time.Duration) {
+	for i, peer := range peers {
+		seq := (ttl-1)*2 + i + 1
+		resp := check.PingResponse{Err: errors.New("timeout"), Timeout: true}
+		if peer != "" {
+			resp = check.PingResponse{Seq: seq, Rtt: rtt, Peer: net.ParseIP(peer), TTLExceeded: peer != "192.0.2.1"}
+		}
+		mock.EXPECT().PingTTL(seq, ttl, 1*time.Second).Return(resp)
+	}
+}
+
+func TestTracerouteCheck_Reached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockTTLPinger(ctrl)
+	defer teardown(setupTraceroute(t, mock))
+
+	expectHop(mock, 1, [2]string{"10.0.0.1", "10.0.0.1"}, 1*time.Millisecond)
+	expectHop(mock, 2, [2]string{"", "10.0.1.1"}, 4*time.Millisecond)
+	expectHop(mock, 3, [2]string{"", ""}, 0)
+	expectHop(mock, 4, [2]string{"192.0.2.1", "192.0.2.1"}, 10*time.Millisecond)
+	mock.EXPECT().Close()
+
+	c, err := check.NewCheck(context.Background(), []byte(fmt.Sprintf(tracerouteCheckDataTemplate, 5)))
+	require.NoError(t, err)
+	assert.IsType(t, &check.TracerouteCheck{}, c)
+
+	crs, err := c.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, 5, crs.Length())
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("hops", "", metric.MetricNumber, 4, ""),
+		ExpectMetric("reached", "", metric.MetricBool, true, ""),
+		ExpectMetric("path_changed", "", metric.MetricBool, false, ""),
+	}, crs.Get(0).Metrics)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("address", "hop_1", metric.MetricString, "10.0.0.1", ""),
+		ExpectMetric("loss", "hop_1", metric.MetricFloat, 0.0, metric.UnitPercent),
+		ExpectMetric("rtt", "hop_1", metric.MetricFloat, 0.001, metric.UnitSeconds),
+	}, crs.Get(1).Metrics)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("address", "hop_2", metric.MetricString, "10.0.1.1", ""),
+		ExpectMetric("loss", "hop_2", metric.MetricFloat, 50.0, metric.UnitPercent),
+		ExpectMetric("rtt", "hop_2", metric.MetricFloat, 0.004, metric.UnitSeconds),
+	}, crs.Get(2).Metrics)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("address", "hop_3", metric.MetricString, "*", ""),
+		ExpectMetric("loss", "hop_3", metric.MetricFloat, 100.0, metric.UnitPercent),
+	}, crs.Get(3).Metrics)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("address", "hop_4", metric.MetricString, "192.0.2.1", ""),
+		ExpectMetric("loss", "hop_4", metric.MetricFloat, 0.0, metric.UnitPercent),
+		ExpectMetric("rtt", "hop_4", metric.MetricFloat, 0.010, metric.UnitSeconds),
+	}, crs.Get(4).Metrics)
+
+	req := check.NewMetricsPostRequest(crs, 0)
+	assert.Empty(t, req.Params.Metrics[0].Dimension)
+	assert.Equal(t, "hop_1", req.Params.Metrics[1].Dimension)
+}
+
+func TestTracerouteCheck_PathChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockTTLPinger(ctrl)
+	defer teardown(setupTraceroute(t, mock))
+
+	c, err := check.NewCheck(context.Background(), []byte(fmt.Sprintf(tracerouteCheckDataTemplate, 5)))
+	require.NoError(t, err)
+
+	runs := []struct {
+		hop1    [2]string
+		changed bool
+	}{
+		{hop1: [2]string{"10.0.0.1", "10.0.0.1"}, changed: false},
+		// a hop that did not respond is not considered a change
+		{hop1: [2]string{"", ""}, changed: false},
+		{hop1: [2]string{"10.0.0.2", "10.0.0.2"}, changed: true},
+	}
+	for i, run := range runs {
+		expectHop(mock, 1, run.hop1, 1*time.Millisecond)
+		expectHop(mock, 2, [2]string{"192.0.2.1", "192.0.2.1"}, 2*time.Millisecond)
+		mock.EXPECT().Close()
+
+		crs, err := c.Run()
+		require.NoError(t, err)
+
+		assert.True(t, crs.Available, crs.Status)
+		assert.Equal(t, run.changed, crs.Get(0).GetMetric("path_changed").Value, "run %d", i)
+		assert.Equal(t, run.changed, strings.Contains(crs.Status, "path_changed"), "run %d", i)
+	}
+}
+
+func TestTracerouteCheck_NotReached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockTTLPinger(ctrl)
+	defer teardown(setupTraceroute(t, mock))
+
+	expectHop(mock, 1, [2]string{"10.0.0.1", "10.0.0.1"}, 1*time.Millisecond)
+	expectHop(mock, 2, [2]string{"", ""}, 0)
+	mock.EXPECT().Close()
+
+	c, err := check.NewCheck(context.Background(), []byte(fmt.Sprintf(tracerouteCheckDataTemplate, 2)))
+	require.NoError(t, err)
+
+	crs, err := c.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "192.0.2.1 not reached within 2 hops", crs.Status)
+	assert.Equal(t, 3, crs.Length())
+	assert.Equal(t, false, crs.Get(0).GetMetric("reached").Value)
+}
+
+func TestTracerouteCheck_TTLNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mock := NewMockPinger(ctrl)
+	defer teardown(setupTraceroute(t, mock))
+	mock.EXPECT().Close()
+
+	c, err := check.NewCheck(context.Background(), []byte(fmt.Sprintf(tracerouteCheckDataTemplate, 5)))
+	require.NoError(t, err)
+
+	_, err = c.Run()
+	assert.Equal(t, check.ErrTTLNotSupported, err)
+}
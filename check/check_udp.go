@@ -0,0 +1,205 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxUDPResponseLength is the largest datagram that is received
+	MaxUDPResponseLength = 65535
+	// MaxUDPRetries bounds the retries, since the timeout is shared evenly between the attempts
+	MaxUDPRetries = 10
+
+	// UDPSendBodyEncodingText sends the send_body as is
+	UDPSendBodyEncodingText = "text"
+	// UDPSendBodyEncodingHex decodes the send_body from hexadecimal, ignoring whitespace
+	UDPSendBodyEncodingHex = "hex"
+)
+
+// UDPCheck conveys UDP checks
+type UDPCheck struct {
+	Base
+	protocheck.UDPCheckDetails
+}
+
+// NewUDPCheck - Constructor for a UDP Check
+func NewUDPCheck(base *Base) (Check, error) {
+	check := &UDPCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_udp",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// GenerateAddress function creates an address
+// from check port and target ip
+func (ch *UDPCheck) GenerateAddress() (string, error) {
+	portStr := strconv.FormatUint(ch.Details.Port, 10)
+	ip, err := ch.GetTargetIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, portStr), nil
+}
+
+// payload returns the datagram to send, decoding it when hex encoded
+func (ch *UDPCheck) payload() ([]byte, error) {
+	switch strings.ToLower(ch.Details.SendBodyEncoding) {
+	case "", UDPSendBodyEncodingText:
+		return []byte(ch.Details.SendBody), nil
+	case UDPSendBodyEncodingHex:
+		return hex.DecodeString(strings.Join(strings.Fields(ch.Details.SendBody), ""))
+	}
+	return nil, fmt.Errorf("unsupported send_body_encoding: %v", ch.Details.SendBodyEncoding)
+}
+
+// Run method implements Check.Run method for UDP
+// please see Check interface for more information
+func (ch *UDPCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	addr, err := ch.GenerateAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+	}).Info("Running check")
+
+	if ch.Details.Retries > MaxUDPRetries {
+		crs.SetStatus(fmt.Sprintf("retries exceeds %d", MaxUDPRetries))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	payload, err := ch.payload()
+	if err != nil {
+		crs.SetStatus(err.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	var bodyMatch *regexp.Regexp
+	if len(ch.Details.BodyMatch) > 0 {
+		if bodyMatch, err = regexp.Compile(ch.Details.BodyMatch); err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
+	// Setup Network
+	network := "udp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "udp4"
+	case protocheck.ResolverIPV6:
+		network = "udp6"
+	}
+
+	timeout := ch.GetTimeoutDuration()
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+
+	// Send/Expect, where the timeout is shared evenly between the attempts
+	attempts := ch.Details.Retries + 1
+	attemptTimeout := timeout / time.Duration(attempts)
+	response := make([]byte, MaxUDPResponseLength)
+	var n int
+	var rtt int64
+	var timeouts uint64
+	for attempt := uint64(0); attempt < attempts; attempt++ {
+		sendtime := utils.NowTimestampMillis()
+		conn.SetDeadline(time.Now().Add(attemptTimeout))
+		if _, err = conn.Write(payload); err == nil {
+			n, err = conn.Read(response)
+		}
+		if err == nil {
+			rtt = utils.NowTimestampMillis() - sendtime
+			attempts = attempt + 1
+			break
+		}
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			// such as an ICMP port unreachable reported as connection refused
+			attempts = attempt + 1
+			break
+		}
+		timeouts++
+	}
+	cr.AddMetric(metric.NewMetric("attempts", "", metric.MetricNumber, attempts, ""))
+	cr.AddMetric(metric.NewMetric("timeouts", "", metric.MetricNumber, timeouts, ""))
+	if err != nil {
+		if timeouts == attempts {
+			crs.SetStatus(fmt.Sprintf("no response after %d attempts", attempts))
+		} else {
+			crs.SetStatusFromError(err)
+		}
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	response = response[:n]
+	cr.AddMetric(metric.NewMetric("rtt", "", metric.MetricNumber, rtt, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("response_bytes", "", metric.MetricNumber, n, "bytes"))
+
+	// Body Match
+	if bodyMatch != nil {
+		if m := bodyMatch.Find(response); m != nil {
+			cr.AddMetric(metric.NewMetric("body_match", "", metric.MetricString, string(m), ""))
+		} else {
+			cr.AddMetric(metric.NewMetric("body_match", "", metric.MetricString, "", ""))
+		}
+	}
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("rtt", rtt)
+	sl.Add("attempts", attempts)
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
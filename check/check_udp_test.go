@@ -0,0 +1,142 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveUDPEcho answers each datagram with "pong " followed by the datagram, ignoring the first drop datagrams
+func serveUDPEcho(conn net.PacketConn, drop int) {
+	buffer := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if drop > 0 {
+			drop--
+			continue
+		}
+		conn.WriteTo(append([]byte("pong "), buffer[:n]...), addr)
+	}
+}
+
+func TestUDPCheck_SendExpect(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveUDPEcho(conn, 0)
+
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"ping","body_match":"pong \\w+"}`,
+		conn.LocalAddr().(*net.UDPAddr).Port))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available, crs.Status)
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("attempts", "", metric.MetricNumber, uint64(1), ""),
+		ExpectMetric("timeouts", "", metric.MetricNumber, uint64(0), ""),
+		ExpectMetric("rtt", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("response_bytes", "", metric.MetricNumber, 9, "bytes"),
+		ExpectMetric("body_match", "", metric.MetricString, "pong ping", ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestUDPCheck_HexWithRetry(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveUDPEcho(conn, 1)
+
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"de ad be ef","send_body_encoding":"hex","retries":3}`,
+		conn.LocalAddr().(*net.UDPAddr).Port))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Equal(t, uint64(2), crs.Get(0).GetMetric("attempts").Value)
+	assert.Equal(t, uint64(1), crs.Get(0).GetMetric("timeouts").Value)
+	assert.Equal(t, 9, crs.Get(0).GetMetric("response_bytes").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("body_match"))
+}
+
+func TestUDPCheck_NoResponse(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveUDPEcho(conn, 10)
+
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"ping","retries":1}`,
+		conn.LocalAddr().(*net.UDPAddr).Port))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "no response after 2 attempts", crs.Status)
+	assert.Equal(t, uint64(2), crs.Get(0).GetMetric("timeouts").Value)
+	assert.Nil(t, crs.Get(0).GetMetric("rtt"))
+}
+
+func TestUDPCheck_InvalidHex(t *testing.T) {
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"zz","send_body_encoding":"hex"}`, 9))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "invalid byte")
+}
+
+func TestUDPCheck_PortUnreachable(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"ping","retries":3}`, port))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Contains(t, crs.Status, "connection refused")
+	assert.Equal(t, uint64(1), crs.Get(0).GetMetric("attempts").Value)
+	assert.Equal(t, uint64(0), crs.Get(0).GetMetric("timeouts").Value)
+}
+
+func TestUDPCheck_TooManyRetries(t *testing.T) {
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"ping","retries":18446744073709551615}`, 9))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "retries exceeds 10", crs.Status)
+}
+
+func TestUDPCheck_InvalidBodyMatch(t *testing.T) {
+	ch := newTestCheck(t, "remote.udp", fmt.Sprintf(`{"port":%d,"send_body":"ping","body_match":"("}`, 9))
+	crs, err := ch.Run()
+	require.NoError(t, err)
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "error parsing regexp: missing closing ): `(`", crs.Status)
+}
@@ -0,0 +1,405 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxWebSocketMessageLength bounds the size of a received message
+	MaxWebSocketMessageLength = int64(512 * 1024)
+
+	// websocketGUID is appended to the handshake key to derive the accept value, as specified by RFC 6455
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	websocketOpContinuation = 0x0
+	websocketOpText         = 0x1
+	websocketOpBinary       = 0x2
+	websocketOpClose        = 0x8
+	websocketOpPing         = 0x9
+	websocketOpPong         = 0xa
+
+	// websocketCloseNormal is sent when the check closes the connection
+	websocketCloseNormal = 1000
+	// websocketCloseNoStatus is reported when a close frame carries no code
+	websocketCloseNoStatus = 1005
+)
+
+var (
+	// ErrWebSocketMessageTooLong indicates a received message exceeded MaxWebSocketMessageLength
+	ErrWebSocketMessageTooLong = errors.New("message too long")
+	// ErrWebSocketInvalidAccept indicates the server did not prove it understood the upgrade request
+	ErrWebSocketInvalidAccept = errors.New("invalid Sec-WebSocket-Accept")
+)
+
+// WebSocketCheck conveys WebSocket checks
+type WebSocketCheck struct {
+	Base
+	protocheck.WebSocketCheckDetails
+}
+
+// NewWebSocketCheck - Constructor for a WebSocket Check
+func NewWebSocketCheck(base *Base) (Check, error) {
+	check := &WebSocketCheck{Base: *base}
+	err := json.Unmarshal(*base.RawDetails, &check.Details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"prefix":  "check_websocket",
+			"err":     err,
+			"details": string(*base.RawDetails),
+		}).Error("Unable to unmarshal check details")
+		return nil, err
+	}
+	return check, nil
+}
+
+// websocketConn reads and writes frames once the connection has been upgraded
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// writeFrame sends a single, final frame masked as required of clients
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 0x80|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 0x80|127)
+		extended := make([]byte, 8)
+		binary.BigEndian.PutUint64(extended, uint64(length))
+		frame = append(frame, extended...)
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *websocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(c.reader, header); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err = io.ReadFull(c.reader, extended); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err = io.ReadFull(c.reader, extended); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > uint64(MaxWebSocketMessageLength) {
+		err = ErrWebSocketMessageTooLong
+		return
+	}
+	mask := make([]byte, 4)
+	if masked {
+		if _, err = io.ReadFull(c.reader, mask); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// readMessage returns the next data message, reassembling fragments and answering pings, or the payload of
+// a close frame with the close opcode
+func (c *websocketConn) readMessage() (byte, []byte, error) {
+	var messageOpcode byte
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case websocketOpPing:
+			if err := c.writeFrame(websocketOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case websocketOpPong:
+			continue
+		case websocketOpClose:
+			return opcode, payload, nil
+		case websocketOpText, websocketOpBinary:
+			messageOpcode = opcode
+			message = payload
+		case websocketOpContinuation:
+			message = append(message, payload...)
+			if int64(len(message)) > MaxWebSocketMessageLength {
+				return 0, nil, ErrWebSocketMessageTooLong
+			}
+		}
+		if fin {
+			return messageOpcode, message, nil
+		}
+	}
+}
+
+// websocketCloseCode extracts the status code from the payload of a close frame
+func websocketCloseCode(payload []byte) int {
+	if len(payload) < 2 {
+		return websocketCloseNoStatus
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+// websocketAccept derives the Sec-WebSocket-Accept value expected for the given key
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Run method implements Check.Run method for WebSocket
+// please see Check interface for more information
+func (ch *WebSocketCheck) Run() (*ResultSet, error) {
+	sl := utils.NewStatusLine()
+	cr := NewResult()
+	crs := NewResultSet(ch, cr)
+	starttime := utils.NowTimestampMillis()
+
+	// Parse URL and Replace Host with IP
+	parsed, host, err := ch.targetURL(ch.Details.Url)
+	if err != nil {
+		return nil, err
+	}
+	secure := parsed.Scheme == "wss" || parsed.Scheme == "https"
+	addr := parsed.Host
+
+	var bodyMatch *regexp.Regexp
+	if len(ch.Details.BodyMatch) > 0 {
+		if bodyMatch, err = regexp.Compile(ch.Details.BodyMatch); err != nil {
+			crs.SetStatus(err.Error())
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"prefix":  ch.GetLogPrefix(),
+		"address": addr,
+		"url":     ch.Details.Url,
+	}).Info("Running check")
+
+	timeout := ch.GetTimeoutDuration()
+	nd := &net.Dialer{Timeout: timeout}
+
+	// Setup Network
+	network := "tcp"
+	switch ch.TargetResolver {
+	case protocheck.ResolverIPV4:
+		network = "tcp4"
+	case protocheck.ResolverIPV6:
+		network = "tcp6"
+	}
+
+	// Connection
+	var tlsConfig *tls.Config
+	if secure {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true, ServerName: host}
+	}
+	conn, err := dialContextWithDialer(context.Background(), nd, network, addr, tlsConfig)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	connectEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("tt_connect", "", metric.MetricNumber, connectEndTime-starttime, metric.UnitMilliseconds))
+
+	// TLS Metrics
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if metrics := ch.AddTLSMetrics(cr, tlsConn.ConnectionState()); !metrics.Verified {
+			sl.AddOption("sslerror")
+		}
+	}
+
+	// Upgrade Handshake
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	parsed.Scheme = "http"
+	if secure {
+		parsed.Scheme = "https"
+	}
+	req, err := http.NewRequest("GET", parsed.String(), nil)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	req.Header.Add("User-Agent", UserAgent)
+	req.Host = host
+	for name, value := range ch.Details.Headers {
+		req.Header.Add(name, value)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	ws := &websocketConn{conn: conn, reader: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(ws.reader, req)
+	if err != nil {
+		crs.SetStatusFromError(err)
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	handshakeEndTime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("handshake_time", "", metric.MetricNumber, handshakeEndTime-connectEndTime, metric.UnitMilliseconds))
+	cr.AddMetric(metric.NewMetric("code", "", metric.MetricString, fmt.Sprint(resp.StatusCode), ""))
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		crs.SetStatus(fmt.Sprintf("upgrade rejected: %s", resp.Status))
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		crs.SetStatus(ErrWebSocketInvalidAccept.Error())
+		crs.SetStateUnavailable()
+		return crs, nil
+	}
+
+	// Send
+	sendtime := handshakeEndTime
+	if len(ch.Details.SendBody) > 0 {
+		if err := ws.writeFrame(websocketOpText, []byte(ch.Details.SendBody)); err != nil {
+			crs.SetStatusFromError(err)
+			crs.SetStateUnavailable()
+			return crs, nil
+		}
+		sendtime = utils.NowTimestampMillis()
+	}
+
+	// Expect, where messages are read until one matches or the server closes the connection
+	closeCode := 0
+	if len(ch.Details.SendBody) > 0 || bodyMatch != nil {
+		firstMessage := true
+		for {
+			opcode, message, err := ws.readMessage()
+			if err != nil {
+				crs.SetStatusFromError(err)
+				crs.SetStateUnavailable()
+				return crs, nil
+			}
+			if opcode == websocketOpClose {
+				closeCode = websocketCloseCode(message)
+				cr.AddMetric(metric.NewMetric("close_code", "", metric.MetricNumber, closeCode, ""))
+				crs.SetStatus(fmt.Sprintf("connection closed: %d", closeCode))
+				crs.SetStateUnavailable()
+				return crs, nil
+			}
+			if firstMessage {
+				cr.AddMetric(metric.NewMetric("tt_first_message", "", metric.MetricNumber, utils.NowTimestampMillis()-sendtime, metric.UnitMilliseconds))
+				cr.AddMetric(metric.NewMetric("message_bytes", "", metric.MetricNumber, len(message), "bytes"))
+				firstMessage = false
+			}
+			if bodyMatch == nil {
+				break
+			}
+			if m := bodyMatch.Find(message); m != nil {
+				cr.AddMetric(metric.NewMetric("body_match", "", metric.MetricString, string(m), ""))
+				break
+			}
+		}
+	}
+
+	// Close Handshake, where the server echoes the close frame with its own code
+	if err := ws.writeFrame(websocketOpClose, []byte{websocketCloseNormal >> 8, websocketCloseNormal & 0xff}); err == nil {
+		for {
+			opcode, message, err := ws.readMessage()
+			if err != nil {
+				break
+			}
+			if opcode == websocketOpClose {
+				closeCode = websocketCloseCode(message)
+				cr.AddMetric(metric.NewMetric("close_code", "", metric.MetricNumber, closeCode, ""))
+				break
+			}
+		}
+	}
+
+	endtime := utils.NowTimestampMillis()
+	cr.AddMetric(metric.NewMetric("duration", "", metric.MetricNumber, endtime-starttime, metric.UnitMilliseconds))
+
+	// Status Line
+	sl.Add("code", resp.StatusCode)
+	sl.Add("duration", endtime-starttime)
+	if closeCode != 0 {
+		sl.Add("close_code", closeCode)
+	}
+
+	crs.SetStateAvailable()
+	crs.SetStatus(sl.String())
+	return crs, nil
+}
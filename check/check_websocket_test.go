@@ -0,0 +1,180 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+package check_test
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readWebSocketFrame reads a single masked client frame
+func readWebSocketFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(r, extended); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(r, mask); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0] & 0x0f, payload, nil
+}
+
+// writeWebSocketFrame writes a single unmasked server frame
+func writeWebSocketFrame(w io.Writer, fin bool, opcode byte, payload []byte) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	w.Write(append([]byte{first, byte(len(payload))}, payload...))
+}
+
+// websocketEchoHandler upgrades the connection, pings the client and greets it, then echoes text messages as
+// two fragments until the client closes, or goes away straight after the greeting
+func websocketEchoHandler(t *testing.T, goAway bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(h[:]))
+		writeWebSocketFrame(rw, true, 0x9, []byte("ping"))
+		writeWebSocketFrame(rw, true, 0x1, []byte("welcome"))
+		if goAway {
+			writeWebSocketFrame(rw, true, 0x8, []byte{0x03, 0xe9})
+		}
+		rw.Flush()
+		for {
+			opcode, payload, err := readWebSocketFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case 0x1:
+				half := len(payload) / 2
+				writeWebSocketFrame(rw, false, 0x1, payload[:half])
+				writeWebSocketFrame(rw, true, 0x0, payload[half:])
+			case 0x8:
+				writeWebSocketFrame(rw, true, 0x8, []byte{0x03, 0xe8})
+				rw.Flush()
+				return
+			}
+			rw.Flush()
+		}
+	}
+}
+
+func TestWebSocketCheck_Echo(t *testing.T) {
+	server := httptest.NewServer(websocketEchoHandler(t, false))
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.websocket", fmt.Sprintf(`{"url":"ws://example.com:%d/socket","headers":{"X-Token":"secret"},"send_body":"hello world","body_match":"hello \\w+"}`,
+		server.Listener.Addr().(*net.TCPAddr).Port))
+
+	assert.True(t, crs.Available, crs.Status)
+	assert.Contains(t, crs.Status, "close_code=1000")
+	AssertMetrics(t, []*ExpectedMetric{
+		ExpectMetric("tt_connect", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("handshake_time", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("code", "", metric.MetricString, "101", ""),
+		ExpectMetric("tt_first_message", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+		ExpectMetric("message_bytes", "", metric.MetricNumber, 7, "bytes"),
+		ExpectMetric("body_match", "", metric.MetricString, "hello world", ""),
+		ExpectMetric("close_code", "", metric.MetricNumber, 1000, ""),
+		ExpectMetric("duration", "", metric.MetricNumber, 0, metric.UnitMilliseconds).ButIgnoreValue(),
+	}, crs.Get(0).Metrics)
+}
+
+func TestWebSocketCheck_Rejected(t *testing.T) {
+	server := httptest.NewServer(websocketEchoHandler(t, false))
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.websocket", fmt.Sprintf(`{"url":"ws://example.com:%d/socket"}`,
+		server.Listener.Addr().(*net.TCPAddr).Port))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "upgrade rejected: 403 Forbidden", crs.Status)
+}
+
+func TestWebSocketCheck_ClosedBeforeMatch(t *testing.T) {
+	server := httptest.NewServer(websocketEchoHandler(t, true))
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.websocket", fmt.Sprintf(`{"url":"ws://example.com:%d/socket","headers":{"X-Token":"secret"},"body_match":"never"}`,
+		server.Listener.Addr().(*net.TCPAddr).Port))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "connection closed: 1001", crs.Status)
+	assert.Equal(t, 1001, crs.Get(0).GetMetric("close_code").Value)
+}
+
+func TestWebSocketCheck_InvalidBodyMatch(t *testing.T) {
+	crs := runTestCheck(t, "remote.websocket", fmt.Sprintf(`{"url":"ws://example.com:%d/socket","body_match":"("}`, 0))
+
+	assert.False(t, crs.Available)
+	assert.Equal(t, "error parsing regexp: missing closing ): `(`", crs.Status)
+}
+
+func TestWebSocketCheck_TLS(t *testing.T) {
+	cert, err := tls.X509KeyPair(utils.LocalhostCert, utils.LocalhostKey)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(websocketEchoHandler(t, false))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	crs := runTestCheck(t, "remote.websocket", fmt.Sprintf(`{"url":"wss://example.com:%d/socket","headers":{"X-Token":"secret"},"body_match":"welcome"}`,
+		server.Listener.Addr().(*net.TCPAddr).Port))
+
+	assert.True(t, crs.Available, crs.Status)
+	body, _ := crs.Get(0).GetMetric("body_match").ToString()
+	assert.Equal(t, "welcome", body)
+	ValidateMetrics(t, []string{"cert_issuer", "cert_end_in", "ssl_session_version"}, crs.Get(0))
+}
@@ -244,9 +244,9 @@ func (crs *ResultSet) PopulateMetricsPostContent(clockOffset int64, content *pro
 	if crs.Length() == 0 {
 		content.Metrics = nil
 	} else {
-		content.Metrics = make([]protocol.MetricWrap, crs.Length())
+		content.Metrics = make([]protocol.MetricWrap, 0, crs.Length())
 		for i := 0; i < crs.Length(); i++ {
-			content.Metrics[i] = ConvertToMetricResults(crs.Get(i))
+			content.Metrics = append(content.Metrics, ConvertToMetricResults(crs.Get(i))...)
 		}
 	}
 
@@ -18,8 +18,10 @@ package check
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/racker/rackspace-monitoring-poller/protocol"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
 )
 
 // NewMetricsPostRequest function sets up a request with provided
@@ -35,19 +37,41 @@ func NewMetricsPostRequest(crs *ResultSet, clockOffset int64) *protocol.MetricsP
 
 // ConvertToMetricResults function iterates through the check result
 // in check result set and format it to MetricTVU, add it to the list
-// and return that list
-func ConvertToMetricResults(cr *Result) protocol.MetricWrap {
-	wrapper := make(map[string]*protocol.MetricTVU)
+// and return that list. The metrics are wrapped per dimension, with
+// the undimensioned metrics first and the rest ordered by dimension
+func ConvertToMetricResults(cr *Result) []protocol.MetricWrap {
+	byDimension := make(map[string]map[string]*protocol.MetricTVU)
+	var dimensions []string
 	for key, m := range cr.Metrics {
+		dimension := m.Dimension
+		if dimension == metric.DimensionNone {
+			dimension = ""
+		}
+		wrapper, ok := byDimension[dimension]
+		if !ok {
+			wrapper = make(map[string]*protocol.MetricTVU)
+			byDimension[dimension] = wrapper
+			dimensions = append(dimensions, dimension)
+		}
 		wrapper[key] = &protocol.MetricTVU{
 			Type:  m.TypeString,
 			Value: fmt.Sprintf("%v", m.Value),
 			Unit:  m.Unit,
 		}
 	}
-	wrappers := protocol.MetricWrap{
-		nil, // resource/dimension -- usused
-		wrapper,
+	if len(dimensions) == 0 {
+		// a result without metrics is still conveyed
+		dimensions = append(dimensions, "")
+		byDimension[""] = make(map[string]*protocol.MetricTVU)
+	}
+	sort.Strings(dimensions)
+
+	wrappers := make([]protocol.MetricWrap, len(dimensions))
+	for i, dimension := range dimensions {
+		wrappers[i] = protocol.MetricWrap{
+			Dimension: dimension,
+			Metrics:   byDimension[dimension],
+		}
 	}
 	return wrappers
 }
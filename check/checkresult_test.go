@@ -63,13 +63,11 @@ func TestNewMetricsPostRequest(t *testing.T) {
 
 	assert.Len(t, req.Params.Metrics, 2)
 
-	assert.Len(t, req.Params.Metrics[0], 2)
-	assert.Nil(t, req.Params.Metrics[0][0])
-	assert.Equal(t, "250", req.Params.Metrics[0][1]["tt_connect"].Value)
+	assert.Empty(t, req.Params.Metrics[0].Dimension)
+	assert.Equal(t, "250", req.Params.Metrics[0].Metrics["tt_connect"].Value)
 
-	assert.Len(t, req.Params.Metrics[1], 2)
-	assert.Nil(t, req.Params.Metrics[1][0])
-	assert.Equal(t, "500", req.Params.Metrics[1][1]["duration"].Value)
+	assert.Empty(t, req.Params.Metrics[1].Dimension)
+	assert.Equal(t, "500", req.Params.Metrics[1].Metrics["duration"].Value)
 
 	raw, err := req.Encode()
 	require.NoError(t, err)
@@ -84,6 +82,41 @@ func TestNewMetricsPostRequest(t *testing.T) {
 		"}", string(raw))
 }
 
+func TestNewMetricsPostRequest_Dimensions(t *testing.T) {
+	ch, err := check.NewCheck(context.Background(), []byte(`{
+	  "id":"chTestDimensions",
+	  "zone_id":"pzA",
+	  "entity_id":"enAAAAIPV4",
+	  "details":{"port":80},
+	  "type":"remote.tcp",
+	  "timeout":15,
+	  "period":30,
+	  "ip_addresses":{"default":"127.0.0.1"},
+	  "target_alias":"default",
+	  "target_hostname":"",
+	  "target_resolver":"IPv4",
+	  "disabled":false
+	  }`))
+	require.NoError(t, err)
+
+	cr := check.NewResult(
+		metric.NewMetric("rtt", "step_2", metric.MetricNumber, 30, metric.UnitMilliseconds),
+		metric.NewMetric("duration", "", metric.MetricNumber, 50, metric.UnitMilliseconds),
+		metric.NewMetric("code", "step_1", metric.MetricString, "200", ""),
+		metric.NewMetric("tt_connect", "step_1", metric.MetricNumber, 20, metric.UnitMilliseconds),
+	)
+	req := check.NewMetricsPostRequest(check.NewResultSet(ch, cr), 0)
+
+	require.Len(t, req.Params.Metrics, 3)
+	assert.Empty(t, req.Params.Metrics[0].Dimension)
+	assert.Equal(t, "50", req.Params.Metrics[0].Metrics["duration"].Value)
+	assert.Equal(t, "step_1", req.Params.Metrics[1].Dimension)
+	assert.Len(t, req.Params.Metrics[1].Metrics, 2)
+	assert.Equal(t, "20", req.Params.Metrics[1].Metrics["tt_connect"].Value)
+	assert.Equal(t, "step_2", req.Params.Metrics[2].Dimension)
+	assert.Equal(t, "30", req.Params.Metrics[2].Metrics["rtt"].Value)
+}
+
 func TestStates_SetStatusFromError(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,195 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	protocol "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauth2ExpiryMargin renews a token this long before it expires, rather than risk it expiring during a request
+const oauth2ExpiryMargin = 10 * time.Second
+
+var (
+	// ErrOAuth2NoTokenURL indicates the oauth2 auth_type was configured without a token_url
+	ErrOAuth2NoTokenURL = errors.New("oauth2 token_url is required")
+	// ErrOAuth2NoAccessToken indicates the token endpoint responded without an access_token
+	ErrOAuth2NoAccessToken = errors.New("oauth2 token response lacks access_token")
+)
+
+// oauth2Token is a bearer token obtained by the OAuth2 client credentials grant
+type oauth2Token struct {
+	accessToken string
+	// expiry is zero when the token endpoint did not give the lifetime of the token
+	expiry time.Time
+}
+
+// valid determines if the token can still be used, where a token without an expiry is only used once
+func (t *oauth2Token) valid(now time.Time) bool {
+	return t != nil && !t.expiry.IsZero() && now.Add(oauth2ExpiryMargin).Before(t.expiry)
+}
+
+// usesBasicAuth determines if the auth_user and auth_password are sent up front, as they always were before
+// auth_type was introduced
+func (ch *HTTPCheck) usesBasicAuth() bool {
+	switch ch.Details.AuthType {
+	case "", protocol.HTTPAuthBasic:
+		return len(ch.Details.AuthUser) > 0 && len(ch.Details.AuthPassword) > 0
+	}
+	return false
+}
+
+// authorization determines the Authorization header sent up front, which is empty for the schemes that do not
+// send a bearer token
+func (ch *HTTPCheck) authorization(ctx context.Context, tlsConfig *tls.Config) (string, error) {
+	switch ch.Details.AuthType {
+	case "", protocol.HTTPAuthBasic, protocol.HTTPAuthDigest:
+		return "", nil
+	case protocol.HTTPAuthBearer:
+		return "Bearer " + ch.Details.AuthToken, nil
+	case protocol.HTTPAuthOAuth2:
+		if !ch.oauth2Token.valid(time.Now()) {
+			token, err := ch.fetchOAuth2Token(ctx, tlsConfig)
+			if err != nil {
+				return "", err
+			}
+			ch.oauth2Token = token
+		}
+		return "Bearer " + ch.oauth2Token.accessToken, nil
+	}
+	return "", fmt.Errorf("unsupported auth_type %s", ch.Details.AuthType)
+}
+
+// fetchOAuth2Token obtains a token by the client credentials grant of RFC 6749, where the client authenticates to
+// the token endpoint by basic auth. The request is bounded by the check's timeout, through ctx, and made with the
+// check's TLS details.
+func (ch *HTTPCheck) fetchOAuth2Token(ctx context.Context, tlsConfig *tls.Config) (*oauth2Token, error) {
+	details := ch.Details.OAuth2
+	if details.TokenURL == "" {
+		return nil, ErrOAuth2NoTokenURL
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(details.Scopes) > 0 {
+		form.Set("scope", strings.Join(details.Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", details.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(url.QueryEscape(details.ClientID), url.QueryEscape(details.ClientSecret))
+	req.Header.Set("Content-Type", FormContentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+
+	// the token endpoint is not the target, so is reached directly and verified by the handshake against the
+	// check's CA, if any, unless the details skip verification
+	netClient := &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				RootCAs:            tlsConfig.RootCAs,
+				Certificates:       tlsConfig.Certificates,
+				MinVersion:         tlsConfig.MinVersion,
+				InsecureSkipVerify: ch.tlsSkipVerify,
+			},
+		},
+	}
+	starttime := time.Now()
+	resp, err := netClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ch.readLimit(resp.Body, MaxHTTPResponseBodyLength)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth2 token request returned status %d", resp.StatusCode)
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("invalid oauth2 token response: %v", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return nil, ErrOAuth2NoAccessToken
+	}
+
+	token := &oauth2Token{accessToken: tokenResponse.AccessToken}
+	if tokenResponse.ExpiresIn > 0 {
+		token.expiry = starttime.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+	}
+	log.WithFields(log.Fields{
+		"prefix": ch.GetLogPrefix(),
+		"expiry": token.expiry,
+	}).Debug("Obtained OAuth2 token")
+	return token, nil
+}
+
+// challengeResponse handles a response of 401 Unauthorized, returning the Authorization header with which to
+// perform the request again, if any. That is the response to the first of the server's challenges that is
+// supported when digest auth is configured. A cached OAuth2 token is discarded instead, since it may have been
+// revoked.
+func (ch *HTTPCheck) challengeResponse(req *http.Request, resp *http.Response) (string, error) {
+	switch ch.Details.AuthType {
+	case protocol.HTTPAuthOAuth2:
+		ch.oauth2Token = nil
+	case protocol.HTTPAuthDigest:
+		// the error of the first challenge is reported when none can be answered
+		var unsupported error
+		for _, header := range resp.Header[http.CanonicalHeaderKey("WWW-Authenticate")] {
+			challenge := utils.ParseDigestChallenge(header)
+			if challenge == nil {
+				continue
+			}
+			cnonce := make([]byte, 16)
+			if _, err := rand.Read(cnonce); err != nil {
+				return "", err
+			}
+			authorization, err := challenge.Authorization(ch.Details.AuthUser, ch.Details.AuthPassword, req.Method,
+				req.URL.RequestURI(), 1, hex.EncodeToString(cnonce))
+			if err != nil {
+				if unsupported == nil {
+					unsupported = err
+				}
+				continue
+			}
+			return authorization, nil
+		}
+		return "", unsupported
+	}
+	return "", nil
+}
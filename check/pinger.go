@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/pkg/errors"
@@ -74,6 +75,13 @@ type Pinger interface {
 	Close()
 }
 
+// TTLPinger is a Pinger that can also limit the number of hops its packets may travel, such that the router at
+// that hop reports the expiry instead of the remote address replying. The TTL remains in effect for later pings.
+type TTLPinger interface {
+	Pinger
+	PingTTL(seq int, ttl int, perPingDuration time.Duration) PingResponse
+}
+
 // PingerFactorySpec specifies function specification to use
 // when creating a Pinger.
 // ipVersion is "v4" or "v6" or "" to auto-interpret
@@ -84,6 +92,9 @@ type PingResponse struct {
 	Rtt     time.Duration
 	Timeout bool
 	Err     error
+	// Peer is the address that responded, which is a router along the way when TTLExceeded
+	Peer        net.IP
+	TTLExceeded bool
 }
 
 // pingerBase is the base implementation for both IPv4 and IPv6 flavors
@@ -157,9 +168,12 @@ func createPacketConn(network string, bindAddr string) (*icmp.PacketConn, error)
 	return packetConn, nil
 }
 
-func (p *pingerBase) ping(seq int, messageType icmp.Type, perPingDuration time.Duration) PingResponse {
+// ping sends an echo request and waits for its reply. A TTL probe also accepts a router reporting that the TTL of
+// the request ran out, whereas a plain ping ignores such reports.
+func (p *pingerBase) ping(seq int, messageType icmp.Type, ttlProbe bool, perPingDuration time.Duration) PingResponse {
 	// google.com truncates any ping bodies greater than 64 bytes, so hand-encoding the timestamp
-	nowBytes, err := time.Now().MarshalBinary()
+	now := time.Now()
+	nowBytes, err := now.MarshalBinary()
 	if err != nil {
 		return PingResponse{Err: err}
 	}
@@ -221,7 +235,7 @@ func (p *pingerBase) ping(seq int, messageType icmp.Type, perPingDuration time.D
 	}
 
 	// now wait for the response packet matching our ID and remoteAddr
-	return p.receive(perPingDuration)
+	return p.receive(seq, now, ttlProbe, perPingDuration)
 }
 
 func isNetTimeoutError(err error) bool {
@@ -232,8 +246,37 @@ func isNetTimeoutError(err error) bool {
 	}
 }
 
+// pingAddrIP extracts the IP of an address read from either flavor of ICMP connection
+func pingAddrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// quotesEcho determines if the datagram quoted by an ICMP error is the echo request we sent with the given seq.
+// Only the IP header and the first 8 bytes of the ICMP message are guaranteed to be quoted, which still covers
+// the ID and seq.
+func (p *pingerBase) quotesEcho(datagram []byte, seq int) bool {
+	if len(datagram) == 0 {
+		return false
+	}
+	offset := ipv6.HeaderLen
+	if p.proto == ProtocolICMP {
+		offset = int(datagram[0]&0x0f) * 4
+	}
+	if len(datagram) < offset+8 {
+		return false
+	}
+	echo := datagram[offset:]
+	return int(binary.BigEndian.Uint16(echo[4:6])) == p.id && int(binary.BigEndian.Uint16(echo[6:8])) == seq&0xffff
+}
+
 //noinspection GoBoolExpressions
-func (p *pingerBase) receive(perPingDuration time.Duration) PingResponse {
+func (p *pingerBase) receive(seq int, sent time.Time, ttlProbe bool, perPingDuration time.Duration) PingResponse {
 
 	buffer := make([]byte, PingReceiveBufferSize)
 
@@ -281,12 +324,6 @@ recvLoop:
 			}).Debug("Read packet")
 		}
 
-		// Is it even from the address we pinged? BTW net.Addr is an interface so we can do a plain old != on the
-		// two addrs. Comparing String() rendering is cheesy but works reliably.
-		if peerAddr.String() != p.remoteAddr.String() {
-			continue recvLoop
-		}
-
 		m, err := icmp.ParseMessage(p.proto, buffer[:n])
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -298,6 +335,32 @@ recvLoop:
 			continue recvLoop
 		}
 
+		// A router along the way reports when our TTL ran out, quoting the echo request we sent
+		if m.Type == ipv4.ICMPTypeTimeExceeded || m.Type == ipv6.ICMPTypeTimeExceeded {
+			if pkt, ok := m.Body.(*icmp.TimeExceeded); ok && ttlProbe && p.quotesEcho(pkt.Data, seq) {
+				log.WithFields(log.Fields{
+					"prefix":     pingLogPrefix,
+					"identifier": p.identifier,
+					"seq":        seq,
+					"peerAddr":   peerAddr,
+				}).Debug("Received time exceeded")
+
+				return PingResponse{
+					Seq:         seq,
+					Rtt:         time.Since(sent),
+					Peer:        pingAddrIP(peerAddr),
+					TTLExceeded: true,
+				}
+			}
+			continue recvLoop
+		}
+
+		// Is it even from the address we pinged? BTW net.Addr is an interface so we can do a plain old != on the
+		// two addrs. Comparing String() rendering is cheesy but works reliably.
+		if peerAddr.String() != p.remoteAddr.String() {
+			continue recvLoop
+		}
+
 		if VerbosePinger {
 			log.WithFields(log.Fields{
 				"prefix":     pingLogPrefix,
@@ -394,8 +457,9 @@ recvLoop:
 			// FINALLY...its ours, has a valid identifier, timestamp, so return the results
 
 			pingResponse := PingResponse{
-				Seq: seq,
-				Rtt: time.Since(sent),
+				Seq:  seq,
+				Rtt:  time.Since(sent),
+				Peer: pingAddrIP(peerAddr),
 			}
 
 			return pingResponse
@@ -517,9 +581,23 @@ func resolvePingAddr(addrNetwork string, icmpNetwork string, remoteAddr string)
 }
 
 func (p *pingerV4) Ping(seq int, perPingDuration time.Duration) PingResponse {
-	return p.ping(seq, ipv4.ICMPTypeEcho, perPingDuration)
+	return p.ping(seq, ipv4.ICMPTypeEcho, false, perPingDuration)
 }
 
 func (p *pingerV6) Ping(seq int, perPingDuration time.Duration) PingResponse {
-	return p.ping(seq, ipv6.ICMPTypeEchoRequest, perPingDuration)
+	return p.ping(seq, ipv6.ICMPTypeEchoRequest, false, perPingDuration)
+}
+
+func (p *pingerV4) PingTTL(seq int, ttl int, perPingDuration time.Duration) PingResponse {
+	if err := p.packetConn.IPv4PacketConn().SetTTL(ttl); err != nil {
+		return PingResponse{Err: err}
+	}
+	return p.ping(seq, ipv4.ICMPTypeEcho, true, perPingDuration)
+}
+
+func (p *pingerV6) PingTTL(seq int, ttl int, perPingDuration time.Duration) PingResponse {
+	if err := p.packetConn.IPv6PacketConn().SetHopLimit(ttl); err != nil {
+		return PingResponse{Err: err}
+	}
+	return p.ping(seq, ipv6.ICMPTypeEchoRequest, true, perPingDuration)
 }
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/racker/rackspace-monitoring-poller/check (interfaces: Pinger)
+// Source: github.com/racker/rackspace-monitoring-poller/check (interfaces: Pinger,TTLPinger)
 
 package check_test
 
@@ -54,3 +54,60 @@ func (_m *MockPinger) Ping(_param0 int, _param1 time.Duration) check.PingRespons
 func (_mr *MockPingerMockRecorder) Ping(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Ping", reflect.TypeOf((*MockPinger)(nil).Ping), arg0, arg1)
 }
+
+// MockTTLPinger is a mock of TTLPinger interface
+type MockTTLPinger struct {
+	ctrl     *gomock.Controller
+	recorder *MockTTLPingerMockRecorder
+}
+
+// MockTTLPingerMockRecorder is the mock recorder for MockTTLPinger
+type MockTTLPingerMockRecorder struct {
+	mock *MockTTLPinger
+}
+
+// NewMockTTLPinger creates a new mock instance
+func NewMockTTLPinger(ctrl *gomock.Controller) *MockTTLPinger {
+	mock := &MockTTLPinger{ctrl: ctrl}
+	mock.recorder = &MockTTLPingerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (_m *MockTTLPinger) EXPECT() *MockTTLPingerMockRecorder {
+	return _m.recorder
+}
+
+// Close mocks base method
+func (_m *MockTTLPinger) Close() {
+	_m.ctrl.Call(_m, "Close")
+}
+
+// Close indicates an expected call of Close
+func (_mr *MockTTLPingerMockRecorder) Close() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Close", reflect.TypeOf((*MockTTLPinger)(nil).Close))
+}
+
+// Ping mocks base method
+func (_m *MockTTLPinger) Ping(_param0 int, _param1 time.Duration) check.PingResponse {
+	ret := _m.ctrl.Call(_m, "Ping", _param0, _param1)
+	ret0, _ := ret[0].(check.PingResponse)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping
+func (_mr *MockTTLPingerMockRecorder) Ping(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Ping", reflect.TypeOf((*MockTTLPinger)(nil).Ping), arg0, arg1)
+}
+
+// PingTTL mocks base method
+func (_m *MockTTLPinger) PingTTL(_param0 int, _param1 int, _param2 time.Duration) check.PingResponse {
+	ret := _m.ctrl.Call(_m, "PingTTL", _param0, _param1, _param2)
+	ret0, _ := ret[0].(check.PingResponse)
+	return ret0
+}
+
+// PingTTL indicates an expected call of PingTTL
+func (_mr *MockTTLPingerMockRecorder) PingTTL(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "PingTTL", reflect.TypeOf((*MockTTLPinger)(nil).PingTTL), arg0, arg1, arg2)
+}
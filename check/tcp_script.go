@@ -0,0 +1,146 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// MaxTCPScriptResponseLength bounds the data buffered while waiting for the expectation of a script step
+	MaxTCPScriptResponseLength = 64 * 1024
+
+	// ErrTCPScriptExclusive indicates a script was given along with the single exchange details
+	ErrTCPScriptExclusive = errors.New("script is mutually exclusive with send_body, banner_match and body_match")
+)
+
+// tcpScriptReader accumulates the data received over a conversation, where the data beyond the match of each
+// expectation is retained for the next
+type tcpScriptReader struct {
+	conn net.Conn
+	buf  []byte
+}
+
+// expect reads until re matches, returning the submatches
+func (r *tcpScriptReader) expect(re *regexp.Regexp, deadline time.Time) ([]string, error) {
+	chunk := make([]byte, 4096)
+	for {
+		if loc := re.FindSubmatchIndex(r.buf); loc != nil {
+			submatches := make([]string, len(loc)/2)
+			for i := range submatches {
+				if loc[2*i] >= 0 {
+					submatches[i] = string(r.buf[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			r.buf = r.buf[loc[1]:]
+			return submatches, nil
+		}
+		if len(r.buf) >= MaxTCPScriptResponseLength {
+			return nil, fmt.Errorf("expected %q not found within %d bytes", re.String(), MaxTCPScriptResponseLength)
+		}
+
+		r.conn.SetReadDeadline(deadline)
+		n, err := r.conn.Read(chunk)
+		r.buf = append(r.buf, chunk[:n]...)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, fmt.Errorf("timed out waiting for %q", re.String())
+			}
+			if err == io.EOF {
+				return nil, fmt.Errorf("connection closed waiting for %q", re.String())
+			}
+			return nil, err
+		}
+	}
+}
+
+// tcpScriptLabel identifies a step within the status, by name when it has one
+func tcpScriptLabel(index int, step protocheck.TCPScriptStep) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return fmt.Sprintf("%d", index+1)
+}
+
+// runScript performs the steps of the script over the connection, adding a result for each step that is
+// dimensioned by step number. It returns the index of the step that failed, along with the reason, or -1.
+func (ch *TCPCheck) runScript(conn net.Conn, crs *ResultSet, deadline time.Time) (int, error) {
+	reader := &tcpScriptReader{conn: conn}
+	for i, step := range ch.Details.Script {
+		var re *regexp.Regexp
+		if step.Expect != "" {
+			var err error
+			if re, err = regexp.Compile(step.Expect); err != nil {
+				return i, err
+			}
+		}
+		stepDeadline := deadline
+		if step.TimeoutMs > 0 {
+			if d := time.Now().Add(time.Duration(step.TimeoutMs) * time.Millisecond); d.Before(deadline) {
+				stepDeadline = d
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"prefix": ch.GetLogPrefix(),
+			"step":   i + 1,
+		}).Debug("Running script step")
+
+		steptime := time.Now()
+		dimension := fmt.Sprintf("step_%d", i+1)
+		stepResult := NewResult()
+		// the step result is added once it has a duration, which a failed step still reports
+		finishStep := func() {
+			stepResult.AddMetric(metric.NewMetric("duration", dimension, metric.MetricNumber, millisBetween(steptime, time.Now()), metric.UnitMilliseconds))
+			crs.Add(stepResult)
+		}
+
+		// Send
+		if step.Send != "" {
+			conn.SetWriteDeadline(stepDeadline)
+			if _, err := io.WriteString(conn, step.Send); err != nil {
+				finishStep()
+				return i, err
+			}
+		}
+
+		// Expect
+		if re != nil {
+			submatches, err := reader.expect(re, stepDeadline)
+			if err != nil {
+				finishStep()
+				return i, err
+			}
+			for g, name := range re.SubexpNames() {
+				if name != "" {
+					stepResult.AddMetric(metric.NewMetric(name, dimension, metric.MetricString, submatches[g], ""))
+				}
+			}
+		}
+		finishStep()
+	}
+	return -1, nil
+}
@@ -0,0 +1,230 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+
+	protocheck "github.com/racker/rackspace-monitoring-poller/protocol/check"
+)
+
+// maxXMPPTagLength bounds a single tag read while negotiating XMPP STARTTLS
+const maxXMPPTagLength = 4096
+
+var (
+	// ErrTCPSSLAndStartTLS indicates both implicit TLS and STARTTLS were requested
+	ErrTCPSSLAndStartTLS = errors.New("ssl and starttls are mutually exclusive")
+	// ErrStartTLSRefused indicates the server declined to upgrade the connection to TLS
+	ErrStartTLSRefused = errors.New("STARTTLS refused")
+)
+
+// startTLSNegotiator runs the protocol specific preamble that precedes the TLS handshake on a connection, where
+// serverName identifies the server to protocols that announce it, unless empty because the check targets an address
+type startTLSNegotiator func(conn net.Conn, serverName string) error
+
+// startTLSNegotiators maps the protocols supported by the starttls option
+var startTLSNegotiators = map[string]startTLSNegotiator{
+	protocheck.TCPStartTLSSMTP:       smtpStartTLS,
+	protocheck.TCPStartTLSIMAP:       imapStartTLS,
+	protocheck.TCPStartTLSPOP3:       pop3StartTLS,
+	protocheck.TCPStartTLSFTP:        ftpStartTLS,
+	protocheck.TCPStartTLSLDAP:       ldapStartTLS,
+	protocheck.TCPStartTLSXMPP:       xmppStartTLS,
+	protocheck.TCPStartTLSPostgreSQL: postgreSQLStartTLS,
+}
+
+// startTLS negotiates the upgrade of the connection by the protocol given and then performs the handshake
+func startTLS(conn net.Conn, protocol string, config *tls.Config) (*tls.Conn, error) {
+	negotiate, ok := startTLSNegotiators[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unsupported starttls %s", protocol)
+	}
+	if err := negotiate(conn, config.ServerName); err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// The buffered readers of the line based protocols below are safe to discard, since a server sends nothing
+// further until the client starts the handshake.
+
+func smtpStartTLS(conn net.Conn, serverName string) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := text.PrintfLine("EHLO %s", DefaultSMTPEhlo); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(250); err != nil {
+		return err
+	}
+	if err := text.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, _, err := text.ReadResponse(220)
+	return err
+}
+
+func ftpStartTLS(conn net.Conn, serverName string) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := text.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+	_, _, err := text.ReadResponse(234)
+	return err
+}
+
+func imapStartTLS(conn net.Conn, serverName string) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		// untagged responses may precede the completion of the command
+		if !strings.HasPrefix(line, "a001 ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "a001 OK") {
+			return fmt.Errorf("%v: %s", ErrStartTLSRefused, line)
+		}
+		return nil
+	}
+}
+
+func pop3StartTLS(conn net.Conn, serverName string) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("%v: %s", ErrStartTLSRefused, line)
+	}
+	return nil
+}
+
+// readXMPPTag reads the stream up to and including the next '>', which ends a tag
+func readXMPPTag(reader *bufio.Reader) (string, error) {
+	var tag []byte
+	for len(tag) < maxXMPPTagLength {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		tag = append(tag, c)
+		if c == '>' {
+			return strings.TrimSpace(string(tag)), nil
+		}
+	}
+	return "", fmt.Errorf("XMPP tag exceeds %d bytes", maxXMPPTagLength)
+}
+
+// xmppStartTLS opens the client stream to the domain of the server, as in RFC 6120, and requests TLS when offered.
+// Without a domain the stream is opened to the default domain of the server.
+func xmppStartTLS(conn net.Conn, serverName string) error {
+	var to bytes.Buffer
+	if serverName != "" {
+		to.WriteString(" to='")
+		xml.EscapeText(&to, []byte(serverName))
+		to.WriteString("'")
+	}
+	if _, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream%s xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", to.String()); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	offered := false
+	for {
+		tag, err := readXMPPTag(reader)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(tag, "<starttls") {
+			offered = true
+		}
+		if tag == "</stream:features>" || strings.HasPrefix(tag, "<stream:features") && strings.HasSuffix(tag, "/>") {
+			break
+		}
+	}
+	if !offered {
+		return errors.New("STARTTLS not supported")
+	}
+
+	if _, err := fmt.Fprint(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	for {
+		tag, err := readXMPPTag(reader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(tag, "<failure"):
+			return ErrStartTLSRefused
+		case strings.HasPrefix(tag, "<proceed") && strings.HasSuffix(tag, "/>"), tag == "</proceed>":
+			return nil
+		}
+	}
+}
+
+func postgreSQLStartTLS(conn net.Conn, serverName string) error {
+	agreed, err := newPostgreSQLConn(conn).sslRequest()
+	if err != nil {
+		return err
+	}
+	if !agreed {
+		return ErrStartTLSRefused
+	}
+	return nil
+}
@@ -59,6 +59,40 @@ func resolveCheckType(checkBase *Base) (Check, error) {
 		return NewPingCheck(checkBase)
 	case "agent.plugin":
 		return NewPluginCheck(checkBase)
+	case "remote.dns":
+		return NewDNSCheck(checkBase)
+	case "remote.smtp":
+		return NewSMTPCheck(checkBase)
+	case "remote.ssh":
+		return NewSSHCheck(checkBase)
+	case "remote.ntp":
+		return NewNTPCheck(checkBase)
+	case "remote.mysql":
+		return NewMySQLCheck(checkBase)
+	case "remote.postgresql":
+		return NewPostgreSQLCheck(checkBase)
+	case "remote.redis":
+		return NewRedisCheck(checkBase)
+	case "remote.memcached":
+		return NewMemcachedCheck(checkBase)
+	case "remote.udp":
+		return NewUDPCheck(checkBase)
+	case "remote.snmp":
+		return NewSNMPCheck(checkBase)
+	case "remote.grpc":
+		return NewGRPCCheck(checkBase)
+	case "remote.websocket":
+		return NewWebSocketCheck(checkBase)
+	case "remote.traceroute":
+		return NewTracerouteCheck(checkBase)
+	case "remote.prometheus":
+		return NewPrometheusCheck(checkBase)
+	case "remote.http_transaction":
+		return NewHTTPTransactionCheck(checkBase)
+	case "remote.tls":
+		return NewTLSCheck(checkBase)
+	case "remote.ldap":
+		return NewLDAPCheck(checkBase)
 	}
 	return nil, errors.New(fmt.Sprintf("Invalid check type: %v", checkBase.CheckType))
 }
@@ -147,26 +147,26 @@ func (at *AgentTracker) runMetricsDecomposer(ctx context.Context) {
 
 			//TODO do something with failed metrics that only contain state and status
 
-			for _, outerWraps := range metric.params.Metrics {
-
-				for _, metricWrap := range outerWraps {
-					for field, entry := range metricWrap {
-						metricName := BuildMetricName(metric.params.EntityId,
-							metric.agent.id,
-							metric.params.CheckType,
-							metric.params.CheckId,
-							field,
-						)
-
-						m := Metric{
-							Name:       metricName,
-							Value:      entry.Value,
-							MetricType: entry.Type,
-						}
-
-						at.metricsRouter.Route(m)
+			for _, metricWrap := range metric.params.Metrics {
+
+				for field, entry := range metricWrap.Metrics {
+					if metricWrap.Dimension != "" {
+						field = metricWrap.Dimension + "." + field
+					}
+					metricName := BuildMetricName(metric.params.EntityId,
+						metric.agent.id,
+						metric.params.CheckType,
+						metric.params.CheckId,
+						field,
+					)
+
+					m := Metric{
+						Name:       metricName,
+						Value:      entry.Value,
+						MetricType: entry.Type,
 					}
 
+					at.metricsRouter.Route(m)
 				}
 
 			}
@@ -22,6 +22,7 @@ import (
 	"github.com/DataDog/datadog-go/statsd"
 	log "github.com/sirupsen/logrus"
 	"github.com/racker/rackspace-monitoring-poller/check"
+	"github.com/racker/rackspace-monitoring-poller/protocol/metric"
 	"fmt"
 	"strings"
 	"os"
@@ -151,6 +152,9 @@ func (d *statsdDistributor) sendToStatsd(crs *check.ResultSet) {
 	for _, result := range crs.Metrics {
 		for name, m := range result.Metrics {
 			metricName := fmt.Sprintf("%s.%s", checkType, name)
+			if m.Dimension != "" && m.Dimension != metric.DimensionNone {
+				metricName = fmt.Sprintf("%s.%s.%s", checkType, m.Dimension, name)
+			}
 			value, err := m.ToFloat64()
 			if err == nil {
 				log.WithField("metric", metricName).Debug("Sending metric to statsd")
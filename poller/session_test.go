@@ -783,10 +783,10 @@ func TestEleSession_CheckTest(t *testing.T) {
 					assert.Equal(t, tt.expected.Result.EntityId, resp.Result.EntityId)
 					assert.Equal(t, tt.expected.Result.CheckType, resp.Result.CheckType)
 					require.Len(t, resp.Result.Metrics, 1)
-					require.Len(t, resp.Result.Metrics[0], 2)
+					require.Empty(t, resp.Result.Metrics[0].Dimension)
 
 					if tt.verifyMetrics != nil {
-						tt.verifyMetrics(t, resp.Result.Metrics[0][1])
+						tt.verifyMetrics(t, resp.Result.Metrics[0].Metrics)
 					}
 
 				}
@@ -0,0 +1,33 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+type DNSCheckDetails struct {
+	Details struct {
+		AnswerMatch string `json:"answer_match"`
+		Port        uint64 `json:"port"`
+		// Protocol is either "udp" (the default) or "tcp"
+		Protocol   string `json:"protocol"`
+		Query      string `json:"query"`
+		RecordType string `json:"record_type"`
+	} `json:"details"`
+}
+
+type DNSCheckOut struct {
+	CheckHeader
+	DNSCheckDetails
+}
@@ -0,0 +1,36 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+type GRPCCheckDetails struct {
+	Details struct {
+		// Authority overrides the :authority pseudo-header, and the TLS server name, which default to the target
+		Authority string `json:"authority"`
+		// ClientCert and ClientKey are PEM encoded and presented when the server requests a client certificate
+		ClientCert string `json:"client_cert"`
+		ClientKey  string `json:"client_key"`
+		Port       uint64 `json:"port"`
+		// Service is the name passed to the health service, where empty asks for the overall server health
+		Service string `json:"service"`
+		UseSSL  bool   `json:"ssl"`
+	} `json:"details"`
+}
+
+type GRPCCheckOut struct {
+	CheckHeader
+	GRPCCheckDetails
+}
@@ -16,17 +16,58 @@
 
 package check
 
+const (
+	// HTTPAuthBasic authenticates by auth_user and auth_password, which is the default when they are given
+	HTTPAuthBasic = "basic"
+	// HTTPAuthDigest authenticates by auth_user and auth_password in response to the server's challenge
+	HTTPAuthDigest = "digest"
+	// HTTPAuthBearer sends auth_token as a bearer token
+	HTTPAuthBearer = "bearer"
+	// HTTPAuthOAuth2 obtains a bearer token by the OAuth2 client credentials grant
+	HTTPAuthOAuth2 = "oauth2"
+)
+
+// HTTPHeaderMatch locates a value within the response header named, where the first group of the regex, if any,
+// is the value captured
+type HTTPHeaderMatch struct {
+	Header string `json:"header"`
+	Regex  string `json:"regex"`
+}
+
+// HTTPOAuth2Details configures the OAuth2 client credentials grant used by HTTPAuthOAuth2, whose token endpoint is
+// reached with the TLS details of the check
+type HTTPOAuth2Details struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	TokenURL     string   `json:"token_url"`
+}
+
 type HTTPCheckDetails struct {
 	Details struct {
-		AuthPassword    string            `json:"auth_password"`
-		AuthUser        string            `json:"auth_user"`
-		Body            string            `json:"body"`
-		BodyMatches     map[string]string `json:"body_matches"`
-		FollowRedirects bool              `json:"follow_redirects"`
-		Headers         map[string]string `json:"headers"`
-		IncludeBody     bool              `json:"include_body"`
-		Method          string            `json:"method"`
-		Url             string            `json:"url"`
+		AuthPassword     string                     `json:"auth_password"`
+		AuthToken        string                     `json:"auth_token"`
+		AuthType         string                     `json:"auth_type"`
+		AuthUser         string                     `json:"auth_user"`
+		Base64Body       bool                       `json:"request_body_base64"`
+		Body             string                     `json:"body"`
+		BodyHash         bool                       `json:"body_hash"`
+		BodyHashIgnore   []string                   `json:"body_hash_ignore"`
+		BodyMatches      map[string]string          `json:"body_matches"`
+		ContentType      string                     `json:"content_type"`
+		FollowRedirects  bool                       `json:"follow_redirects"`
+		ForbiddenHeaders map[string]string          `json:"forbidden_headers"`
+		Form             map[string]string          `json:"form"`
+		HeaderMatches    map[string]HTTPHeaderMatch `json:"header_matches"`
+		Headers          map[string]string          `json:"headers"`
+		IncludeBody      bool                       `json:"include_body"`
+		JSONPaths        map[string]string          `json:"json_paths"`
+		Method           string                     `json:"method"`
+		OAuth2           HTTPOAuth2Details          `json:"oauth2"`
+		RequestBody      string                     `json:"request_body"`
+		RequiredHeaders  map[string]string          `json:"required_headers"`
+		Url              string                     `json:"url"`
+		TLSDetails
 	} `json:"details"`
 }
 
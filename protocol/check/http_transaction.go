@@ -0,0 +1,54 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+// HTTPTransactionCapture locates a value within the response of a step, either by a regex, taking its first
+// group when it has one, or by a JSON path
+type HTTPTransactionCapture struct {
+	JSONPath string `json:"json_path"`
+	Regex    string `json:"regex"`
+}
+
+// HTTPTransactionStep is a single request of a transaction, where ${name} within its url, headers, request_body
+// and form is replaced by the value captured as name by an earlier step
+type HTTPTransactionStep struct {
+	Base64Body      bool                              `json:"request_body_base64"`
+	Body            string                            `json:"body"`
+	Captures        map[string]HTTPTransactionCapture `json:"captures"`
+	ContentType     string                            `json:"content_type"`
+	ExpectedCode    string                            `json:"expected_code"`
+	FollowRedirects bool                              `json:"follow_redirects"`
+	Form            map[string]string                 `json:"form"`
+	Headers         map[string]string                 `json:"headers"`
+	JSONPaths       map[string]string                 `json:"json_paths"`
+	Method          string                            `json:"method"`
+	Name            string                            `json:"name"`
+	RequestBody     string                            `json:"request_body"`
+	Url             string                            `json:"url"`
+}
+
+type HTTPTransactionCheckDetails struct {
+	Details struct {
+		Steps []HTTPTransactionStep `json:"steps"`
+		TLSDetails
+	} `json:"details"`
+}
+
+type HTTPTransactionCheckOut struct {
+	CheckHeader
+	HTTPTransactionCheckDetails
+}
@@ -0,0 +1,46 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+// The scopes of LDAP searches
+const (
+	LDAPScopeBase = "base"
+	LDAPScopeOne  = "one"
+	LDAPScopeSub  = "sub"
+)
+
+// LDAPCheckDetails configures remote.ldap checks, which connect by an ldap:// or ldaps:// url whose host is
+// replaced by the target IP. The bind is anonymous unless bind_dn is given. A search is only performed when
+// base_dn or filter is given.
+type LDAPCheckDetails struct {
+	Details struct {
+		BaseDN    string `json:"base_dn"`
+		BindDN    string `json:"bind_dn"`
+		Filter    string `json:"filter"`
+		Password  string `json:"password"`
+		Scope     string `json:"scope"`
+		SizeLimit uint64 `json:"size_limit"`
+		StartTLS  bool   `json:"starttls"`
+		Url       string `json:"url"`
+		TLSDetails
+	} `json:"details"`
+}
+
+type LDAPCheckOut struct {
+	CheckHeader
+	LDAPCheckDetails
+}
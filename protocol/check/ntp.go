@@ -0,0 +1,31 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+type NTPCheckDetails struct {
+	Details struct {
+		// MaxOffset is the largest absolute clock offset, in seconds, tolerated before the check is unavailable.
+		// Zero disables the threshold.
+		MaxOffset float64 `json:"max_offset"`
+		Port      uint64  `json:"port"`
+	} `json:"details"`
+}
+
+type NTPCheckOut struct {
+	CheckHeader
+	NTPCheckDetails
+}
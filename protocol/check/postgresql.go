@@ -0,0 +1,34 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+type PostgreSQLCheckDetails struct {
+	Details struct {
+		Database string `json:"database"`
+		Password string `json:"password"`
+		Port     uint64 `json:"port"`
+		Query    string `json:"query"`
+		// UseSSL requires TLS, otherwise TLS is used only when the server accepts it
+		UseSSL   bool   `json:"ssl"`
+		Username string `json:"username"`
+	} `json:"details"`
+}
+
+type PostgreSQLCheckOut struct {
+	CheckHeader
+	PostgreSQLCheckDetails
+}
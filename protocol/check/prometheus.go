@@ -0,0 +1,44 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+// PrometheusMatcher selects series by the value of a label, where a missing label has an empty value
+type PrometheusMatcher struct {
+	Label string `json:"label"`
+	// Op is one of =, !=, =~ and !~, as in a PromQL selector. Regular expressions must match the whole value.
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// PrometheusSeries selects the series of a metric family that match all of the matchers
+type PrometheusSeries struct {
+	Name     string              `json:"name"`
+	Matchers []PrometheusMatcher `json:"matchers"`
+}
+
+type PrometheusCheckDetails struct {
+	Details struct {
+		Headers map[string]string  `json:"headers"`
+		Series  []PrometheusSeries `json:"series"`
+		Url     string             `json:"url"`
+	} `json:"details"`
+}
+
+type PrometheusCheckOut struct {
+	CheckHeader
+	PrometheusCheckDetails
+}
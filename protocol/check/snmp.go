@@ -0,0 +1,51 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+// SNMPOID names the metric reported for an OID, or for each OID beneath it when walking
+type SNMPOID struct {
+	Name string `json:"name"`
+	OID  string `json:"oid"`
+}
+
+type SNMPCheckDetails struct {
+	Details struct {
+		// AuthProtocol is one of MD5, SHA, SHA224, SHA256, SHA384 or SHA512 for SNMPv3 authentication
+		AuthProtocol string `json:"auth_protocol"`
+		AuthPassword string `json:"auth_password"`
+		// Community is used by SNMPv2c and defaults to public
+		Community string `json:"community"`
+		// MaxResults bounds the variables retrieved by the walks of the check, and defaults to 1000
+		MaxResults uint64 `json:"max_results"`
+		// Operation is either "get", the default, or "walk" to report every OID beneath each configured OID
+		Operation string    `json:"operation"`
+		OIDs      []SNMPOID `json:"oids"`
+		Port      uint64    `json:"port"`
+		// PrivProtocol is one of DES, AES, AES192, AES256, AES192C or AES256C for SNMPv3 privacy
+		PrivProtocol string `json:"priv_protocol"`
+		PrivPassword string `json:"priv_password"`
+		// Username is the SNMPv3 security name
+		Username string `json:"username"`
+		// Version is either "2c", the default, or "3"
+		Version string `json:"version"`
+	} `json:"details"`
+}
+
+type SNMPCheckOut struct {
+	CheckHeader
+	SNMPCheckDetails
+}
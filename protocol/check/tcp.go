@@ -16,13 +16,37 @@
 
 package check
 
+// The protocols whose upgrade to TLS is negotiated by the starttls option of TCP checks
+const (
+	TCPStartTLSSMTP       = "smtp"
+	TCPStartTLSIMAP       = "imap"
+	TCPStartTLSPOP3       = "pop3"
+	TCPStartTLSFTP        = "ftp"
+	TCPStartTLSLDAP       = "ldap"
+	TCPStartTLSXMPP       = "xmpp"
+	TCPStartTLSPostgreSQL = "postgresql"
+)
+
+// TCPScriptStep is a single exchange of a conversation, which sends Send, if any, and then reads until Expect
+// matches, if given. The named groups of Expect, such as (?P<version>\S+), are captured as metrics. The step
+// fails when Expect does not match within TimeoutMs, which defaults to the remainder of the check's timeout.
+type TCPScriptStep struct {
+	Expect    string `json:"expect"`
+	Name      string `json:"name"`
+	Send      string `json:"send"`
+	TimeoutMs uint64 `json:"timeout_ms"`
+}
+
 type TCPCheckDetails struct {
 	Details struct {
-		BannerMatch string `json:"banner_match"`
-		BodyMatch   string `json:"body_match"`
-		Port        uint64 `json:"port"`
-		SendBody    string `json:"send_body"`
-		UseSSL      bool   `json:"ssl"`
+		BannerMatch string          `json:"banner_match"`
+		BodyMatch   string          `json:"body_match"`
+		Port        uint64          `json:"port"`
+		Script      []TCPScriptStep `json:"script"`
+		SendBody    string          `json:"send_body"`
+		StartTLS    string          `json:"starttls"`
+		UseSSL      bool            `json:"ssl"`
+		TLSDetails
 	} `json:"details"`
 }
 
@@ -0,0 +1,54 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+const (
+	// TLSVerify reports a certificate that fails verification through the cert_error metric, which is the default
+	TLSVerify = "verify"
+	// TLSVerifySkip disables verification of certificates
+	TLSVerifySkip = "skip"
+	// TLSVerifyAndFail fails the connection when the certificate cannot be verified
+	TLSVerifyAndFail = "verify_and_fail"
+)
+
+// TLSDetails configures the TLS connections of the checks whose details embed it, where the client certificate,
+// its key and the CA bundle are given in PEM form
+type TLSDetails struct {
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	MinVersion string `json:"tls_min_version"`
+	ServerName string `json:"tls_server_name"`
+	VerifyMode string `json:"tls_verify"`
+}
+
+// TLSCheckDetails configures remote.tls checks, which only perform the handshake. The certificate is considered
+// critical or warned of when it expires within critical_days or warn_days, where zero disables the threshold.
+type TLSCheckDetails struct {
+	Details struct {
+		ALPN         []string `json:"alpn"`
+		CriticalDays uint64   `json:"critical_days"`
+		Port         uint64   `json:"port"`
+		WarnDays     uint64   `json:"warn_days"`
+		TLSDetails
+	} `json:"details"`
+}
+
+type TLSCheckOut struct {
+	CheckHeader
+	TLSCheckDetails
+}
@@ -0,0 +1,34 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+type UDPCheckDetails struct {
+	Details struct {
+		BodyMatch string `json:"body_match"`
+		Port      uint64 `json:"port"`
+		// Retries is the number of times the datagram is resent when no response arrives
+		Retries  uint64 `json:"retries"`
+		SendBody string `json:"send_body"`
+		// SendBodyEncoding is either "text", the default, or "hex" for binary payloads
+		SendBodyEncoding string `json:"send_body_encoding"`
+	} `json:"details"`
+}
+
+type UDPCheckOut struct {
+	CheckHeader
+	UDPCheckDetails
+}
@@ -0,0 +1,34 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package check
+
+type WebSocketCheckDetails struct {
+	Details struct {
+		// BodyMatch is a regular expression the check waits for a received message to match
+		BodyMatch string            `json:"body_match"`
+		Headers   map[string]string `json:"headers"`
+		// SendBody is sent as a text message once the connection is upgraded
+		SendBody string `json:"send_body"`
+		// Url uses the ws or wss scheme, where wss connects with TLS
+		Url string `json:"url"`
+	} `json:"details"`
+}
+
+type WebSocketCheckOut struct {
+	CheckHeader
+	WebSocketCheckDetails
+}
@@ -166,7 +166,41 @@ func (r *HostInfoResponse) Encode() ([]byte, error) {
 ///////////////////////////////////////////////////////////////////////////////
 // Metrics Post
 
-type MetricWrap []map[string]*MetricTVU
+// MetricWrap pairs the dimension of a set of metrics with the metrics keyed by name. It is conveyed as the
+// array [dimension, metrics], where the dimension is null when the metrics are undimensioned
+type MetricWrap struct {
+	Dimension string
+	Metrics   map[string]*MetricTVU
+}
+
+func (w MetricWrap) MarshalJSON() ([]byte, error) {
+	var dimension *string
+	if w.Dimension != "" {
+		dimension = &w.Dimension
+	}
+	return json.Marshal([]interface{}{dimension, w.Metrics})
+}
+
+func (w *MetricWrap) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return errors.Errorf("Expected dimension and metrics, but got %d elements", len(pair))
+	}
+
+	var dimension *string
+	if err := json.Unmarshal(pair[0], &dimension); err != nil {
+		return errors.Wrap(err, "Unmarshaling dimension")
+	}
+	w.Dimension = ""
+	if dimension != nil {
+		w.Dimension = *dimension
+	}
+	w.Metrics = nil
+	return errors.Wrap(json.Unmarshal(pair[1], &w.Metrics), "Unmarshaling metrics")
+}
 
 type MetricTVU struct {
 	Type  string `json:"t"`
@@ -81,3 +81,23 @@ func TestHandshakeRequest_Encode(t *testing.T) {
 		"\"bundle_version\":\"dev\",\"zone_ids\":null,"+
 		"\"features\":[{\"name\":\"poller\",\"disabled\":false}]}}", string(raw))
 }
+
+func TestMetricWrap_JSON(t *testing.T) {
+	wraps := []protocol.MetricWrap{
+		{Metrics: map[string]*protocol.MetricTVU{"duration": {Type: "i", Value: "5", Unit: "milliseconds"}}},
+		{Dimension: "hop_1", Metrics: map[string]*protocol.MetricTVU{"loss": {Type: "d", Value: "0", Unit: "percent"}}},
+	}
+
+	raw, err := json.Marshal(wraps)
+	require.NoError(t, err)
+	assert.Equal(t, "[[null,{\"duration\":{\"t\":\"i\",\"v\":\"5\",\"u\":\"milliseconds\"}}],"+
+		"[\"hop_1\",{\"loss\":{\"t\":\"d\",\"v\":\"0\",\"u\":\"percent\"}}]]", string(raw))
+
+	var decoded []protocol.MetricWrap
+	err = json.Unmarshal(raw, &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, wraps, decoded)
+
+	var wrap protocol.MetricWrap
+	assert.Error(t, json.Unmarshal([]byte(`[null]`), &wrap))
+}
@@ -28,3 +28,6 @@ const (
 	UnitSeconds      = "SECONDS"
 	UnitPercent      = "PERCENT"
 )
+
+// DimensionNone is the dimension of metrics that are not dimensioned
+const DimensionNone = "none"
@@ -53,7 +53,7 @@ func UnitToString(unit int) string {
 
 func NewMetric(name, metricDimension string, internalMetricType int, value interface{}, unit string) *Metric {
 	if len(metricDimension) == 0 {
-		metricDimension = "none"
+		metricDimension = DimensionNone
 	}
 	metric := &Metric{
 		Type:       internalMetricType,
@@ -68,7 +68,7 @@ func NewMetric(name, metricDimension string, internalMetricType int, value inter
 
 func NewPercentMetricFromInt(name, metricDimension string, portion, total int) *Metric {
 	if len(metricDimension) == 0 {
-		metricDimension = "none"
+		metricDimension = DimensionNone
 	}
 	metric := &Metric{
 		Type:       MetricFloat,
@@ -0,0 +1,166 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Identifier octets of the BER elements used by LDAP, which are limited to tag numbers below 31
+const (
+	BERClassUniversal   = 0x00
+	BERClassApplication = 0x40
+	BERClassContext     = 0x80
+	BERConstructed      = 0x20
+
+	BERTagBoolean     = 0x01
+	BERTagInteger     = 0x02
+	BERTagOctetString = 0x04
+	BERTagEnumerated  = 0x0a
+	BERTagSequence    = BERConstructed | 0x10
+	BERTagSet         = BERConstructed | 0x11
+)
+
+// MaxBERElementLength bounds the length of an element read by ReadBERElement
+var MaxBERElementLength = 4 * 1024 * 1024
+
+var (
+	// ErrBERTruncated indicates the encoding ended within an element
+	ErrBERTruncated = errors.New("truncated BER element")
+	// ErrBERUnsupportedTag indicates a tag number of 31 or more, which needs more than one identifier octet
+	ErrBERUnsupportedTag = errors.New("unsupported BER tag")
+)
+
+// BERElement is a single element of the Basic Encoding Rules of X.690, where Tag is its identifier octet
+type BERElement struct {
+	Tag   byte
+	Value []byte
+}
+
+// NewBERElement encodes an element, where the value of a constructed element is the concatenation of the
+// encodings of its children
+func NewBERElement(tag byte, children ...[]byte) []byte {
+	var value []byte
+	for _, child := range children {
+		value = append(value, child...)
+	}
+	return append(append([]byte{tag}, berLength(len(value))...), value...)
+}
+
+// NewBERInteger encodes an INTEGER, or ENUMERATED by its tag, in the fewest octets
+func NewBERInteger(tag byte, n int64) []byte {
+	value := []byte{byte(n)}
+	for n >>= 8; (n != 0 || value[0]&0x80 != 0) && (n != -1 || value[0]&0x80 == 0); n >>= 8 {
+		value = append([]byte{byte(n)}, value...)
+	}
+	return NewBERElement(tag, value)
+}
+
+// NewBERString encodes an OCTET STRING, or an element of the same form by its tag
+func NewBERString(tag byte, s string) []byte {
+	return NewBERElement(tag, []byte(s))
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var octets []byte
+	for ; n > 0; n >>= 8 {
+		octets = append([]byte{byte(n)}, octets...)
+	}
+	return append([]byte{0x80 | byte(len(octets))}, octets...)
+}
+
+// ReadBERElement reads a single element, such as an LDAP message, from a stream
+func ReadBERElement(r io.Reader) (*BERElement, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0]&0x1f == 0x1f {
+		return nil, ErrBERUnsupportedTag
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		octets := make([]byte, length&0x7f)
+		if len(octets) == 0 || len(octets) > 4 {
+			return nil, fmt.Errorf("unsupported BER length of %d octets", len(octets))
+		}
+		if _, err := io.ReadFull(r, octets); err != nil {
+			return nil, ErrBERTruncated
+		}
+		length = 0
+		for _, octet := range octets {
+			length = length<<8 | int(octet)
+		}
+	}
+	if length > MaxBERElementLength {
+		return nil, fmt.Errorf("BER element of %d bytes exceeds %d", length, MaxBERElementLength)
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, ErrBERTruncated
+	}
+	return &BERElement{Tag: header[0], Value: value}, nil
+}
+
+// Children decodes the elements within the value of a constructed element
+func (e *BERElement) Children() ([]*BERElement, error) {
+	var children []*BERElement
+	data := e.Value
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, ErrBERTruncated
+		}
+		if data[0]&0x1f == 0x1f {
+			return nil, ErrBERUnsupportedTag
+		}
+		offset, length := 2, int(data[1])
+		if length&0x80 != 0 {
+			n := length & 0x7f
+			if n == 0 || n > 4 || len(data) < 2+n {
+				return nil, ErrBERTruncated
+			}
+			length = 0
+			for _, octet := range data[2 : 2+n] {
+				length = length<<8 | int(octet)
+			}
+			offset += n
+		}
+		if length < 0 || len(data) < offset+length {
+			return nil, ErrBERTruncated
+		}
+		children = append(children, &BERElement{Tag: data[0], Value: data[offset : offset+length]})
+		data = data[offset+length:]
+	}
+	return children, nil
+}
+
+// Int decodes the value of an INTEGER or ENUMERATED
+func (e *BERElement) Int() (int64, error) {
+	if len(e.Value) == 0 || len(e.Value) > 8 {
+		return 0, fmt.Errorf("invalid BER integer of %d octets", len(e.Value))
+	}
+	n := int64(int8(e.Value[0]))
+	for _, octet := range e.Value[1:] {
+		n = n<<8 | int64(octet)
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBERElement_LDAPStartTLS(t *testing.T) {
+	encoded := utils.NewBERElement(utils.BERTagSequence,
+		utils.NewBERInteger(utils.BERTagInteger, 1),
+		utils.NewBERElement(utils.BERClassApplication|utils.BERConstructed|23,
+			utils.NewBERString(utils.BERClassContext|0, "1.3.6.1.4.1.1466.20037")))
+
+	expected := append([]byte{0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16}, "1.3.6.1.4.1.1466.20037"...)
+	assert.Equal(t, expected, encoded)
+}
+
+func TestNewBERInteger(t *testing.T) {
+	for n, expected := range map[int64][]byte{
+		0:    {0x02, 0x01, 0x00},
+		127:  {0x02, 0x01, 0x7f},
+		128:  {0x02, 0x02, 0x00, 0x80},
+		256:  {0x02, 0x02, 0x01, 0x00},
+		-1:   {0x02, 0x01, 0xff},
+		-128: {0x02, 0x01, 0x80},
+		-129: {0x02, 0x02, 0xff, 0x7f},
+	} {
+		encoded := utils.NewBERInteger(utils.BERTagInteger, n)
+		assert.Equal(t, expected, encoded, "%d", n)
+
+		element, err := utils.ReadBERElement(bytes.NewReader(encoded))
+		require.NoError(t, err)
+		decoded, err := element.Int()
+		require.NoError(t, err)
+		assert.Equal(t, n, decoded)
+	}
+}
+
+func TestReadBERElement_LongForm(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	encoded := utils.NewBERElement(utils.BERTagSequence,
+		utils.NewBERString(utils.BERTagOctetString, long),
+		utils.NewBERInteger(utils.BERTagEnumerated, 49))
+	assert.Equal(t, []byte{0x30, 0x82, 0x01, 0x33, 0x04, 0x82, 0x01, 0x2c}, encoded[:8])
+
+	// the stream continues beyond the element
+	r := bytes.NewReader(append(encoded, 0x30, 0x00))
+	element, err := utils.ReadBERElement(r)
+	require.NoError(t, err)
+	assert.Equal(t, byte(utils.BERTagSequence), element.Tag)
+	assert.Equal(t, 2, r.Len())
+
+	children, err := element.Children()
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+	assert.Equal(t, long, string(children[0].Value))
+	code, err := children[1].Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(49), code)
+}
+
+func TestReadBERElement_Truncated(t *testing.T) {
+	_, err := utils.ReadBERElement(bytes.NewReader([]byte{0x30, 0x05, 0x02, 0x01}))
+	assert.Equal(t, utils.ErrBERTruncated, err)
+
+	element := &utils.BERElement{Tag: utils.BERTagSequence, Value: []byte{0x02, 0x05, 0x01}}
+	_, err = element.Children()
+	assert.Equal(t, utils.ErrBERTruncated, err)
+}
+
+func TestReadBERElement_TooLong(t *testing.T) {
+	_, err := utils.ReadBERElement(bytes.NewReader([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff}))
+	assert.EqualError(t, err, "BER element of 2147483647 bytes exceeds 4194304")
+}
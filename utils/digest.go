@@ -0,0 +1,167 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// DigestScheme is the scheme named by the WWW-Authenticate and Authorization headers of digest authentication
+const DigestScheme = "Digest"
+
+// ErrDigestQOPNotSupported indicates the challenge requires integrity protection, which is not supported
+var ErrDigestQOPNotSupported = errors.New("digest qop not supported")
+
+// DigestChallenge is a digest authentication challenge of a server, as described by RFC 7616
+type DigestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	QOP       []string
+}
+
+// ParseDigestChallenge parses the value of a WWW-Authenticate header, returning nil when it is not a digest
+// challenge
+func ParseDigestChallenge(header string) *DigestChallenge {
+	if len(header) <= len(DigestScheme) || !strings.EqualFold(header[:len(DigestScheme)], DigestScheme) ||
+		header[len(DigestScheme)] != ' ' {
+		return nil
+	}
+	params := parseAuthParams(header[len(DigestScheme)+1:])
+	challenge := &DigestChallenge{
+		Realm:     params["realm"],
+		Nonce:     params["nonce"],
+		Opaque:    params["opaque"],
+		Algorithm: params["algorithm"],
+	}
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if qop = strings.TrimSpace(qop); qop != "" {
+			challenge.QOP = append(challenge.QOP, qop)
+		}
+	}
+	return challenge
+}
+
+// parseAuthParams parses the comma separated name=value pairs of a challenge, where values may be quoted
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value []byte
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value = append(value, s[i])
+			}
+			if i < len(s) {
+				// skip the closing quote
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = []byte(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[name] = string(value)
+	}
+}
+
+// Authorization computes the value of the Authorization header responding to the challenge for a request of the
+// method and uri, being the request target such as /path?query. The nonce count, nc, starts at 1 for each
+// challenge, and cnonce is a random value chosen by the client.
+func (c *DigestChallenge) Authorization(username, password, method, uri string, nc int, cnonce string) (string, error) {
+	var newHash func() hash.Hash
+	algorithm := strings.ToUpper(c.Algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", c.Algorithm)
+	}
+	h := func(s string) string {
+		digest := newHash()
+		digest.Write([]byte(s))
+		return hex.EncodeToString(digest.Sum(nil))
+	}
+
+	qop := ""
+	if len(c.QOP) > 0 {
+		for _, offered := range c.QOP {
+			if offered == "auth" {
+				qop = offered
+			}
+		}
+		if qop == "" {
+			return "", ErrDigestQOPNotSupported
+		}
+	}
+
+	ha1 := h(username + ":" + c.Realm + ":" + password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.Nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	ncValue := fmt.Sprintf("%08x", nc)
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + c.Nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.Nonce + ":" + ncValue + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, username),
+		fmt.Sprintf(`realm="%s"`, c.Realm),
+		fmt.Sprintf(`nonce="%s"`, c.Nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+	}
+	if c.Algorithm != "" {
+		fields = append(fields, "algorithm="+c.Algorithm)
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+ncValue, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	fields = append(fields, fmt.Sprintf(`response="%s"`, response))
+	if c.Opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, c.Opaque))
+	}
+	return DigestScheme + " " + strings.Join(fields, ", "), nil
+}
@@ -0,0 +1,96 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDigestChallenge(t *testing.T) {
+	challenge := utils.ParseDigestChallenge(`Digest realm="http-auth@example.org", qop="auth, auth-int", ` +
+		`algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="say \"hi\""`)
+
+	require.NotNil(t, challenge)
+	assert.Equal(t, &utils.DigestChallenge{
+		Realm:     "http-auth@example.org",
+		Nonce:     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		Opaque:    `say "hi"`,
+		Algorithm: "SHA-256",
+		QOP:       []string{"auth", "auth-int"},
+	}, challenge)
+
+	assert.Nil(t, utils.ParseDigestChallenge(`Basic realm="example"`))
+	assert.Nil(t, utils.ParseDigestChallenge(`Digestive realm="example"`))
+}
+
+func TestDigestChallenge_Authorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		password string
+		cnonce   string
+		response string
+	}{
+		{
+			name:     "rfc2617",
+			header:   `Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+			password: "Circle Of Life",
+			cnonce:   "0a4f113b",
+			response: `response="6629fae49393a05397450978507c4ef1"`,
+		},
+		{
+			name:     "rfc7616 md5",
+			header:   `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			password: "Circle of Life",
+			cnonce:   "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			response: `response="8ca523f5e9506fed4657c9700eebdbec"`,
+		},
+		{
+			name:     "rfc7616 sha-256",
+			header:   `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			password: "Circle of Life",
+			cnonce:   "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			response: `response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge := utils.ParseDigestChallenge(tt.header)
+			require.NotNil(t, challenge)
+
+			authorization, err := challenge.Authorization("Mufasa", tt.password, "GET", "/dir/index.html", 1, tt.cnonce)
+			require.NoError(t, err)
+			assert.Contains(t, authorization, tt.response)
+			assert.Contains(t, authorization, "qop=auth, nc=00000001")
+		})
+	}
+}
+
+func TestDigestChallenge_AuthorizationUnsupported(t *testing.T) {
+	_, err := utils.ParseDigestChallenge(`Digest realm="r", nonce="n", qop="auth-int"`).
+		Authorization("user", "pass", "GET", "/", 1, "c")
+	assert.Equal(t, utils.ErrDigestQOPNotSupported, err)
+
+	_, err = utils.ParseDigestChallenge(`Digest realm="r", nonce="n", algorithm=SHA-512-256`).
+		Authorization("user", "pass", "GET", "/", 1, "c")
+	assert.EqualError(t, err, "unsupported digest algorithm SHA-512-256")
+}
@@ -0,0 +1,280 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONPathLength is the path segment that evaluates to the length of an array, object or string, as in GJSON
+const JSONPathLength = "#"
+
+var jsonPathOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// JSONPath is a compiled expression that locates a value within a JSON document, optionally compared against a
+// JSON literal such that it becomes an assertion. Both the JSONPath style, such as $.items[0].name, and the
+// GJSON style, such as items.0.name, are accepted.
+type JSONPath struct {
+	segments []string
+	operator string
+	operand  interface{}
+}
+
+// DecodeJSON decodes a JSON document such that numbers are kept as json.Number, as expected by JSONPath
+func DecodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// CompileJSONPath parses a path expression, such as $.status or $.status == "ok"
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	path := &JSONPath{}
+	pathExpr := expr
+	if i, operator := findJSONPathOperator(expr); i >= 0 {
+		pathExpr = expr[:i]
+		path.operator = operator
+		operand, err := parseJSONPathOperand(strings.TrimSpace(expr[i+len(operator):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid operand in %q: %v", expr, err)
+		}
+		path.operand = operand
+	}
+
+	segments, err := parseJSONPathSegments(strings.TrimSpace(pathExpr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %v", expr, err)
+	}
+	path.segments = segments
+	return path, nil
+}
+
+// IsAssertion indicates the expression compares the value, so evaluates to a bool
+func (p *JSONPath) IsAssertion() bool {
+	return p.operator != ""
+}
+
+// Evaluate locates the value within a document decoded by DecodeJSON, reporting false when it is not present.
+// An assertion always evaluates to its outcome, which is false when the value is not present.
+func (p *JSONPath) Evaluate(doc interface{}) (interface{}, bool) {
+	value, ok := p.locate(doc)
+	if p.IsAssertion() {
+		return ok && compareJSON(value, p.operator, p.operand), true
+	}
+	return value, ok
+}
+
+func (p *JSONPath) locate(value interface{}) (interface{}, bool) {
+	for _, segment := range p.segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if segment == JSONPathLength {
+				value = json.Number(strconv.Itoa(len(v)))
+				continue
+			}
+			var ok bool
+			if value, ok = v[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			if segment == JSONPathLength {
+				value = json.Number(strconv.Itoa(len(v)))
+				continue
+			}
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, false
+			}
+			if index < 0 {
+				index += len(v)
+			}
+			if index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		case string:
+			if segment != JSONPathLength {
+				return nil, false
+			}
+			value = json.Number(strconv.Itoa(len(v)))
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// findJSONPathOperator locates the first comparison operator that is not within quotes or brackets
+func findJSONPathOperator(expr string) (int, string) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			for _, operator := range jsonPathOperators {
+				if strings.HasPrefix(expr[i:], operator) {
+					return i, operator
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parseJSONPathOperand(literal string) (interface{}, error) {
+	// allow the single quoted strings of JSONPath filter expressions
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return literal[1 : len(literal)-1], nil
+	}
+	return DecodeJSON([]byte(literal))
+}
+
+func parseJSONPathSegments(expr string) ([]string, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	if !strings.HasPrefix(expr, "$") {
+		return parseGJSONSegments(expr), nil
+	}
+
+	var segments []string
+	rest := expr[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty segment")
+			}
+			segments = append(segments, rest[1:end+1])
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [")
+			}
+			segment := strings.TrimSpace(rest[1:end])
+			if len(segment) >= 2 && (segment[0] == '\'' || segment[0] == '"') && segment[len(segment)-1] == segment[0] {
+				segment = segment[1 : len(segment)-1]
+			}
+			segments = append(segments, segment)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// parseGJSONSegments splits a dotted path, where a dot is escaped by a backslash
+func parseGJSONSegments(expr string) []string {
+	var segments []string
+	var segment []byte
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr):
+			i++
+			segment = append(segment, expr[i])
+		case expr[i] == '.':
+			segments = append(segments, string(segment))
+			segment = nil
+		default:
+			segment = append(segment, expr[i])
+		}
+	}
+	return append(segments, string(segment))
+}
+
+// compareJSON compares decoded JSON values, where numbers and strings are ordered and other types are only equal
+// to themselves
+func compareJSON(value interface{}, operator string, operand interface{}) bool {
+	var cmp int
+	switch v := value.(type) {
+	case json.Number:
+		o, ok := operand.(json.Number)
+		if !ok {
+			return operator == "!="
+		}
+		vf, err1 := v.Float64()
+		of, err2 := o.Float64()
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		switch {
+		case vf < of:
+			cmp = -1
+		case vf > of:
+			cmp = 1
+		}
+	case string:
+		o, ok := operand.(string)
+		if !ok {
+			return operator == "!="
+		}
+		cmp = strings.Compare(v, o)
+	default:
+		equal := reflect.DeepEqual(value, operand)
+		switch operator {
+		case "==":
+			return equal
+		case "!=":
+			return !equal
+		}
+		return false
+	}
+
+	switch operator {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jsonPathDocument = `{
+	"status": "ok",
+	"count": 3,
+	"ratio": 0.5,
+	"enabled": true,
+	"owner": null,
+	"items": [{"name": "a", "size": 1}, {"name": "b", "size": 2}],
+	"dotted.key": "escaped"
+}`
+
+func TestJSONPath_Evaluate(t *testing.T) {
+	doc, err := utils.DecodeJSON([]byte(jsonPathDocument))
+	require.NoError(t, err)
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+		found    bool
+	}{
+		{expr: "$.status", expected: "ok", found: true},
+		{expr: "status", expected: "ok", found: true},
+		{expr: "$.count", expected: json.Number("3"), found: true},
+		{expr: "$.enabled", expected: true, found: true},
+		{expr: "$.owner", expected: nil, found: true},
+		{expr: "$.items[1].name", expected: "b", found: true},
+		{expr: "$['items'][-1]['size']", expected: json.Number("2"), found: true},
+		{expr: "items.0.name", expected: "a", found: true},
+		{expr: "items.#", expected: json.Number("2"), found: true},
+		{expr: `dotted\.key`, expected: "escaped", found: true},
+		{expr: "$.items[2]", found: false},
+		{expr: "$.missing.value", found: false},
+		{expr: "$.status.name", found: false},
+		{expr: `$.status == "ok"`, expected: true, found: true},
+		{expr: "$.status == 'ok'", expected: true, found: true},
+		{expr: `$.status != "ok"`, expected: false, found: true},
+		{expr: "$.count > 2", expected: true, found: true},
+		{expr: "$.ratio <= 0.25", expected: false, found: true},
+		{expr: "$.enabled == true", expected: true, found: true},
+		{expr: "$.owner == null", expected: true, found: true},
+		{expr: "$.count == '3'", expected: false, found: true},
+		{expr: "$.missing == 1", expected: false, found: true},
+		{expr: "items.# >= 2", expected: true, found: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			path, err := utils.CompileJSONPath(tt.expr)
+			require.NoError(t, err)
+
+			value, found := path.Evaluate(doc)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
+
+func TestJSONPath_CompileErrors(t *testing.T) {
+	for _, expr := range []string{"", "$..status", "$.items[0", "$status", "$.status == nope"} {
+		_, err := utils.CompileJSONPath(expr)
+		assert.Error(t, err, expr)
+	}
+}
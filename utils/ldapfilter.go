@@ -0,0 +1,197 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The context specific tags of the choices of an LDAP Filter, as defined by RFC 4511
+const (
+	ldapFilterAnd            = BERClassContext | BERConstructed | 0
+	ldapFilterOr             = BERClassContext | BERConstructed | 1
+	ldapFilterNot            = BERClassContext | BERConstructed | 2
+	ldapFilterEqualityMatch  = BERClassContext | BERConstructed | 3
+	ldapFilterSubstrings     = BERClassContext | BERConstructed | 4
+	ldapFilterGreaterOrEqual = BERClassContext | BERConstructed | 5
+	ldapFilterLessOrEqual    = BERClassContext | BERConstructed | 6
+	ldapFilterPresent        = BERClassContext | 7
+	ldapFilterApproxMatch    = BERClassContext | BERConstructed | 8
+
+	ldapSubstringInitial = BERClassContext | 0
+	ldapSubstringAny     = BERClassContext | 1
+	ldapSubstringFinal   = BERClassContext | 2
+)
+
+// CompileLDAPFilter encodes the string representation of an LDAP search filter, such as
+// (&(objectClass=person)(uid=j*)), as described by RFC 4515. Extensible matches are not supported.
+func CompileLDAPFilter(filter string) ([]byte, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		// the outer parentheses are commonly omitted from a simple filter
+		filter = "(" + filter + ")"
+	}
+	encoded, rest, err := compileLDAPFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", filter, rest)
+	}
+	return encoded, nil
+}
+
+// compileLDAPFilter encodes the parenthesized filter at the start of s, returning the remainder of s
+func compileLDAPFilter(s string) ([]byte, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("expected ( at %q", s)
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", fmt.Errorf("unterminated (")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(ldapFilterAnd)
+		if s[0] == '|' {
+			tag = ldapFilterOr
+		}
+		var children [][]byte
+		rest := s[1:]
+		for strings.HasPrefix(rest, "(") {
+			child, r, err := compileLDAPFilter(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			children = append(children, child)
+			rest = r
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", fmt.Errorf("unterminated (")
+		}
+		return NewBERElement(tag, children...), rest[1:], nil
+	case '!':
+		child, rest, err := compileLDAPFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", fmt.Errorf("unterminated (")
+		}
+		return NewBERElement(ldapFilterNot, child), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("unterminated (")
+	}
+	item, err := compileLDAPFilterItem(s[:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return item, s[end+1:], nil
+}
+
+// compileLDAPFilterItem encodes a simple, presence or substring filter, such as uid=j*
+func compileLDAPFilterItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("expected attribute=value in %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := byte(ldapFilterEqualityMatch)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag = ldapFilterGreaterOrEqual
+	case '<':
+		tag = ldapFilterLessOrEqual
+	case '~':
+		tag = ldapFilterApproxMatch
+	case ':':
+		return nil, fmt.Errorf("extensible match not supported in %q", item)
+	}
+	if tag != ldapFilterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" || strings.ContainsAny(attr, "()*\\ ") {
+		return nil, fmt.Errorf("invalid attribute in %q", item)
+	}
+
+	if tag == ldapFilterEqualityMatch && value == "*" {
+		return NewBERString(ldapFilterPresent, attr), nil
+	}
+	parts := strings.Split(value, "*")
+	if tag != ldapFilterEqualityMatch && len(parts) > 1 {
+		return nil, fmt.Errorf("unexpected * in %q", item)
+	}
+	if len(parts) == 1 {
+		unescaped, err := unescapeLDAPFilterValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return NewBERElement(tag, NewBERString(BERTagOctetString, attr), NewBERString(BERTagOctetString, unescaped)), nil
+	}
+
+	var substrings [][]byte
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		unescaped, err := unescapeLDAPFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+		partTag := byte(ldapSubstringAny)
+		switch i {
+		case 0:
+			partTag = ldapSubstringInitial
+		case len(parts) - 1:
+			partTag = ldapSubstringFinal
+		}
+		substrings = append(substrings, NewBERString(partTag, unescaped))
+	}
+	return NewBERElement(ldapFilterSubstrings,
+		NewBERString(BERTagOctetString, attr),
+		NewBERElement(BERTagSequence, substrings...)), nil
+}
+
+// unescapeLDAPFilterValue decodes the \XX hex escapes of a filter value
+func unescapeLDAPFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var unescaped []byte
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			unescaped = append(unescaped, value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+		b, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+		unescaped = append(unescaped, b[0])
+		i += 2
+	}
+	return string(unescaped), nil
+}
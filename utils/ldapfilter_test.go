@@ -0,0 +1,79 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ldapString(tag byte, s string) []byte {
+	return utils.NewBERString(tag, s)
+}
+
+func ldapAssertion(tag byte, attr, value string) []byte {
+	return utils.NewBERElement(tag, ldapString(utils.BERTagOctetString, attr), ldapString(utils.BERTagOctetString, value))
+}
+
+func TestCompileLDAPFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected []byte
+	}{
+		{"(objectClass=*)", ldapString(0x87, "objectClass")},
+		{"uid=jdoe", ldapAssertion(0xa3, "uid", "jdoe")},
+		{"(uidNumber>=1000)", ldapAssertion(0xa5, "uidNumber", "1000")},
+		{"(uidNumber<=2000)", ldapAssertion(0xa6, "uidNumber", "2000")},
+		{"(cn~=john)", ldapAssertion(0xa8, "cn", "john")},
+		{`(cn=a\2ab\29)`, ldapAssertion(0xa3, "cn", "a*b)")},
+		{"(cn=j*n*e)", utils.NewBERElement(0xa4, ldapString(utils.BERTagOctetString, "cn"),
+			utils.NewBERElement(utils.BERTagSequence, ldapString(0x80, "j"), ldapString(0x81, "n"), ldapString(0x82, "e")))},
+		{"(cn=*doe)", utils.NewBERElement(0xa4, ldapString(utils.BERTagOctetString, "cn"),
+			utils.NewBERElement(utils.BERTagSequence, ldapString(0x82, "doe")))},
+		{"(&(objectClass=person)(|(uid=j*)(!(mail=*))))", utils.NewBERElement(0xa0,
+			ldapAssertion(0xa3, "objectClass", "person"),
+			utils.NewBERElement(0xa1,
+				utils.NewBERElement(0xa4, ldapString(utils.BERTagOctetString, "uid"),
+					utils.NewBERElement(utils.BERTagSequence, ldapString(0x80, "j"))),
+				utils.NewBERElement(0xa2, ldapString(0x87, "mail"))))},
+	}
+	for _, test := range tests {
+		encoded, err := utils.CompileLDAPFilter(test.filter)
+		require.NoError(t, err, test.filter)
+		assert.Equal(t, test.expected, encoded, test.filter)
+	}
+}
+
+func TestCompileLDAPFilter_Invalid(t *testing.T) {
+	for _, filter := range []string{
+		"(uid=jdoe",
+		"(&(uid=jdoe)",
+		"(uid=jdoe))",
+		"(=jdoe)",
+		"(uid)",
+		"(uid>=j*)",
+		`(cn=\2)`,
+		`(cn=\zz)`,
+		"(cn:dn:=john)",
+	} {
+		_, err := utils.CompileLDAPFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
@@ -0,0 +1,550 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SNMP versions, as carried by messages
+const (
+	SNMPVersion2c = 1
+	SNMPVersion3  = 3
+)
+
+// Identifier octets of SNMP PDUs, as defined by RFC 3416
+const (
+	SNMPGetRequest     = BERClassContext | BERConstructed | 0
+	SNMPGetNextRequest = BERClassContext | BERConstructed | 1
+	SNMPResponse       = BERClassContext | BERConstructed | 2
+	SNMPGetBulkRequest = BERClassContext | BERConstructed | 5
+	SNMPReport         = BERClassContext | BERConstructed | 8
+)
+
+// Identifier octets of the values of SNMP variables, as defined by RFC 2578 and RFC 3416, in addition to
+// BERTagInteger and BERTagOctetString
+const (
+	SNMPNull             = 0x05
+	SNMPObjectIdentifier = 0x06
+	SNMPIPAddress        = BERClassApplication | 0
+	SNMPCounter32        = BERClassApplication | 1
+	SNMPGauge32          = BERClassApplication | 2
+	SNMPTimeTicks        = BERClassApplication | 3
+	SNMPOpaque           = BERClassApplication | 4
+	SNMPCounter64        = BERClassApplication | 6
+	SNMPNoSuchObject     = BERClassContext | 0
+	SNMPNoSuchInstance   = BERClassContext | 1
+	SNMPEndOfMibView     = BERClassContext | 2
+)
+
+// The msgFlags of SNMPv3 messages
+const (
+	SNMPFlagAuth       = 0x01
+	SNMPFlagPriv       = 0x02
+	SNMPFlagReportable = 0x04
+)
+
+const (
+	// snmpMaxMessageSize is the default msgMaxSize of SNMPv3 messages, which is the largest UDP payload
+	snmpMaxMessageSize = 65507
+	// snmpSecurityModelUSM identifies the User-based Security Model of RFC 3414
+	snmpSecurityModelUSM = 3
+)
+
+// ErrSNMPMalformed indicates a message did not have the structure of RFC 3416 or RFC 3412
+var ErrSNMPMalformed = errors.New("malformed SNMP message")
+
+// snmpErrorStatusNames names the error-status of responses, as defined by RFC 3416
+var snmpErrorStatusNames = []string{"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr",
+	"noAccess", "wrongType", "wrongLength", "wrongEncoding", "wrongValue", "noCreation", "inconsistentValue",
+	"resourceUnavailable", "commitFailed", "undoFailed", "authorizationError", "notWritable", "inconsistentName"}
+
+// SNMPError is the error-status of a response
+type SNMPError int64
+
+func (e SNMPError) Error() string {
+	if e >= 0 && int(e) < len(snmpErrorStatusNames) {
+		return "SNMP error: " + snmpErrorStatusNames[e]
+	}
+	return fmt.Sprintf("SNMP error: %d", int64(e))
+}
+
+// SNMPVariable is a variable binding, whose Value is decoded by its Type: int64 for INTEGER, uint64 for Counter32,
+// Gauge32, TimeTicks and Counter64, []byte for OCTET STRING and other Opaque values, a dotted string for OBJECT
+// IDENTIFIER and IpAddress, float32 or float64 for the floats carried by Opaque, and nil for NULL and the exceptions
+type SNMPVariable struct {
+	OID   string
+	Type  byte
+	Value interface{}
+}
+
+// SNMPPDU is a protocol data unit, where the ErrorStatus and ErrorIndex of a GetBulkRequest are its non-repeaters
+// and max-repetitions
+type SNMPPDU struct {
+	Type        byte
+	RequestID   int64
+	ErrorStatus int64
+	ErrorIndex  int64
+	Variables   []SNMPVariable
+}
+
+// SNMPMessage is an SNMPv2c message, or an SNMPv3 message secured by the User-based Security Model of RFC 3414,
+// where the context engine is always the authoritative engine
+type SNMPMessage struct {
+	Version   int64
+	Community string
+
+	MsgID       int64
+	Flags       byte
+	EngineID    []byte
+	EngineBoots int64
+	EngineTime  int64
+	UserName    string
+	ContextName string
+	// MaxSize is the msgMaxSize, which is the largest UDP payload when zero
+	MaxSize int64
+
+	PDU SNMPPDU
+}
+
+// NormalizeSNMPOID returns an OID in the dotted form used by SNMPVariable, without a leading dot
+func NormalizeSNMPOID(oid string) string {
+	return strings.TrimPrefix(strings.TrimSpace(oid), ".")
+}
+
+// CompareSNMPOIDs orders OIDs in the lexicographical order of their arcs, as agents do
+func CompareSNMPOIDs(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, _ := strconv.ParseUint(pa[i], 10, 64)
+		nb, _ := strconv.ParseUint(pb[i], 10, 64)
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// SNMPOIDHasPrefix determines if the OID is beneath the root
+func SNMPOIDHasPrefix(oid, root string) bool {
+	return strings.HasPrefix(oid, root+".")
+}
+
+func marshalSNMPOID(oid string) ([]byte, error) {
+	parts := strings.Split(NormalizeSNMPOID(oid), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = arc
+	}
+	if arcs[0] > 2 || arcs[0] < 2 && arcs[1] >= 40 || arcs[1] > math.MaxUint64-80 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+
+	value := appendBase128(nil, arcs[0]*40+arcs[1])
+	for _, arc := range arcs[2:] {
+		value = appendBase128(value, arc)
+	}
+	return NewBERElement(SNMPObjectIdentifier, value), nil
+}
+
+func appendBase128(b []byte, n uint64) []byte {
+	octets := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		octets = append([]byte{byte(n&0x7f) | 0x80}, octets...)
+	}
+	return append(b, octets...)
+}
+
+func unmarshalSNMPOID(value []byte) (string, error) {
+	if len(value) == 0 || value[len(value)-1]&0x80 != 0 {
+		return "", ErrSNMPMalformed
+	}
+	var arcs []string
+	var n uint64
+	for _, octet := range value {
+		if n > math.MaxUint64>>7 {
+			return "", ErrSNMPMalformed
+		}
+		n = n<<7 | uint64(octet&0x7f)
+		if octet&0x80 != 0 {
+			continue
+		}
+		if arcs == nil {
+			first := n / 40
+			if first > 2 {
+				first = 2
+			}
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(n-first*40, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(n, 10))
+		}
+		n = 0
+	}
+	return strings.Join(arcs, "."), nil
+}
+
+// newSNMPUint encodes an unsigned value, such as a Counter64, which may need a leading zero octet
+func newSNMPUint(tag byte, n uint64) []byte {
+	value := []byte{byte(n)}
+	for n >>= 8; n != 0; n >>= 8 {
+		value = append([]byte{byte(n)}, value...)
+	}
+	if value[0]&0x80 != 0 {
+		value = append([]byte{0}, value...)
+	}
+	return NewBERElement(tag, value)
+}
+
+func snmpUint(value []byte) (uint64, error) {
+	if len(value) == 0 || len(value) > 9 || len(value) == 9 && value[0] != 0 {
+		return 0, ErrSNMPMalformed
+	}
+	var n uint64
+	for _, octet := range value {
+		n = n<<8 | uint64(octet)
+	}
+	return n, nil
+}
+
+func (v *SNMPVariable) marshalValue() ([]byte, error) {
+	invalid := fmt.Errorf("invalid value for SNMP type 0x%02x of %s", v.Type, v.OID)
+	switch v.Type {
+	case BERTagInteger:
+		n, ok := v.Value.(int64)
+		if !ok {
+			return nil, invalid
+		}
+		return NewBERInteger(v.Type, n), nil
+	case BERTagOctetString:
+		b, ok := v.Value.([]byte)
+		if !ok {
+			return nil, invalid
+		}
+		return NewBERElement(v.Type, b), nil
+	case SNMPCounter32, SNMPGauge32, SNMPTimeTicks, SNMPCounter64:
+		n, ok := v.Value.(uint64)
+		if !ok {
+			return nil, invalid
+		}
+		return newSNMPUint(v.Type, n), nil
+	case SNMPObjectIdentifier:
+		oid, ok := v.Value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		return marshalSNMPOID(oid)
+	case SNMPIPAddress:
+		s, _ := v.Value.(string)
+		ip := net.ParseIP(s).To4()
+		if ip == nil {
+			return nil, invalid
+		}
+		return NewBERElement(v.Type, ip), nil
+	case SNMPOpaque:
+		// floats are wrapped in the opaque by the encoding of draft-perkins-opaque-01
+		switch value := v.Value.(type) {
+		case float32:
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, math.Float32bits(value))
+			return NewBERElement(v.Type, []byte{0x9f, 0x78, 4}, b), nil
+		case float64:
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, math.Float64bits(value))
+			return NewBERElement(v.Type, []byte{0x9f, 0x79, 8}, b), nil
+		case []byte:
+			return NewBERElement(v.Type, value), nil
+		}
+		return nil, invalid
+	case SNMPNull, SNMPNoSuchObject, SNMPNoSuchInstance, SNMPEndOfMibView:
+		return NewBERElement(v.Type), nil
+	}
+	return nil, fmt.Errorf("unsupported SNMP type 0x%02x of %s", v.Type, v.OID)
+}
+
+func unmarshalSNMPValue(e *BERElement) (interface{}, error) {
+	switch e.Tag {
+	case BERTagInteger:
+		return e.Int()
+	case SNMPCounter32, SNMPGauge32, SNMPTimeTicks, SNMPCounter64:
+		return snmpUint(e.Value)
+	case SNMPObjectIdentifier:
+		return unmarshalSNMPOID(e.Value)
+	case SNMPIPAddress:
+		if len(e.Value) != net.IPv4len {
+			return nil, ErrSNMPMalformed
+		}
+		return net.IP(e.Value).String(), nil
+	case SNMPOpaque:
+		switch {
+		case len(e.Value) == 7 && bytes.HasPrefix(e.Value, []byte{0x9f, 0x78, 4}):
+			return math.Float32frombits(binary.BigEndian.Uint32(e.Value[3:])), nil
+		case len(e.Value) == 11 && bytes.HasPrefix(e.Value, []byte{0x9f, 0x79, 8}):
+			return math.Float64frombits(binary.BigEndian.Uint64(e.Value[3:])), nil
+		}
+		return append([]byte(nil), e.Value...), nil
+	case SNMPNull, SNMPNoSuchObject, SNMPNoSuchInstance, SNMPEndOfMibView:
+		return nil, nil
+	}
+	return append([]byte(nil), e.Value...), nil
+}
+
+func (p *SNMPPDU) marshal() ([]byte, error) {
+	var bindings []byte
+	for i := range p.Variables {
+		oid, err := marshalSNMPOID(p.Variables[i].OID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.Variables[i].marshalValue()
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, NewBERElement(BERTagSequence, oid, value)...)
+	}
+	return NewBERElement(p.Type,
+		NewBERInteger(BERTagInteger, p.RequestID),
+		NewBERInteger(BERTagInteger, p.ErrorStatus),
+		NewBERInteger(BERTagInteger, p.ErrorIndex),
+		NewBERElement(BERTagSequence, bindings)), nil
+}
+
+func (p *SNMPPDU) unmarshal(e *BERElement) error {
+	fields, err := e.Children()
+	if err != nil || len(fields) != 4 || fields[3].Tag != BERTagSequence {
+		return ErrSNMPMalformed
+	}
+	p.Type = e.Tag
+	if p.RequestID, err = fields[0].Int(); err != nil {
+		return ErrSNMPMalformed
+	}
+	if p.ErrorStatus, err = fields[1].Int(); err != nil {
+		return ErrSNMPMalformed
+	}
+	if p.ErrorIndex, err = fields[2].Int(); err != nil {
+		return ErrSNMPMalformed
+	}
+	bindings, err := fields[3].Children()
+	if err != nil {
+		return ErrSNMPMalformed
+	}
+	p.Variables = make([]SNMPVariable, len(bindings))
+	for i, binding := range bindings {
+		pair, err := binding.Children()
+		if err != nil || len(pair) != 2 || pair[0].Tag != SNMPObjectIdentifier {
+			return ErrSNMPMalformed
+		}
+		oid, err := unmarshalSNMPOID(pair[0].Value)
+		if err != nil {
+			return err
+		}
+		value, err := unmarshalSNMPValue(pair[1])
+		if err != nil {
+			return err
+		}
+		p.Variables[i] = SNMPVariable{OID: oid, Type: pair[1].Tag, Value: value}
+	}
+	return nil
+}
+
+// Marshal encodes the message, which is authenticated and encrypted by the USM as its flags require
+func (m *SNMPMessage) Marshal(usm *SNMPUSM) ([]byte, error) {
+	pdu, err := m.PDU.marshal()
+	if err != nil {
+		return nil, err
+	}
+	version := NewBERInteger(BERTagInteger, m.Version)
+	if m.Version != SNMPVersion3 {
+		return NewBERElement(BERTagSequence, version, NewBERString(BERTagOctetString, m.Community), pdu), nil
+	}
+
+	maxSize := m.MaxSize
+	if maxSize == 0 {
+		maxSize = snmpMaxMessageSize
+	}
+	header := append(version, NewBERElement(BERTagSequence,
+		NewBERInteger(BERTagInteger, m.MsgID),
+		NewBERInteger(BERTagInteger, maxSize),
+		NewBERElement(BERTagOctetString, []byte{m.Flags}),
+		NewBERInteger(BERTagInteger, snmpSecurityModelUSM))...)
+	data := NewBERElement(BERTagSequence,
+		NewBERElement(BERTagOctetString, m.EngineID),
+		NewBERString(BERTagOctetString, m.ContextName),
+		pdu)
+
+	var keys *snmpKeys
+	var authParams, privParams []byte
+	if m.Flags&(SNMPFlagAuth|SNMPFlagPriv) != 0 {
+		if keys, err = usm.localizedKeys(m.Flags, m.EngineID); err != nil {
+			return nil, err
+		}
+		authParams = make([]byte, usm.auth.digestLength)
+	}
+	if m.Flags&SNMPFlagPriv != 0 {
+		var encrypted []byte
+		if encrypted, privParams, err = usm.encrypt(keys, m.EngineBoots, m.EngineTime, data); err != nil {
+			return nil, err
+		}
+		data = NewBERElement(BERTagOctetString, encrypted)
+	}
+
+	// the digest covers the whole message, so it is computed over zeros that are then replaced
+	securityHead := append(append(append(
+		NewBERElement(BERTagOctetString, m.EngineID),
+		NewBERInteger(BERTagInteger, m.EngineBoots)...),
+		NewBERInteger(BERTagInteger, m.EngineTime)...),
+		NewBERString(BERTagOctetString, m.UserName)...)
+	authElement := NewBERElement(BERTagOctetString, authParams)
+	securityTail := NewBERElement(BERTagOctetString, privParams)
+	security := NewBERElement(BERTagSequence, securityHead, authElement, securityTail)
+	securityParams := NewBERElement(BERTagOctetString, security)
+	message := NewBERElement(BERTagSequence, header, securityParams, data)
+
+	if m.Flags&SNMPFlagAuth != 0 {
+		offset := len(message) - len(header) - len(securityParams) - len(data) +
+			len(header) +
+			len(securityParams) - len(security) +
+			len(security) - len(securityHead) - len(authElement) - len(securityTail) +
+			len(securityHead) +
+			len(authElement) - len(authParams)
+		copy(message[offset:], usm.authenticate(keys, message))
+	}
+	return message, nil
+}
+
+// UnmarshalSNMPMessage decodes a message, which is verified and decrypted by the USM as its flags require. When
+// the message fails authentication or decryption, its header is returned with the error, such that an agent is able
+// to report the failure.
+func UnmarshalSNMPMessage(data []byte, usm *SNMPUSM) (*SNMPMessage, error) {
+	// the elements alias the copy, such that the digest is zeroed in place to verify it
+	data = append([]byte(nil), data...)
+	top, err := (&BERElement{Value: data}).Children()
+	if err != nil || len(top) != 1 || top[0].Tag != BERTagSequence {
+		return nil, ErrSNMPMalformed
+	}
+	fields, err := top[0].Children()
+	if err != nil || len(fields) < 3 {
+		return nil, ErrSNMPMalformed
+	}
+	m := &SNMPMessage{}
+	if m.Version, err = fields[0].Int(); err != nil {
+		return nil, ErrSNMPMalformed
+	}
+	if m.Version != SNMPVersion3 {
+		if len(fields) != 3 || fields[1].Tag != BERTagOctetString {
+			return nil, ErrSNMPMalformed
+		}
+		m.Community = string(fields[1].Value)
+		if err := m.PDU.unmarshal(fields[2]); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	if len(fields) != 4 || fields[2].Tag != BERTagOctetString {
+		return nil, ErrSNMPMalformed
+	}
+	global, err := fields[1].Children()
+	if err != nil || len(global) != 4 || len(global[2].Value) != 1 {
+		return nil, ErrSNMPMalformed
+	}
+	if m.MsgID, err = global[0].Int(); err != nil {
+		return nil, ErrSNMPMalformed
+	}
+	if m.MaxSize, err = global[1].Int(); err != nil {
+		return nil, ErrSNMPMalformed
+	}
+	m.Flags = global[2].Value[0]
+	if model, err := global[3].Int(); err != nil || model != snmpSecurityModelUSM {
+		return nil, ErrSNMPMalformed
+	}
+
+	security, err := (&BERElement{Value: fields[2].Value}).Children()
+	if err != nil || len(security) != 1 {
+		return nil, ErrSNMPMalformed
+	}
+	params, err := security[0].Children()
+	if err != nil || len(params) != 6 {
+		return nil, ErrSNMPMalformed
+	}
+	m.EngineID = append([]byte(nil), params[0].Value...)
+	if m.EngineBoots, err = params[1].Int(); err != nil {
+		return nil, ErrSNMPMalformed
+	}
+	if m.EngineTime, err = params[2].Int(); err != nil {
+		return nil, ErrSNMPMalformed
+	}
+	m.UserName = string(params[3].Value)
+
+	scoped := fields[3]
+	if m.Flags&(SNMPFlagAuth|SNMPFlagPriv) != 0 {
+		keys, err := usm.localizedKeys(m.Flags, m.EngineID)
+		if err != nil {
+			return m, err
+		}
+		digest := append([]byte(nil), params[4].Value...)
+		for i := range params[4].Value {
+			params[4].Value[i] = 0
+		}
+		if !hmac.Equal(digest, usm.authenticate(keys, data)) {
+			return m, ErrSNMPWrongDigest
+		}
+		if m.Flags&SNMPFlagPriv != 0 {
+			if scoped.Tag != BERTagOctetString {
+				return m, ErrSNMPDecryption
+			}
+			plaintext, err := usm.decrypt(keys, m.EngineBoots, m.EngineTime, params[5].Value, scoped.Value)
+			if err != nil {
+				return m, err
+			}
+			// DES pads the plaintext, so only the first element is decoded
+			if scoped, err = ReadBERElement(bytes.NewReader(plaintext)); err != nil {
+				return m, ErrSNMPDecryption
+			}
+		}
+	}
+
+	if scoped.Tag != BERTagSequence {
+		return nil, ErrSNMPMalformed
+	}
+	context, err := scoped.Children()
+	if err != nil || len(context) != 3 {
+		return nil, ErrSNMPMalformed
+	}
+	m.ContextName = string(context[1].Value)
+	if err := m.PDU.unmarshal(context[2]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
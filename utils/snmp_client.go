@@ -0,0 +1,233 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MaxSNMPMessageLength is the largest response that is received
+const MaxSNMPMessageLength = 65535
+
+var (
+	// ErrSNMPTimeout indicates the agent did not respond within the timeout
+	ErrSNMPTimeout = errors.New("request timeout")
+	// ErrSNMPDiscovery indicates the agent did not report its engine when discovered, as in RFC 3414 section 4
+	ErrSNMPDiscovery = errors.New("engine discovery failed")
+	// ErrSNMPOIDNotIncreasing indicates a walk was answered by an OID that does not follow the previous one
+	ErrSNMPOIDNotIncreasing = errors.New("OID not increasing")
+	// ErrSNMPTooManyVariables indicates a walk found more variables than it was allowed to return
+	ErrSNMPTooManyVariables = errors.New("too many variables")
+)
+
+// snmpReportErrors maps the usmStats counters of RFC 3414 that are reported for a failed request
+var snmpReportErrors = map[string]error{
+	"1.3.6.1.6.3.15.1.1.1.0": ErrSNMPSecurityLevel,
+	"1.3.6.1.6.3.15.1.1.2.0": errors.New("not in time window"),
+	"1.3.6.1.6.3.15.1.1.3.0": errors.New("unknown user name"),
+	"1.3.6.1.6.3.15.1.1.4.0": errors.New("unknown engine ID"),
+	"1.3.6.1.6.3.15.1.1.5.0": ErrSNMPWrongDigest,
+	"1.3.6.1.6.3.15.1.1.6.0": ErrSNMPDecryption,
+}
+
+// snmpNotInTimeWindow is the usmStats counter reported when the engine time of a request is stale
+const snmpNotInTimeWindow = "1.3.6.1.6.3.15.1.1.2.0"
+
+// SNMPClient issues the requests of an SNMPv2c or SNMPv3 manager over a connected UDP socket, where every request
+// of the session must be answered before the deadline
+type SNMPClient struct {
+	Conn      net.Conn
+	Deadline  time.Time
+	Version   int64
+	Community string
+	// UserName and USM secure SNMPv3 requests, where a nil USM is noAuthNoPriv
+	UserName string
+	USM      *SNMPUSM
+
+	requestID int64
+	// the authoritative engine, which is discovered by the first SNMPv3 request
+	engineID    []byte
+	engineBoots int64
+	engineTime  int64
+	discovered  time.Time
+}
+
+func snmpNullVariables(oids []string) []SNMPVariable {
+	variables := make([]SNMPVariable, len(oids))
+	for i, oid := range oids {
+		variables[i] = SNMPVariable{OID: NormalizeSNMPOID(oid), Type: SNMPNull}
+	}
+	return variables
+}
+
+// Get retrieves the variables of the OIDs by a GetRequest
+func (c *SNMPClient) Get(oids []string) ([]SNMPVariable, error) {
+	return c.request(SNMPPDU{Type: SNMPGetRequest, Variables: snmpNullVariables(oids)})
+}
+
+// GetNext retrieves the variables that follow the OIDs by a GetNextRequest
+func (c *SNMPClient) GetNext(oids []string) ([]SNMPVariable, error) {
+	return c.request(SNMPPDU{Type: SNMPGetNextRequest, Variables: snmpNullVariables(oids)})
+}
+
+// GetBulk retrieves the variables that follow the OIDs by a GetBulkRequest
+func (c *SNMPClient) GetBulk(oids []string, nonRepeaters, maxRepetitions int) ([]SNMPVariable, error) {
+	return c.request(SNMPPDU{
+		Type:        SNMPGetBulkRequest,
+		ErrorStatus: int64(nonRepeaters),
+		ErrorIndex:  int64(maxRepetitions),
+		Variables:   snmpNullVariables(oids),
+	})
+}
+
+// Walk retrieves every variable beneath the root by GetBulkRequests. When there are more than maxVariables, those
+// retrieved are returned with ErrSNMPTooManyVariables.
+func (c *SNMPClient) Walk(root string, maxRepetitions, maxVariables int) ([]SNMPVariable, error) {
+	root = NormalizeSNMPOID(root)
+	var variables []SNMPVariable
+	oid := root
+	for {
+		response, err := c.GetBulk([]string{oid}, 0, maxRepetitions)
+		if err != nil {
+			return nil, err
+		}
+		if len(response) == 0 {
+			return variables, nil
+		}
+		for _, v := range response {
+			if v.Type == SNMPEndOfMibView || !SNMPOIDHasPrefix(v.OID, root) {
+				return variables, nil
+			}
+			if CompareSNMPOIDs(v.OID, oid) <= 0 {
+				return nil, ErrSNMPOIDNotIncreasing
+			}
+			if len(variables) == maxVariables {
+				return variables, ErrSNMPTooManyVariables
+			}
+			variables = append(variables, v)
+			oid = v.OID
+		}
+	}
+}
+
+func (c *SNMPClient) request(pdu SNMPPDU) ([]SNMPVariable, error) {
+	if c.Version == SNMPVersion3 && c.engineID == nil {
+		if err := c.discover(); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := c.exchange(pdu, c.USM.Flags())
+	if err == nil && response.PDU.Type == SNMPReport && response.Flags&SNMPFlagAuth != 0 &&
+		len(response.PDU.Variables) > 0 && response.PDU.Variables[0].OID == snmpNotInTimeWindow {
+		// the authenticated report carries the engine's current time, with which the request is retried once
+		c.synchronize(response)
+		response, err = c.exchange(pdu, c.USM.Flags())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.PDU.Type == SNMPReport {
+		if len(response.PDU.Variables) == 0 {
+			return nil, ErrSNMPMalformed
+		}
+		if err, ok := snmpReportErrors[response.PDU.Variables[0].OID]; ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("SNMP report %s", response.PDU.Variables[0].OID)
+	}
+	if response.PDU.ErrorStatus != 0 {
+		return nil, SNMPError(response.PDU.ErrorStatus)
+	}
+	return response.PDU.Variables, nil
+}
+
+// discover learns the identity, boots and time of the authoritative engine from the report of an unauthenticated
+// request, as in RFC 3414 section 4
+func (c *SNMPClient) discover() error {
+	response, err := c.exchange(SNMPPDU{Type: SNMPGetRequest}, 0)
+	if err != nil {
+		return err
+	}
+	if response.PDU.Type != SNMPReport || len(response.EngineID) == 0 {
+		return ErrSNMPDiscovery
+	}
+	c.synchronize(response)
+	return nil
+}
+
+func (c *SNMPClient) synchronize(response *SNMPMessage) {
+	c.engineID = response.EngineID
+	c.engineBoots = response.EngineBoots
+	c.engineTime = response.EngineTime
+	c.discovered = time.Now()
+}
+
+// exchange sends the request and waits for its response, ignoring responses to other requests and those that do
+// not satisfy the security level of the request
+func (c *SNMPClient) exchange(pdu SNMPPDU, flags byte) (*SNMPMessage, error) {
+	c.requestID = (c.requestID + 1) & 0x7fffffff
+	pdu.RequestID = c.requestID
+	request := &SNMPMessage{Version: c.Version, Community: c.Community, PDU: pdu}
+	if c.Version == SNMPVersion3 {
+		request.MsgID = c.requestID
+		request.Flags = flags | SNMPFlagReportable
+		if c.engineID != nil {
+			request.EngineID = c.engineID
+			request.EngineBoots = c.engineBoots
+			request.EngineTime = c.engineTime + int64(time.Since(c.discovered)/time.Second)
+			request.UserName = c.UserName
+		}
+	}
+	data, err := request.Marshal(c.USM)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Conn.SetDeadline(c.Deadline)
+	if _, err := c.Conn.Write(data); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, MaxSNMPMessageLength)
+	for {
+		n, err := c.Conn.Read(buffer)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, ErrSNMPTimeout
+			}
+			return nil, err
+		}
+		response, err := UnmarshalSNMPMessage(buffer[:n], c.USM)
+		if err != nil || response.Version != c.Version {
+			continue
+		}
+		if c.Version != SNMPVersion3 {
+			if response.PDU.RequestID == pdu.RequestID {
+				return response, nil
+			}
+			continue
+		}
+		// reports of security failures are not authenticated, since the agent could not verify the request
+		if response.MsgID == request.MsgID &&
+			(response.PDU.Type == SNMPReport || response.Flags&SNMPFlagAuth == flags&SNMPFlagAuth) {
+			return response, nil
+		}
+	}
+}
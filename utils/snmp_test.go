@@ -0,0 +1,251 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils_test
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/racker/rackspace-monitoring-poller/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSNMPMessage_MarshalGetRequest(t *testing.T) {
+	message := &utils.SNMPMessage{
+		Version:   utils.SNMPVersion2c,
+		Community: "public",
+		PDU: utils.SNMPPDU{
+			Type:      utils.SNMPGetRequest,
+			RequestID: 1,
+			Variables: []utils.SNMPVariable{{OID: ".1.3.6.1.2.1.1.1.0", Type: utils.SNMPNull}},
+		},
+	}
+	encoded, err := message.Marshal(nil)
+	require.NoError(t, err)
+
+	expected := []byte{0x30, 0x26, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x19, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00}
+	assert.Equal(t, expected, encoded)
+}
+
+func snmpTestVariables() []utils.SNMPVariable {
+	return []utils.SNMPVariable{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: utils.BERTagOctetString, Value: []byte("Test Switch")},
+		{OID: "1.3.6.1.2.1.1.2.0", Type: utils.SNMPObjectIdentifier, Value: "1.3.6.1.4.1.9.1.516"},
+		{OID: "1.3.6.1.2.1.1.3.0", Type: utils.SNMPTimeTicks, Value: uint64(123456)},
+		{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: utils.SNMPCounter32, Value: uint64(math.MaxUint32)},
+		{OID: "1.3.6.1.2.1.31.1.1.1.6.1", Type: utils.SNMPCounter64, Value: uint64(math.MaxUint64)},
+		{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: utils.SNMPIPAddress, Value: "10.0.0.1"},
+		{OID: "1.3.6.1.4.1.2021.10.1.5.1", Type: utils.BERTagInteger, Value: int64(-42)},
+		{OID: "1.3.6.1.4.1.2021.10.1.6.1", Type: utils.SNMPOpaque, Value: float32(0.5)},
+		{OID: "1.3.6.1.4.1.2021.10.1.6.2", Type: utils.SNMPOpaque, Value: float64(1.25)},
+		{OID: "1.3.6.1.2.1.1.9.0", Type: utils.SNMPNoSuchObject},
+		{OID: "2.999.1", Type: utils.SNMPEndOfMibView},
+	}
+}
+
+func TestSNMPMessage_RoundTrip(t *testing.T) {
+	message := &utils.SNMPMessage{
+		Version:   utils.SNMPVersion2c,
+		Community: "s3cret",
+		PDU:       utils.SNMPPDU{Type: utils.SNMPResponse, RequestID: 0x7fffffff, Variables: snmpTestVariables()},
+	}
+	encoded, err := message.Marshal(nil)
+	require.NoError(t, err)
+
+	decoded, err := utils.UnmarshalSNMPMessage(encoded, nil)
+	require.NoError(t, err)
+	assert.Equal(t, message, decoded)
+}
+
+func TestSNMPMessage_USM(t *testing.T) {
+	for _, test := range []struct {
+		auth string
+		priv string
+	}{
+		{"", ""},
+		{"MD5", ""},
+		{"SHA", "DES"},
+		{"SHA", "AES"},
+		{"SHA224", "AES192"},
+		{"SHA256", "AES256"},
+		{"MD5", "AES256C"},
+		{"SHA384", "AES192C"},
+		{"SHA512", "AES"},
+	} {
+		t.Run(test.auth+test.priv, func(t *testing.T) {
+			usm, err := utils.NewSNMPUSM(test.auth, "authpass", test.priv, "privpass")
+			require.NoError(t, err)
+			message := &utils.SNMPMessage{
+				Version:     utils.SNMPVersion3,
+				MsgID:       7,
+				MaxSize:     1472,
+				Flags:       usm.Flags(),
+				EngineID:    []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 't', 'e', 's', 't'},
+				EngineBoots: 3,
+				EngineTime:  1234,
+				UserName:    "monitor",
+				PDU:         utils.SNMPPDU{Type: utils.SNMPResponse, RequestID: 7, Variables: snmpTestVariables()},
+			}
+			encoded, err := message.Marshal(usm)
+			require.NoError(t, err)
+			if test.priv != "" {
+				assert.NotContains(t, string(encoded), "Test Switch")
+			}
+
+			decoded, err := utils.UnmarshalSNMPMessage(encoded, usm)
+			require.NoError(t, err)
+			assert.Equal(t, message, decoded)
+
+			if test.auth != "" {
+				other, err := utils.NewSNMPUSM(test.auth, "wrongpass", test.priv, "privpass")
+				require.NoError(t, err)
+				decoded, err = utils.UnmarshalSNMPMessage(encoded, other)
+				assert.Equal(t, utils.ErrSNMPWrongDigest, err)
+				require.NotNil(t, decoded)
+				assert.Equal(t, int64(7), decoded.MsgID)
+
+				_, err = utils.UnmarshalSNMPMessage(encoded, nil)
+				assert.Equal(t, utils.ErrSNMPSecurityLevel, err)
+			}
+		})
+	}
+}
+
+func TestNewSNMPUSM_Invalid(t *testing.T) {
+	for _, test := range []struct {
+		auth, authPassword, priv, privPassword string
+		err                                    string
+	}{
+		{"SHA1", "authpass", "", "", "unsupported auth_protocol: SHA1"},
+		{"SHA", "authpass", "ROT13", "privpass", "unsupported priv_protocol: ROT13"},
+		{"", "", "AES", "privpass", utils.ErrSNMPPrivWithoutAuth.Error()},
+		{"SHA", "", "", "", utils.ErrSNMPEmptyPassword.Error()},
+	} {
+		_, err := utils.NewSNMPUSM(test.auth, test.authPassword, test.priv, test.privPassword)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+func TestCompareSNMPOIDs(t *testing.T) {
+	assert.True(t, utils.CompareSNMPOIDs("1.3.6.1.2.1.2.2.1.10.2", "1.3.6.1.2.1.2.2.1.10.10") < 0)
+	assert.True(t, utils.CompareSNMPOIDs("1.3.6.1.2.1.2", "1.3.6.1.2.1.2.1") < 0)
+	assert.True(t, utils.CompareSNMPOIDs("1.3.6.1.2.1.31", "1.3.6.1.2.1.4") > 0)
+	assert.Equal(t, 0, utils.CompareSNMPOIDs("1.3.6.1", "1.3.6.1"))
+	assert.True(t, utils.SNMPOIDHasPrefix("1.3.6.1.2.1.2.2.1.10.1", "1.3.6.1.2.1.2.2.1.10"))
+	assert.False(t, utils.SNMPOIDHasPrefix("1.3.6.1.2.1.2.2.1.100", "1.3.6.1.2.1.2.2.1.10"))
+}
+
+// snmpCapture decodes a message captured from net-snmp's snmpget querying demo.snmplabs.com
+func snmpCapture(t *testing.T, dump string) []byte {
+	data, err := hex.DecodeString(dump)
+	require.NoError(t, err)
+	return data
+}
+
+func TestSNMPMessage_Captured(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     string
+		capture  string
+		userName string
+		msgID    int64
+		time     int64
+		reqID    int64
+	}{
+		{
+			name: "SHA224",
+			auth: "SHA224",
+			capture: "308184020103300e02025f84020205c0040105020103043f303d040e80004fb805636c6f75644dab22cc02012b0203" +
+				"203ea5040f7573722d7368613232342d6e6f6e65041066cd2d9b04cd48b02a9df0c77dc3415d0400302e040e80004fb8" +
+				"05636c6f75644dab22cc0400a01a02023ced020100020100300e300c06082b060102010101000500",
+			userName: "usr-sha224-none",
+			msgID:    0x5f84,
+			time:     2113189,
+			reqID:    0x3ced,
+		},
+		{
+			name: "SHA512",
+			auth: "SHA512",
+			capture: "3081a4020103300e0202366e020205c0040105020103045f305d040e80004fb805636c6f75644dab22cc02012b0203" +
+				"203eea040f7573722d7368613531322d6e6f6e65043026f8087ced336a394642b8698eba9810929a9bfa44afbf43975a" +
+				"7ad6c4cc55bd279b549a77ec56d791467612747d6f570400302e040e80004fb805636c6f75644dab22cc0400a01a0202" +
+				"14d9020100020100300e300c06082b060102010101000500",
+			userName: "usr-sha512-none",
+			msgID:    0x366e,
+			time:     2113258,
+			reqID:    0x14d9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usm, err := utils.NewSNMPUSM(tt.auth, "authkey1", "", "")
+			require.NoError(t, err)
+			captured := snmpCapture(t, tt.capture)
+
+			decoded, err := utils.UnmarshalSNMPMessage(captured, usm)
+			require.NoError(t, err)
+			assert.Equal(t, &utils.SNMPMessage{
+				Version:     utils.SNMPVersion3,
+				MsgID:       tt.msgID,
+				MaxSize:     1472,
+				Flags:       utils.SNMPFlagAuth | utils.SNMPFlagReportable,
+				EngineID:    snmpCapture(t, "80004fb805636c6f75644dab22cc"),
+				EngineBoots: 43,
+				EngineTime:  tt.time,
+				UserName:    tt.userName,
+				PDU: utils.SNMPPDU{
+					Type:      utils.SNMPGetRequest,
+					RequestID: tt.reqID,
+					Variables: []utils.SNMPVariable{{OID: "1.3.6.1.2.1.1.1.0", Type: utils.SNMPNull}},
+				},
+			}, decoded)
+
+			// the same message is encoded and authenticated identically
+			encoded, err := decoded.Marshal(usm)
+			require.NoError(t, err)
+			assert.Equal(t, captured, encoded)
+
+			captured[len(captured)-3] ^= 0xff
+			_, err = utils.UnmarshalSNMPMessage(captured, usm)
+			assert.Equal(t, utils.ErrSNMPWrongDigest, err)
+		})
+	}
+}
+
+func TestSNMPMessage_CapturedDiscoveryReport(t *testing.T) {
+	captured := snmpCapture(t, "3081950201033011020"+"4056d2b82020300ffe304010002010304"+
+		"2a302804188000"+"4fb8054445534b544f502d4a3732533245343ab63bc8020102020300c47a040004000400"+
+		"305104188000"+"4fb8054445534b544f502d4a3732533245343ab63bc80414666f726569676e666f726d6174"+
+		"732f6c696e7578a81f020444fa16e1020100020100301130"+"0f060a2b060106030f0101040041011"+"5")
+
+	decoded, err := utils.UnmarshalSNMPMessage(captured, nil)
+	require.NoError(t, err)
+	assert.Equal(t, snmpCapture(t, "80004fb8054445534b544f502d4a3732533245343ab63bc8"), decoded.EngineID)
+	assert.Equal(t, int64(2), decoded.EngineBoots)
+	assert.Equal(t, int64(0xc47a), decoded.EngineTime)
+	assert.Equal(t, "foreignformats/linux", decoded.ContextName)
+	assert.Equal(t, utils.SNMPPDU{
+		Type:      utils.SNMPReport,
+		RequestID: 1157240545,
+		Variables: []utils.SNMPVariable{{OID: "1.3.6.1.6.3.15.1.1.4.0", Type: utils.SNMPCounter32, Value: uint64(21)}},
+	}, decoded.PDU)
+}
@@ -0,0 +1,281 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// snmpPasswordToKeyLength is the length of the repeated password that is hashed into a key, as in RFC 3414 A.2
+const snmpPasswordToKeyLength = 1024 * 1024
+
+var (
+	// ErrSNMPAuthProtocol indicates an authentication protocol other than MD5, SHA, SHA224, SHA256, SHA384 or SHA512
+	ErrSNMPAuthProtocol = errors.New("unsupported auth_protocol")
+	// ErrSNMPPrivProtocol indicates a privacy protocol other than DES, AES, AES192, AES256, AES192C or AES256C
+	ErrSNMPPrivProtocol = errors.New("unsupported priv_protocol")
+	// ErrSNMPPrivWithoutAuth indicates privacy was requested without authentication, which RFC 3414 does not allow
+	ErrSNMPPrivWithoutAuth = errors.New("priv_protocol requires auth_protocol")
+	// ErrSNMPEmptyPassword indicates an authentication or privacy protocol was given without a password
+	ErrSNMPEmptyPassword = errors.New("empty SNMPv3 password")
+	// ErrSNMPSecurityLevel indicates a message was secured beyond the protocols of the USM
+	ErrSNMPSecurityLevel = errors.New("unsupported security level")
+	// ErrSNMPWrongDigest indicates a message failed authentication
+	ErrSNMPWrongDigest = errors.New("wrong digest")
+	// ErrSNMPDecryption indicates a message could not be decrypted
+	ErrSNMPDecryption = errors.New("decryption error")
+)
+
+// snmpAuthProtocol is an authentication protocol of RFC 3414 or RFC 7860
+type snmpAuthProtocol struct {
+	hash func() hash.Hash
+	// digestLength is that of the truncated HMAC carried by msgAuthenticationParameters
+	digestLength int
+}
+
+var snmpAuthProtocols = map[string]*snmpAuthProtocol{
+	"MD5":    {md5.New, 12},
+	"SHA":    {sha1.New, 12},
+	"SHA224": {sha256.New224, 16},
+	"SHA256": {sha256.New, 24},
+	"SHA384": {sha512.New384, 32},
+	"SHA512": {sha512.New, 48},
+}
+
+// snmpPrivProtocol is the DES privacy protocol of RFC 3414, or an AES privacy protocol of RFC 3826 and its
+// extension to longer keys
+type snmpPrivProtocol struct {
+	des       bool
+	keyLength int
+	// reeder extends a localized key that is too short by the method of draft-reeder-snmpv3-usm-3desede, rather
+	// than that of draft-blumenthal-aes-usm
+	reeder bool
+}
+
+var snmpPrivProtocols = map[string]*snmpPrivProtocol{
+	"DES":     {des: true, keyLength: 16},
+	"AES":     {keyLength: 16},
+	"AES192":  {keyLength: 24},
+	"AES256":  {keyLength: 32},
+	"AES192C": {keyLength: 24, reeder: true},
+	"AES256C": {keyLength: 32, reeder: true},
+}
+
+// snmpKeys are the keys of a user localized to an engine
+type snmpKeys struct {
+	auth []byte
+	priv []byte
+}
+
+// SNMPUSM holds the credentials of a user of the User-based Security Model of RFC 3414, caching the keys that are
+// localized to each engine
+type SNMPUSM struct {
+	auth *snmpAuthProtocol
+	priv *snmpPrivProtocol
+	// authKey and privKey are derived from the passwords, but not yet localized
+	authKey []byte
+	privKey []byte
+
+	keys map[string]*snmpKeys
+	salt uint64
+}
+
+// NewSNMPUSM derives the keys of a user by the protocols named, where an empty name disables authentication or
+// privacy
+func NewSNMPUSM(authProtocol, authPassword, privProtocol, privPassword string) (*SNMPUSM, error) {
+	usm := &SNMPUSM{keys: make(map[string]*snmpKeys)}
+	if authProtocol != "" {
+		var ok bool
+		if usm.auth, ok = snmpAuthProtocols[authProtocol]; !ok {
+			return nil, fmt.Errorf("%v: %s", ErrSNMPAuthProtocol, authProtocol)
+		}
+		if authPassword == "" {
+			return nil, ErrSNMPEmptyPassword
+		}
+		usm.authKey = snmpPasswordToKey(usm.auth.hash, []byte(authPassword))
+	}
+	if privProtocol != "" {
+		var ok bool
+		if usm.priv, ok = snmpPrivProtocols[privProtocol]; !ok {
+			return nil, fmt.Errorf("%v: %s", ErrSNMPPrivProtocol, privProtocol)
+		}
+		if usm.auth == nil {
+			return nil, ErrSNMPPrivWithoutAuth
+		}
+		if privPassword == "" {
+			return nil, ErrSNMPEmptyPassword
+		}
+		usm.privKey = snmpPasswordToKey(usm.auth.hash, []byte(privPassword))
+	}
+
+	// the salt only needs to be unlikely to repeat, so it starts from a random value
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	usm.salt = binary.BigEndian.Uint64(salt)
+	return usm, nil
+}
+
+// Flags returns the msgFlags of the security level of the user
+func (u *SNMPUSM) Flags() byte {
+	var flags byte
+	if u != nil && u.auth != nil {
+		flags |= SNMPFlagAuth
+	}
+	if u != nil && u.priv != nil {
+		flags |= SNMPFlagPriv
+	}
+	return flags
+}
+
+// snmpPasswordToKey hashes a megabyte of the repeated password, as in RFC 3414 A.2
+func snmpPasswordToKey(newHash func() hash.Hash, password []byte) []byte {
+	h := newHash()
+	chunk := make([]byte, 64)
+	for i := 0; i < snmpPasswordToKeyLength; i += len(chunk) {
+		for j := range chunk {
+			chunk[j] = password[(i+j)%len(password)]
+		}
+		h.Write(chunk)
+	}
+	return h.Sum(nil)
+}
+
+// snmpLocalizeKey localizes a key to an engine, as in RFC 3414 A.2
+func snmpLocalizeKey(newHash func() hash.Hash, key, engineID []byte) []byte {
+	h := newHash()
+	h.Write(key)
+	h.Write(engineID)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// localizedKeys returns the keys of the user localized to the engine, provided the user supports the security
+// level of the flags
+func (u *SNMPUSM) localizedKeys(flags byte, engineID []byte) (*snmpKeys, error) {
+	if flags&SNMPFlagPriv != 0 && flags&SNMPFlagAuth == 0 || flags&^u.Flags()&(SNMPFlagAuth|SNMPFlagPriv) != 0 {
+		return nil, ErrSNMPSecurityLevel
+	}
+	if keys, ok := u.keys[string(engineID)]; ok {
+		return keys, nil
+	}
+
+	keys := &snmpKeys{auth: snmpLocalizeKey(u.auth.hash, u.authKey, engineID)}
+	if u.priv != nil {
+		keys.priv = snmpLocalizeKey(u.auth.hash, u.privKey, engineID)
+		for len(keys.priv) < u.priv.keyLength {
+			if u.priv.reeder {
+				extension := snmpPasswordToKey(u.auth.hash, keys.priv)
+				keys.priv = append(keys.priv, snmpLocalizeKey(u.auth.hash, extension, engineID)...)
+			} else {
+				h := u.auth.hash()
+				h.Write(keys.priv)
+				keys.priv = h.Sum(keys.priv)
+			}
+		}
+	}
+	u.keys[string(engineID)] = keys
+	return keys, nil
+}
+
+// authenticate computes the truncated HMAC of a message, whose msgAuthenticationParameters are zeros
+func (u *SNMPUSM) authenticate(keys *snmpKeys, message []byte) []byte {
+	mac := hmac.New(u.auth.hash, keys.auth)
+	mac.Write(message)
+	return mac.Sum(nil)[:u.auth.digestLength]
+}
+
+// iv combines the salt with the engine's boots and time for AES, or with the pre-IV of the key for DES
+func (u *SNMPUSM) iv(keys *snmpKeys, boots, engineTime int64, salt []byte) []byte {
+	if u.priv.des {
+		iv := make([]byte, des.BlockSize)
+		for i := range iv {
+			iv[i] = keys.priv[des.BlockSize+i] ^ salt[i]
+		}
+		return iv
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	return iv
+}
+
+func (u *SNMPUSM) cipher(keys *snmpKeys) (cipher.Block, error) {
+	if u.priv.des {
+		return des.NewCipher(keys.priv[:des.BlockSize])
+	}
+	return aes.NewCipher(keys.priv[:u.priv.keyLength])
+}
+
+// encrypt encrypts a scoped PDU, returning the ciphertext and the salt carried by msgPrivacyParameters
+func (u *SNMPUSM) encrypt(keys *snmpKeys, boots, engineTime int64, plaintext []byte) ([]byte, []byte, error) {
+	block, err := u.cipher(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.salt++
+	salt := make([]byte, 8)
+	if u.priv.des {
+		binary.BigEndian.PutUint32(salt, uint32(boots))
+		binary.BigEndian.PutUint32(salt[4:], uint32(u.salt))
+		// DES pads the plaintext to whole blocks, which is ignored when decoding it
+		padded := make([]byte, (len(plaintext)+des.BlockSize-1)/des.BlockSize*des.BlockSize)
+		copy(padded, plaintext)
+		ciphertext := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, u.iv(keys, boots, engineTime, salt)).CryptBlocks(ciphertext, padded)
+		return ciphertext, salt, nil
+	}
+	binary.BigEndian.PutUint64(salt, u.salt)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCFBEncrypter(block, u.iv(keys, boots, engineTime, salt)).XORKeyStream(ciphertext, plaintext)
+	return ciphertext, salt, nil
+}
+
+// decrypt decrypts a scoped PDU by the salt carried by msgPrivacyParameters
+func (u *SNMPUSM) decrypt(keys *snmpKeys, boots, engineTime int64, salt, ciphertext []byte) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, ErrSNMPDecryption
+	}
+	block, err := u.cipher(keys)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	if u.priv.des {
+		if len(ciphertext)%des.BlockSize != 0 {
+			return nil, ErrSNMPDecryption
+		}
+		cipher.NewCBCDecrypter(block, u.iv(keys, boots, engineTime, salt)).CryptBlocks(plaintext, ciphertext)
+		return plaintext, nil
+	}
+	cipher.NewCFBDecrypter(block, u.iv(keys, boots, engineTime, salt)).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
@@ -0,0 +1,47 @@
+//
+// Copyright 2018 Rackspace
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS-IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSNMPLocalizeKey_RFC3414(t *testing.T) {
+	// the sample keys of RFC 3414 A.3
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	for _, test := range []struct {
+		name      string
+		newHash   func() hash.Hash
+		key       string
+		localized string
+	}{
+		{"MD5", md5.New, "9faf3283884e92834ebc9847d8edd963", "526f5eed9fcce26f8964c2930787d82b"},
+		{"SHA", sha1.New, "9fb5cc0381497b3793528939ff788d5d79145211", "6695febc9288e36282235fc7151f128497b38f3f"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			key := snmpPasswordToKey(test.newHash, []byte("maplesyrup"))
+			assert.Equal(t, test.key, hex.EncodeToString(key))
+			assert.Equal(t, test.localized, hex.EncodeToString(snmpLocalizeKey(test.newHash, key, engineID)))
+		})
+	}
+}